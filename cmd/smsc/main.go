@@ -12,13 +12,28 @@ import (
 	"github.com/sirupsen/logrus"
 	
 	"smsc/internal/api"
+	"smsc/internal/auth"
 	"smsc/internal/config"
+	"smsc/internal/core"
 	"smsc/internal/db"
+	"smsc/internal/health"
 	"smsc/internal/protocols/smpp"
 	"smsc/internal/protocols/sigtran"
+	"smsc/internal/ratelimit"
+	"smsc/internal/services/batch"
+	"smsc/internal/services/billing"
+	"smsc/internal/services/campaign"
+	"smsc/internal/services/cdr"
+	"smsc/internal/services/invoice"
+	"smsc/internal/services/mo"
 	"smsc/internal/services/monitoring"
+	"smsc/internal/services/pricing"
 	"smsc/internal/services/queue"
 	"smsc/internal/services/routing"
+	"smsc/internal/services/tenant"
+	"smsc/internal/services/upstream"
+	"smsc/internal/services/webhook"
+	"smsc/internal/tracing"
 	"smsc/pkg/logger"
 )
 
@@ -34,6 +49,13 @@ func init() {
 func main() {
 	flag.Parse()
 
+	if flag.Arg(0) == "simulate" {
+		os.Exit(runSimulate(flag.Args()[1:]))
+	}
+	if flag.Arg(0) == "export-cdrs" {
+		os.Exit(runExportCDRs(flag.Args()[1:]))
+	}
+
 	// Load configuration
 	cfg, err := config.Load(configFile)
 	if err != nil {
@@ -52,6 +74,12 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Initialize tracing
+	shutdownTracing, err := tracing.Init(ctx, cfg.Tracing, log)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// Initialize database
 	database, err := db.New(cfg.Database, log)
 	if err != nil {
@@ -64,40 +92,167 @@ func main() {
 		log.Fatalf("Failed to initialize database schema: %v", err)
 	}
 
+	authService := auth.New(cfg.Security, database, log)
+	if err := authService.Bootstrap(ctx); err != nil {
+		log.Fatalf("Failed to create admin user: %v", err)
+	}
+
 	// Initialize services
 	monitoringService := monitoring.New(cfg.Monitoring, log)
 	if err := monitoringService.Start(ctx); err != nil {
 		log.Fatalf("Failed to start monitoring service: %v", err)
 	}
 
-	queueService := queue.New(cfg.Queue, log)
-	if err := queueService.Start(ctx); err != nil {
-		log.Fatalf("Failed to start queue service: %v", err)
+	// Operator and tenant TPS limits are shared by all instances
+	tpsLimiter, err := ratelimit.NewTPS(cfg.TPS, cfg.Redis, log)
+	if err != nil {
+		log.Fatalf("Failed to initialize TPS limiter: %v", err)
 	}
+	defer tpsLimiter.Close()
 
 	routingService := routing.New(cfg.Routing, log)
+	routingService.SetThrottle(tpsLimiter)
+	routingService.SetDatabase(database)
 	if err := routingService.Start(ctx); err != nil {
 		log.Fatalf("Failed to start routing service: %v", err)
 	}
 
-	// Initialize protocol handlers
+	webhookService := webhook.New(cfg.Webhooks, database, log)
+	if err := webhookService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start webhook service: %v", err)
+	}
+
+	pricingService := pricing.New(database, routingService, log)
+	if err := pricingService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start pricing service: %v", err)
+	}
+
+	queueService := queue.New(cfg.Queue, log)
+	tenantService := tenant.New(cfg.Tenants, database, routingService, queueService, pricingService, tpsLimiter, log)
+	if err := tenantService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start tenant service: %v", err)
+	}
+
+	billingService := billing.New(cfg.Billing, database, log)
+	if err := billingService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start billing service: %v", err)
+	}
+
+	cdrService := cdr.New(cfg.CDR, database, log)
+	if err := cdrService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start CDR service: %v", err)
+	}
+
+	invoiceService := invoice.New(cfg.Invoices, database, log)
+	if err := invoiceService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start invoice service: %v", err)
+	}
+
+	pipeline := core.NewPipeline(database, queueService, routingService, monitoringService, log)
+	// Operators with an HTTP gateway are submitted to; messages routed to the
+	// others end in the routed status
+	gateway := upstream.New(cfg.Routing.Operators, log)
+	pipeline.SetSubmitter(gateway.Submit)
+	// The tenant sets the price of a message before billing reserves it
+	pipeline.AddAdmission(tenantService.Admit)
+	pipeline.AddAdmission(billingService.Admit)
+	pipeline.AddStatusListener(billingService.Settle)
+	// CDRs are written once billing settled the message
+	pipeline.AddStatusListener(cdrService.Record)
+	pipeline.AddStatusListener(webhookService.Notify)
+	queueService.SetProcessor(pipeline.Process)
+	queueService.SetDropHandler(pipeline.Drop)
+	if err := queueService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start queue service: %v", err)
+	}
+	// The queue is in memory; messages of stopped instances are queued again
+	if err := pipeline.Start(ctx); err != nil {
+		log.Fatalf("Failed to start message pipeline: %v", err)
+	}
+
+	batchService := batch.New(cfg.Batch, database, pipeline, queueService, log)
+	if err := batchService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start batch service: %v", err)
+	}
+
+	campaignService := campaign.New(database, pipeline, queueService, routingService, log)
+	if err := campaignService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start campaign service: %v", err)
+	}
+
+	// Initialize protocol handlers; inbound messages are routed by the MO
+	// service, which must be running before receivers can bind
 	smppServer := smpp.New(cfg.SMPP, log)
+	moService := mo.New(cfg.MO, database, smppServer, log)
+	if err := moService.Start(ctx); err != nil {
+		log.Fatalf("Failed to start MO service: %v", err)
+	}
+
+	smppServer.SetThrottle(tenantService.Throttle)
 	if err := smppServer.Start(); err != nil {
 		log.Fatalf("Failed to start SMPP server: %v", err)
 	}
 
 	sigtranStack := sigtran.New(cfg.Sigtran, log)
+	sigtranStack.SetMOHandler(moService.Receive)
 	if err := sigtranStack.Start(); err != nil {
 		log.Fatalf("Failed to start Sigtran stack: %v", err)
 	}
 
+	// Register component health checks
+	healthRegistry := health.NewRegistry(2 * time.Second)
+	healthRegistry.Register("database", true, database.Ping)
+	healthRegistry.Register("queue", true, queueService.Check)
+	healthRegistry.Register("routing", true, routingService.Check)
+	healthRegistry.Register("smpp", true, smppServer.Check)
+	healthRegistry.Register("sigtran", true, sigtranStack.Check)
+	for _, op := range cfg.Routing.Operators {
+		name := op.Name
+		healthRegistry.Register("operator:"+name, false, func(ctx context.Context) error {
+			return routingService.CheckOperator(ctx, name)
+		})
+	}
+
+	monitoringService.SetSources(monitoring.Sources{
+		Health:  healthRegistry,
+		Queue:   queueService,
+		Routing: routingService,
+		SMPP:    smppServer,
+		Sigtran: sigtranStack,
+	})
+
 	// Initialize API server
+	limiter, err := ratelimit.New(cfg.RateLimit, cfg.Redis, log)
+	if err != nil {
+		log.Fatalf("Failed to initialize rate limiter: %v", err)
+	}
+	defer limiter.Close()
+
 	apiServer := api.New(api.Config{
 		Host:           cfg.Server.Host,
 		Port:           cfg.Server.Port,
 		ReadTimeout:    30 * time.Second,
 		WriteTimeout:   30 * time.Second,
 		MaxHeaderBytes: 1 << 20,
+		CORSOrigins:    cfg.Security.CORSOrigins,
+		RateLimit:      cfg.RateLimit,
+	}, api.Dependencies{
+		Auth:      authService,
+		Limiter:   limiter,
+		DB:        database,
+		Batch:     batchService,
+		Billing:   billingService,
+		Campaigns: campaignService,
+		CDRs:      cdrService,
+		Invoices:  invoiceService,
+		Pipeline:  pipeline,
+		MO:        moService,
+		Pricing:   pricingService,
+		Routing:   routingService,
+		Tenants:   tenantService,
+		Upstream:  gateway,
+		Webhooks:  webhookService,
+		Health:    healthRegistry,
 	}, log)
 
 	if err := apiServer.Start(); err != nil {
@@ -129,6 +284,59 @@ func main() {
 		log.Errorf("Sigtran stack shutdown error: %v", err)
 	}
 
+	if err := moService.Stop(shutdownCtx); err != nil {
+		log.Errorf("MO service shutdown error: %v", err)
+	}
+
+	if err := campaignService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Campaign service shutdown error: %v", err)
+	}
+
+	if err := batchService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Batch service shutdown error: %v", err)
+	}
+
+	if err := queueService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Queue service shutdown error: %v", err)
+	}
+
+	// Other instances take over the messages left queued here
+	if err := pipeline.Stop(shutdownCtx); err != nil {
+		log.Errorf("Message pipeline shutdown error: %v", err)
+	}
+
+	if err := invoiceService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Invoice service shutdown error: %v", err)
+	}
+
+	if err := cdrService.Stop(shutdownCtx); err != nil {
+		log.Errorf("CDR service shutdown error: %v", err)
+	}
+
+	if err := billingService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Billing service shutdown error: %v", err)
+	}
+
+	if err := tenantService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Tenant service shutdown error: %v", err)
+	}
+
+	if err := pricingService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Pricing service shutdown error: %v", err)
+	}
+
+	if err := webhookService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Webhook service shutdown error: %v", err)
+	}
+
+	if err := monitoringService.Stop(shutdownCtx); err != nil {
+		log.Errorf("Monitoring service shutdown error: %v", err)
+	}
+
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		log.Errorf("Tracing shutdown error: %v", err)
+	}
+
 	// Cancel context to stop all services
 	cancel()
 
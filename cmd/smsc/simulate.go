@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// runSimulate implements the "simulate" subcommand, asking a running gateway
+// how it would route a message without sending it
+func runSimulate(args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:8080", "base URL of the gateway API")
+	recipient := fs.String("recipient", "", "recipient MSISDN (required)")
+	sender := fs.String("sender", "", "sender ID")
+	client := fs.String("client", "", "client/ESME account ID")
+	content := fs.String("content", "", "message content")
+	serviceType := fs.String("service-type", "", "SMPP service_type")
+	priority := fs.Int("priority", -1, "message priority (0-3)")
+	fs.Parse(args)
+
+	if *recipient == "" {
+		fmt.Fprintln(os.Stderr, "simulate: -recipient is required")
+		fs.Usage()
+		return 2
+	}
+
+	req := map[string]interface{}{
+		"recipient":   *recipient,
+		"sender":      *sender,
+		"clientId":    *client,
+		"content":     *content,
+		"serviceType": *serviceType,
+	}
+	if *priority >= 0 {
+		req["priority"] = *priority
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return 1
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	resp, err := httpClient.Post(*url+"/api/v1/routing/simulate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: failed to read response: %v\n", err)
+		return 1
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		out.Reset()
+		out.Write(data)
+	}
+	fmt.Println(out.String())
+
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/auth"
+	"smsc/internal/db"
+	"smsc/internal/models"
+)
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type apiKeyRequest struct {
+	Name      string      `json:"name" binding:"required"`
+	Role      models.Role `json:"role"` // defaults to tenant for client keys, admin otherwise
+	ClientID  string      `json:"clientId"`
+	ExpiresIn int         `json:"expiresIn"` // seconds, zero never expires
+}
+
+type userRequest struct {
+	Username string      `json:"username" binding:"required"`
+	Password string      `json:"password" binding:"required"`
+	Role     models.Role `json:"role" binding:"required"`
+	ClientID string      `json:"clientId"`
+}
+
+type userUpdateRequest struct {
+	Password *string      `json:"password"`
+	Role     *models.Role `json:"role"`
+	ClientID *string      `json:"clientId"`
+	Disabled *bool        `json:"disabled"`
+}
+
+func (s *Server) login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, expires, err := s.deps.Auth.Login(c.Request.Context(), req.Username, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"expiresAt": expires,
+	})
+}
+
+// refreshToken issues a fresh token to a logged in user with their current
+// role. Disabled users are refused.
+func (s *Server) refreshToken(c *gin.Context) {
+	p := principal(c)
+	if p.IsAPIKey() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API keys cannot be exchanged for tokens"})
+		return
+	}
+
+	token, expires, err := s.deps.Auth.Refresh(c.Request.Context(), p)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":     token,
+		"expiresAt": expires,
+	})
+}
+
+func (s *Server) getPrincipal(c *gin.Context) {
+	c.JSON(http.StatusOK, principal(c))
+}
+
+func (s *Server) listAPIKeys(c *gin.Context) {
+	keys, err := s.deps.Auth.Keys(c.Request.Context(), scopeClient(c, c.Query("client")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// createAPIKey creates an API key. The key itself is only returned here.
+func (s *Server) createAPIKey(c *gin.Context) {
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresIn must not be negative"})
+		return
+	}
+
+	// Tenants can only create tenant keys of their own client
+	p := principal(c)
+	if tenant := p.Tenant(); tenant != "" {
+		if req.Role != "" && req.Role != models.RoleTenant {
+			c.JSON(http.StatusForbidden, gin.H{"error": "tenants can only create tenant keys"})
+			return
+		}
+		req.Role, req.ClientID = models.RoleTenant, tenant
+	}
+	if req.Role == "" {
+		req.Role = models.RoleAdmin
+		if req.ClientID != "" {
+			req.Role = models.RoleTenant
+		}
+	}
+	if req.Role == models.RoleAdmin && p.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only admins can create admin keys"})
+		return
+	}
+	if !s.checkTenant(c, req.ClientID) {
+		return
+	}
+
+	key, secret, err := s.deps.Auth.CreateKey(c.Request.Context(), req.Name, req.Role, req.ClientID,
+		p.Subject, time.Duration(req.ExpiresIn)*time.Second)
+	if errors.Is(err, auth.ErrInvalidRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    key,
+		"apiKey": secret,
+	})
+}
+
+// rotateAPIKey replaces a key; the old one keeps working for a grace period
+func (s *Server) rotateAPIKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return
+	}
+
+	if !s.ownsAPIKey(c, id) {
+		return
+	}
+
+	key, secret, err := s.deps.Auth.RotateKey(c.Request.Context(), id, principal(c).Subject)
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if errors.Is(err, auth.ErrKeyInactive) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    key,
+		"apiKey": secret,
+	})
+}
+
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return
+	}
+
+	if !s.ownsAPIKey(c, id) {
+		return
+	}
+
+	err = s.deps.Auth.RevokeKey(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// ownsAPIKey checks that a tenant caller owns an API key and writes a not
+// found response otherwise. Staff callers own every key.
+func (s *Server) ownsAPIKey(c *gin.Context, id int64) bool {
+	if principal(c).Tenant() == "" {
+		return true
+	}
+
+	key, err := s.deps.Auth.Key(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && !canAccess(c, key.ClientID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (s *Server) listUsers(c *gin.Context) {
+	users, err := s.deps.Auth.Users(c.Request.Context(), c.Query("client"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (s *Server) createUser(c *gin.Context) {
+	var req userRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.checkTenant(c, req.ClientID) {
+		return
+	}
+
+	user, err := s.deps.Auth.CreateUser(c.Request.Context(), req.Username, req.Password, req.Role, req.ClientID)
+	if errors.Is(err, auth.ErrInvalidRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+func (s *Server) updateUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req userUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ClientID != nil && !s.checkTenant(c, *req.ClientID) {
+		return
+	}
+
+	user, err := s.deps.Auth.UpdateUser(c.Request.Context(), id, auth.UserUpdate{
+		Password: req.Password,
+		Role:     req.Role,
+		ClientID: req.ClientID,
+		Disabled: req.Disabled,
+	})
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
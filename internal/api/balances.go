@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/billing"
+)
+
+type adjustmentRequest struct {
+	Amount float64 `json:"amount"`
+	Note   string  `json:"note"`
+}
+
+// listBalances returns the prepaid balances; tenant callers only see their own
+func (s *Server) listBalances(c *gin.Context) {
+	balances, err := s.deps.Billing.Balances(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if own := principal(c).Tenant(); own != "" {
+		scoped := make([]*models.Balance, 0, 1)
+		for _, b := range balances {
+			if b.ClientID == own {
+				scoped = append(scoped, b)
+			}
+		}
+		balances = scoped
+	}
+
+	c.JSON(http.StatusOK, balances)
+}
+
+func (s *Server) getBalance(c *gin.Context) {
+	clientID := c.Param("client")
+	if !canAccess(c, clientID) {
+		balanceError(c, db.ErrNotFound)
+		return
+	}
+
+	balance, err := s.deps.Billing.Balance(c.Request.Context(), clientID)
+	if err != nil {
+		balanceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// adjustBalance tops up a prepaid balance, or takes from it with a negative
+// amount. The first adjustment opens the account, after which the client's
+// messages are charged.
+func (s *Server) adjustBalance(c *gin.Context) {
+	var req adjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	balance, err := s.deps.Billing.Adjust(c.Request.Context(), c.Param("client"), req.Amount, req.Note)
+	if err != nil {
+		balanceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+// listBalanceTransactions returns the ledger of a prepaid account, newest first
+func (s *Server) listBalanceTransactions(c *gin.Context) {
+	clientID := c.Param("client")
+	if !canAccess(c, clientID) {
+		balanceError(c, db.ErrNotFound)
+		return
+	}
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	transactions, next, err := s.deps.Billing.Transactions(c.Request.Context(), clientID, limit, c.Query("cursor"))
+	if err != nil {
+		balanceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"transactions": transactions,
+		"nextCursor":   next,
+	})
+}
+
+// balanceError maps billing errors to HTTP statuses
+func balanceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "balance not found"})
+	case errors.Is(err, db.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, billing.ErrInvalidAmount), errors.Is(err, db.ErrInsufficientBalance):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/batch"
+	"smsc/pkg/utils"
+)
+
+// maxUploadBody bounds the size of batch and audience uploads
+const maxUploadBody = 64 << 20
+
+type batchRequest struct {
+	Sender     string            `json:"sender" form:"sender" binding:"required"`
+	Template   string            `json:"template" form:"template" binding:"required"`
+	Recipients []batch.Recipient `json:"recipients" form:"-"`
+	messageOptions
+}
+
+// createBatch starts a bulk send. Recipients come either as a JSON array or,
+// for multipart requests, as an uploaded CSV "file" with the other fields as
+// form values.
+func (s *Server) createBatch(c *gin.Context) {
+	var req batchRequest
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBody)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		if err := c.ShouldBind(&req); err != nil {
+			uploadError(c, err)
+			return
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recipient CSV file is required"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		if req.Recipients, err = batch.ParseCSV(f, s.deps.Batch.MaxRecipients()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	req.ClientID = scopeClient(c, req.ClientID)
+
+	if err := utils.ValidateSender(req.Sender); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	proto := models.NewMessage(req.Sender, "", req.Template)
+	if err := req.apply(proto); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.deps.Batch.Create(c.Request.Context(), proto, req.Recipients)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, created)
+}
+
+func (s *Server) getBatch(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch ID"})
+		return
+	}
+
+	b, ok := s.lookupBatch(c, id)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, b)
+}
+
+// listBatchRecipients returns per-recipient outcomes, optionally filtered by ?status=
+func (s *Server) listBatchRecipients(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid batch ID"})
+		return
+	}
+
+	if _, ok := s.lookupBatch(c, id); !ok {
+		return
+	}
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	recipients, next, err := s.deps.DB.ListBatchRecipients(c.Request.Context(), id,
+		models.RecipientStatus(c.Query("status")), c.Query("cursor"), limit)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"recipients": recipients,
+		"nextCursor": next,
+	})
+}
+
+// lookupBatch fetches a batch the caller may see and writes the error
+// response otherwise
+func (s *Server) lookupBatch(c *gin.Context, id int64) (*models.Batch, bool) {
+	b, err := s.deps.DB.GetBatch(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && !canAccess(c, b.ClientID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "batch not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return b, true
+}
+
+// uploadError rejects an upload that could not be read, with 413 when it
+// exceeds maxUploadBody
+func uploadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("upload exceeds %d bytes", tooLarge.Limit)})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
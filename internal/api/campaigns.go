@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/batch"
+	"smsc/internal/services/campaign"
+)
+
+type campaignRequest struct {
+	Name           string             `json:"name" binding:"required"`
+	Sender         string             `json:"sender" binding:"required"`
+	Template       string             `json:"template" binding:"required"`
+	ClientID       string             `json:"clientId"`
+	StartAt        *time.Time         `json:"startAt"`
+	Throttle       int                `json:"throttle"` // messages per second
+	QuietHours     *models.QuietHours `json:"quietHours"`
+	BudgetCap      float64            `json:"budgetCap"`
+	Priority       *int               `json:"priority"`
+	ValidityPeriod int                `json:"validityPeriod"` // seconds
+	CallbackURL    string             `json:"callbackUrl"`
+	Recipients     []batch.Recipient  `json:"recipients"`
+}
+
+func (r campaignRequest) campaign() *models.Campaign {
+	c := &models.Campaign{
+		Name:           r.Name,
+		ClientID:       r.ClientID,
+		Sender:         r.Sender,
+		Template:       r.Template,
+		StartAt:        r.StartAt,
+		Throttle:       r.Throttle,
+		QuietHours:     r.QuietHours,
+		BudgetCap:      r.BudgetCap,
+		Priority:       1,
+		ValidityPeriod: r.ValidityPeriod,
+		CallbackURL:    r.CallbackURL,
+	}
+	if r.Priority != nil {
+		c.Priority = *r.Priority
+	}
+	return c
+}
+
+func (s *Server) listCampaigns(c *gin.Context) {
+	campaigns, err := s.deps.DB.ListCampaigns(c.Request.Context(), scopeClient(c, c.Query("client")), models.CampaignStatus(c.Query("status")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, campaigns)
+}
+
+func (s *Server) createCampaign(c *gin.Context) {
+	var req campaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.ClientID = scopeClient(c, req.ClientID)
+	created := req.campaign()
+	audience, err := s.deps.Campaigns.Create(c.Request.Context(), created, req.Recipients)
+	if err != nil {
+		campaignError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"campaign": created,
+		"audience": audience,
+	})
+}
+
+func (s *Server) getCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	found, ok := s.lookupCampaign(c, id)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, found)
+}
+
+func (s *Server) updateCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+
+	var req campaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, ok := s.lookupCampaign(c, id); !ok {
+		return
+	}
+
+	req.ClientID = scopeClient(c, req.ClientID)
+	update := req.campaign()
+	update.ID = id
+	updated, err := s.deps.Campaigns.Update(c.Request.Context(), update)
+	if err != nil {
+		campaignError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// addCampaignAudience appends recipients given as a JSON {"recipients": [...]}
+// body, a text/csv body or an uploaded CSV "file"
+func (s *Server) addCampaignAudience(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+	if _, ok := s.lookupCampaign(c, id); !ok {
+		return
+	}
+
+	var (
+		recipients []batch.Recipient
+		err        error
+	)
+	limit := s.deps.Batch.MaxRecipients()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBody)
+	switch {
+	case strings.HasPrefix(c.ContentType(), "multipart/"):
+		file, ferr := c.FormFile("file")
+		if ferr != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(ferr, &tooLarge) {
+				uploadError(c, ferr)
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recipient CSV file is required"})
+			return
+		}
+		f, ferr := file.Open()
+		if ferr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ferr.Error()})
+			return
+		}
+		defer f.Close()
+		recipients, err = batch.ParseCSV(f, limit)
+	case c.ContentType() == "text/csv":
+		recipients, err = batch.ParseCSV(c.Request.Body, limit)
+	default:
+		var req struct {
+			Recipients []batch.Recipient `json:"recipients" binding:"required"`
+		}
+		err = c.ShouldBindJSON(&req)
+		recipients = req.Recipients
+	}
+	if err != nil {
+		uploadError(c, err)
+		return
+	}
+
+	result, err := s.deps.Campaigns.AddAudience(c.Request.Context(), id, recipients)
+	if err != nil {
+		campaignError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// controlCampaign applies a start, pause, resume or cancel action
+func (s *Server) controlCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+	if _, ok := s.lookupCampaign(c, id); !ok {
+		return
+	}
+
+	actions := map[string]func(context.Context, int64) (*models.Campaign, error){
+		"start":  s.deps.Campaigns.StartCampaign,
+		"pause":  s.deps.Campaigns.PauseCampaign,
+		"resume": s.deps.Campaigns.ResumeCampaign,
+		"cancel": s.deps.Campaigns.CancelCampaign,
+	}
+	action, ok := actions[c.Param("action")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown campaign action: " + c.Param("action")})
+		return
+	}
+
+	updated, err := action(c.Request.Context(), id)
+	if err != nil {
+		campaignError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+func (s *Server) getCampaignStats(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+	if _, ok := s.lookupCampaign(c, id); !ok {
+		return
+	}
+
+	stats, err := s.deps.Campaigns.Stats(c.Request.Context(), id)
+	if err != nil {
+		campaignError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+func campaignID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid campaign ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// lookupCampaign fetches a campaign the caller may see and writes the error
+// response otherwise
+func (s *Server) lookupCampaign(c *gin.Context, id int64) (*models.Campaign, bool) {
+	found, err := s.deps.DB.GetCampaign(c.Request.Context(), id)
+	if err == nil && !canAccess(c, found.ClientID) {
+		err = db.ErrNotFound
+	}
+	if err != nil {
+		campaignError(c, err)
+		return nil, false
+	}
+	return found, true
+}
+
+// campaignError maps campaign service errors to HTTP statuses
+func campaignError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+	case errors.Is(err, campaign.ErrInvalidCampaign):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, campaign.ErrInvalidState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/cdr"
+)
+
+// cdrFilter reads the client and completion range of a CDR query. Tenant
+// callers are restricted to their own records.
+func cdrFilter(c *gin.Context) (db.CDRFilter, error) {
+	filter := db.CDRFilter{
+		ClientID: scopeClient(c, c.Query("client")),
+		Cursor:   c.Query("cursor"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		return filter, err
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			return filter, errors.New("invalid limit")
+		}
+	}
+	return filter, nil
+}
+
+// listCDRs returns a page of call detail records, oldest first
+func (s *Server) listCDRs(c *gin.Context) {
+	filter, err := cdrFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cdrs, next, err := s.deps.CDRs.List(c.Request.Context(), filter)
+	if err != nil {
+		cdrError(c, err)
+		return
+	}
+
+	// Tenants do not see the operator of their messages or what it was paid
+	var records interface{} = cdrs
+	if principal(c).Tenant() != "" {
+		views := make([]*models.TenantCDR, len(cdrs))
+		for i, record := range cdrs {
+			views[i] = record.TenantView()
+		}
+		records = views
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cdrs":       records,
+		"nextCursor": next,
+	})
+}
+
+// exportCDRs streams every call detail record in a range as a CSV or JSON
+// lines file
+func (s *Server) exportCDRs(c *gin.Context) {
+	filter, err := cdrFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := c.DefaultQuery("format", cdr.FormatCSV)
+	if format != cdr.FormatCSV && format != cdr.FormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	c.Header("Content-Type", cdr.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="cdrs.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	// The status is sent with the first record, so a failure half way can
+	// only cut the file short
+	if err := s.deps.CDRs.Export(c.Request.Context(), c.Writer, format, filter, principal(c).Tenant() != ""); err != nil {
+		s.log.WithError(err).Error("CDR export failed")
+	}
+}
+
+// cdrError maps CDR service errors to HTTP statuses
+func cdrError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrInvalidCursor), errors.Is(err, cdr.ErrInvalidRange), errors.Is(err, cdr.ErrInvalidFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/services/upstream"
+	"smsc/internal/services/webhook"
+)
+
+// maxReportBody bounds the size of a delivery report
+const maxReportBody = 64 << 10
+
+// receiveDeliveryReport applies a delivery report posted by the HTTP gateway
+// of an operator. Reports are authenticated by their signature rather than
+// API credentials.
+func (s *Server) receiveDeliveryReport(c *gin.Context) {
+	if s.deps.Upstream == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operator not found"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxReportBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+
+	operatorID := c.Param("operator")
+	report, err := s.deps.Upstream.ParseReport(operatorID, c.GetHeader(webhook.SignatureHeader), body)
+	if errors.Is(err, upstream.ErrUnknownOperator) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "operator not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = s.deps.Pipeline.DeliveryReport(c.Request.Context(), operatorID, report.ID, report.Status, report.Report)
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/invoice"
+)
+
+type invoiceRequest struct {
+	ClientID string                 `json:"clientId" binding:"required"`
+	Period   string                 `json:"period" binding:"required"` // YYYY-MM
+	Credits  []models.InvoiceCredit `json:"credits"`
+}
+
+// getUsageStatement returns the usage of a client in a month per destination
+// country and network
+func (s *Server) getUsageStatement(c *gin.Context) {
+	clientID := scopeClient(c, c.Query("client"))
+	if clientID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "client is required"})
+		return
+	}
+
+	statement, err := s.deps.Invoices.Usage(c.Request.Context(), clientID, c.Query("period"))
+	if err != nil {
+		invoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statement)
+}
+
+// listInvoices returns the invoices, newest first; tenant callers only see
+// their own
+func (s *Server) listInvoices(c *gin.Context) {
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	invoices, next, err := s.deps.Invoices.Invoices(c.Request.Context(), scopeClient(c, c.Query("client")), limit, c.Query("cursor"))
+	if err != nil {
+		invoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invoices":   invoices,
+		"nextCursor": next,
+	})
+}
+
+// createInvoice issues the invoice of a client for a month that is over
+func (s *Server) createInvoice(c *gin.Context) {
+	var req invoiceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	inv, err := s.deps.Invoices.Generate(c.Request.Context(), req.ClientID, req.Period, req.Credits)
+	if err != nil {
+		invoiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, inv)
+}
+
+// getInvoice returns an invoice as JSON, or as an HTML or PDF download with
+// format=html or format=pdf
+func (s *Server) getInvoice(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		invoiceError(c, db.ErrNotFound)
+		return
+	}
+
+	inv, err := s.deps.Invoices.Invoice(c.Request.Context(), id)
+	if err != nil {
+		invoiceError(c, err)
+		return
+	}
+	if !canAccess(c, inv.ClientID) {
+		invoiceError(c, db.ErrNotFound)
+		return
+	}
+
+	var (
+		render      func(w io.Writer, inv *models.Invoice) error
+		contentType string
+	)
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.JSON(http.StatusOK, inv)
+		return
+	case "html":
+		render, contentType = s.deps.Invoices.RenderHTML, "text/html; charset=utf-8"
+	case "pdf":
+		render, contentType = s.deps.Invoices.RenderPDF, "application/pdf"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json, html or pdf"})
+		return
+	}
+
+	var body bytes.Buffer
+	if err := render(&body, inv); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="`+inv.Number+`.`+c.Query("format")+`"`)
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+// invoiceError maps invoice service errors to HTTP statuses
+func invoiceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "invoice not found"})
+	case errors.Is(err, db.ErrInvoiceExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, db.ErrInvalidCursor), errors.Is(err, invoice.ErrInvalidPeriod):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, invoice.ErrInvalidCredit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
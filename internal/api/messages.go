@@ -0,0 +1,362 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/queue"
+	"smsc/internal/services/webhook"
+	"smsc/pkg/utils"
+)
+
+// Message ID kinds accepted by the status lookup
+const (
+	idInternal = "internal"
+	idSMPP     = "smpp"
+	idUpstream = "upstream"
+)
+
+const (
+	// idempotencyTTL is how long an Idempotency-Key is remembered
+	idempotencyTTL       = 24 * time.Hour
+	maxIdempotencyKeyLen = 255
+	maxValidityPeriod    = 7 * 24 * time.Hour
+)
+
+// messageOptions are the delivery options shared by single and batch sends
+type messageOptions struct {
+	ClientID       string     `json:"clientId" form:"clientId"`
+	Priority       *int       `json:"priority" form:"priority"`
+	ScheduledAt    *time.Time `json:"scheduledAt" form:"scheduledAt"`
+	ValidityPeriod int        `json:"validityPeriod" form:"validityPeriod"` // seconds
+	CallbackURL    string     `json:"callbackUrl" form:"callbackUrl"`
+}
+
+type sendRequest struct {
+	Sender    string `json:"sender" binding:"required"`
+	Recipient string `json:"recipient" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+	messageOptions
+}
+
+type sendResponse struct {
+	ID          int64                `json:"id"`
+	Status      models.MessageStatus `json:"status"`
+	Encoding    string               `json:"encoding"`
+	Segments    int                  `json:"segments"`
+	ScheduledAt *time.Time           `json:"scheduledAt,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt"`
+}
+
+// sendMessage validates and queues a message. Requests carrying an
+// Idempotency-Key header are executed once per client and key; retries get
+// the original response back.
+func (s *Server) sendMessage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req sendRequest
+	if err := binding.JSON.BindBody(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.ClientID = scopeClient(c, req.ClientID)
+
+	msg, err := req.message()
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := c.GetHeader("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		return
+	}
+
+	if key != "" {
+		hash := sha256.Sum256(body)
+		claim, claimed, err := s.deps.DB.ClaimIdempotencyKey(ctx, msg.ClientID, key, hex.EncodeToString(hash[:]), idempotencyTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !claimed {
+			s.replaySend(c, claim, hex.EncodeToString(hash[:]))
+			return
+		}
+	}
+
+	if err := s.deps.Pipeline.Submit(ctx, msg); err != nil {
+		if key != "" {
+			if rerr := s.deps.DB.ReleaseIdempotencyKey(ctx, msg.ClientID, key); rerr != nil {
+				s.log.WithError(rerr).Warn("Failed to release idempotency key")
+			}
+		}
+		submitError(c, err)
+		return
+	}
+
+	if key != "" {
+		if err := s.deps.DB.CompleteIdempotencyKey(ctx, msg.ClientID, key, msg.ID); err != nil {
+			s.log.WithError(err).WithField("message_id", msg.ID).Warn("Failed to complete idempotency key")
+		}
+	}
+
+	c.JSON(http.StatusAccepted, newSendResponse(msg))
+}
+
+// replaySend answers a request whose Idempotency-Key was already used
+func (s *Server) replaySend(c *gin.Context, claim *db.IdempotencyKey, hash string) {
+	if claim.RequestHash != hash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return
+	}
+	if claim.MessageID == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+		return
+	}
+
+	msg, err := s.deps.DB.GetMessage(c.Request.Context(), claim.MessageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.JSON(http.StatusAccepted, newSendResponse(msg))
+}
+
+// message validates the request and builds the message it asks to send
+func (r sendRequest) message() (*models.Message, error) {
+	if err := utils.ValidateSender(r.Sender); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateMSISDN(r.Recipient); err != nil {
+		return nil, err
+	}
+
+	encoding, segments := utils.Segments(r.Content)
+	if segments > utils.MaxSegments {
+		return nil, fmt.Errorf("content needs %d segments, at most %d are allowed", segments, utils.MaxSegments)
+	}
+
+	msg := models.NewMessage(r.Sender, r.Recipient, r.Content)
+	msg.Encoding = encoding
+	msg.DataCoding = utils.DataCoding(encoding)
+
+	if err := r.apply(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// apply validates the options and sets them on the message
+func (o messageOptions) apply(msg *models.Message) error {
+	msg.ClientID = o.ClientID
+
+	if o.Priority != nil {
+		if *o.Priority < 0 || *o.Priority > queue.MaxPriority {
+			return fmt.Errorf("priority must be between 0 and %d", queue.MaxPriority)
+		}
+		msg.Priority = *o.Priority
+	}
+
+	if o.ScheduledAt != nil {
+		if o.ScheduledAt.Before(time.Now()) {
+			return fmt.Errorf("scheduled time is in the past")
+		}
+		scheduled := o.ScheduledAt.UTC()
+		msg.ScheduledTime = &scheduled
+	}
+
+	if o.ValidityPeriod != 0 {
+		validity := time.Duration(o.ValidityPeriod) * time.Second
+		if validity < 0 || validity > maxValidityPeriod {
+			return fmt.Errorf("validity period must be between 1 and %d seconds", int(maxValidityPeriod/time.Second))
+		}
+		msg.ValidityPeriod = validity
+	}
+
+	if o.CallbackURL != "" {
+		if err := webhook.CheckURL(o.CallbackURL); err != nil {
+			return err
+		}
+		msg.CallbackURL = o.CallbackURL
+	}
+
+	return nil
+}
+
+func newSendResponse(msg *models.Message) sendResponse {
+	encoding, segments := utils.Segments(msg.Content)
+	return sendResponse{
+		ID:          msg.ID,
+		Status:      msg.Status,
+		Encoding:    encoding,
+		Segments:    segments,
+		ScheduledAt: msg.ScheduledTime,
+		CreatedAt:   msg.CreatedAt,
+	}
+}
+
+// getMessageStatus looks a message up by its internal ID, the SMPP message_id
+// returned to the ESME or the operator's message ID, and returns it along with
+// its event timeline. Without a ?by= kind every kind is tried in that order.
+func (s *Server) getMessageStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	kinds := []string{idInternal, idSMPP, idUpstream}
+	if by := c.Query("by"); by != "" {
+		kinds = []string{by}
+	}
+
+	var (
+		msg *models.Message
+		err = db.ErrNotFound
+	)
+	for _, kind := range kinds {
+		switch kind {
+		case idInternal:
+			n, perr := strconv.ParseInt(id, 10, 64)
+			if perr != nil {
+				continue
+			}
+			msg, err = s.deps.DB.GetMessage(ctx, n)
+		case idSMPP:
+			msg, err = s.deps.DB.GetMessageBySMPPID(ctx, id)
+		case idUpstream:
+			msg, err = s.deps.DB.GetMessageByUpstreamID(ctx, id)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id kind: " + kind})
+			return
+		}
+		if !errors.Is(err, db.ErrNotFound) {
+			break
+		}
+	}
+
+	if errors.Is(err, db.ErrNotFound) || (err == nil && !canAccess(c, msg.ClientID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := s.deps.DB.MessageEvents(ctx, msg.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Tenants do not see the operator of their messages or what it was paid
+	if principal(c).Tenant() != "" {
+		for i := range events {
+			if events[i].Type == models.EventRouted {
+				events[i].Detail = ""
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": msg.TenantView(),
+			"events":  events,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": msg,
+		"events":  events,
+	})
+}
+
+// listMessages searches messages with optional filters. Results are returned
+// newest first; nextCursor is passed back as ?cursor= to fetch the next page.
+func (s *Server) listMessages(c *gin.Context) {
+	filter := db.MessageFilter{
+		ClientID:   scopeClient(c, c.Query("client")),
+		CampaignID: c.Query("campaign"),
+		Sender:     c.Query("sender"),
+		Recipient:  c.Query("recipient"),
+		Status:     models.MessageStatus(c.Query("status")),
+		OperatorID: c.Query("operator"),
+		Cursor:     c.Query("cursor"),
+	}
+	tenant := principal(c).Tenant() != ""
+	if tenant {
+		filter.OperatorID = ""
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	messages, next, err := s.deps.DB.ListMessages(c.Request.Context(), filter)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var records interface{} = messages
+	if tenant {
+		views := make([]*models.TenantMessage, len(messages))
+		for i, msg := range messages {
+			views[i] = msg.TenantView()
+		}
+		records = views
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   records,
+		"nextCursor": next,
+	})
+}
+
+// parseTimeQuery parses an RFC 3339 timestamp or YYYY-MM-DD date query parameter
+func parseTimeQuery(c *gin.Context, name string) (time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("invalid " + name + " time: " + value)
+	}
+	return t, nil
+}
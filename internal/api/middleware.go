@@ -0,0 +1,256 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"smsc/internal/auth"
+	"smsc/internal/ratelimit"
+	"smsc/internal/tracing"
+)
+
+// principalKey is the gin context key of the authenticated caller
+const principalKey = "principal"
+
+// rateLimitKey is the gin context key of the tightest rate limit budget taken
+// so far by a request
+const rateLimitKey = "rateLimit"
+
+// tracingMiddleware starts a span for every request, continuing the trace
+// propagated by the caller
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		ctx, span := tracing.Start(ctx, fmt.Sprintf("HTTP %s %s", c.Request.Method, route),
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
+
+// corsMiddleware allows browsers on the configured origins to call the API.
+// A "*" origin allows every origin.
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin != "" && (allowed["*"] || allowed[origin]) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Idempotency-Key")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
+			c.Writer.Header().Set("Access-Control-Max-Age", "600")
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authMiddleware requires a valid bearer token or API key, taken from the
+// Authorization header or X-API-Key, and stores the caller in the context
+func (s *Server) authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := c.GetHeader("X-API-Key")
+		if header := c.GetHeader("Authorization"); credential == "" && header != "" {
+			if scheme, value, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+				credential = strings.TrimSpace(value)
+			}
+		}
+		if credential == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="smsc"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+
+		p, err := s.deps.Auth.Authenticate(c.Request.Context(), credential)
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) || errors.Is(err, auth.ErrInvalidAPIKey) {
+			c.Header("WWW-Authenticate", `Bearer realm="smsc", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if tenant := p.Tenant(); tenant != "" {
+			if err := s.deps.Tenants.Check(tenant); err != nil {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// budget is a rate limit bucket a request takes a token from
+type budget struct {
+	key   string
+	limit ratelimit.Limit
+}
+
+// requestRateLimitMiddleware takes a token from the global bucket and from
+// the bucket of the client address. It runs before authentication.
+func (s *Server) requestRateLimitMiddleware() gin.HandlerFunc {
+	cfg := s.cfg.RateLimit
+	global := ratelimit.NewLimit(cfg.RequestsPerSecond, cfg.Burst)
+	perIP := ratelimit.NewLimit(cfg.IPRequestsPerSecond, cfg.IPBurst)
+
+	return s.limitBudgets(func(c *gin.Context) []budget {
+		return []budget{{"global", global}, {"ip:" + c.ClientIP(), perIP}}
+	})
+}
+
+// callerRateLimitMiddleware takes a token from the bucket of the API key or
+// user of an authenticated caller and from that of their tenant
+func (s *Server) callerRateLimitMiddleware() gin.HandlerFunc {
+	cfg := s.cfg.RateLimit
+	perKey := ratelimit.NewLimit(cfg.KeyRequestsPerSecond, cfg.KeyBurst)
+	perTenant := ratelimit.NewLimit(cfg.TenantRequestsPerSecond, cfg.TenantBurst)
+
+	return s.limitBudgets(func(c *gin.Context) []budget {
+		var budgets []budget
+		p := principal(c)
+		if p.IsAPIKey() {
+			budgets = append(budgets, budget{"key:" + strconv.FormatInt(p.KeyID, 10), perKey})
+		} else if p.UserID != 0 {
+			budgets = append(budgets, budget{"user:" + strconv.FormatInt(p.UserID, 10), perKey})
+		}
+		if tenant := p.Tenant(); tenant != "" {
+			budgets = append(budgets, budget{"tenant:" + tenant, perTenant})
+		}
+		return budgets
+	})
+}
+
+// limitBudgets takes a token from every budget of a request. Requests over
+// any budget get 429; the X-RateLimit headers describe the budget closest to
+// running out across all rate limit middlewares of the request.
+func (s *Server) limitBudgets(budgets func(c *gin.Context) []budget) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.cfg.RateLimit.Enabled || s.deps.Limiter == nil {
+			c.Next()
+			return
+		}
+
+		var tightest *ratelimit.Result
+		if v, ok := c.Get(rateLimitKey); ok {
+			r := v.(ratelimit.Result)
+			tightest = &r
+		}
+
+		for _, b := range budgets(c) {
+			if !b.limit.Enabled() {
+				continue
+			}
+
+			r, err := s.deps.Limiter.Allow(c.Request.Context(), b.key, b.limit)
+			if err != nil {
+				s.log.WithError(err).Warn("Failed to apply rate limit")
+				continue
+			}
+			if !r.Allowed {
+				setRateLimitHeaders(c, r)
+				c.Header("Retry-After", strconv.Itoa(ceilSeconds(r.RetryAfter)))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+				return
+			}
+			if tightest == nil || r.Remaining < tightest.Remaining {
+				tightest = &r
+			}
+		}
+
+		if tightest != nil {
+			c.Set(rateLimitKey, *tightest)
+			setRateLimitHeaders(c, *tightest)
+		}
+		c.Next()
+	}
+}
+
+func setRateLimitHeaders(c *gin.Context, r ratelimit.Result) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(r.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(r.Reset)))
+}
+
+// ceilSeconds rounds a duration up to whole seconds
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// principal returns the authenticated caller of a request
+func principal(c *gin.Context) *auth.Principal {
+	p, _ := c.MustGet(principalKey).(*auth.Principal)
+	return p
+}
+
+// authorize requires the read permission for GET requests and the write
+// permission for every other method
+func (s *Server) authorize(read, write auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		perm := write
+		if c.Request.Method == http.MethodGet {
+			perm = read
+		}
+
+		if !principal(c).Can(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied: " + string(perm)})
+			return
+		}
+		c.Next()
+	}
+}
+
+// scopeClient returns the client a query is restricted to: a tenant's own
+// client regardless of what was requested, otherwise the requested one
+func scopeClient(c *gin.Context, requested string) string {
+	if tenant := principal(c).Tenant(); tenant != "" {
+		return tenant
+	}
+	return requested
+}
+
+// canAccess reports whether the caller may see a record owned by a client.
+// Records of other tenants are answered as not found.
+func canAccess(c *gin.Context, clientID string) bool {
+	tenant := principal(c).Tenant()
+	return tenant == "" || tenant == clientID
+}
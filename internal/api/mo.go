@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/mo"
+)
+
+// inboundRequest is a mobile-originated message posted by an operator gateway
+type inboundRequest struct {
+	Source            string `json:"source" binding:"required"`
+	Destination       string `json:"destination" binding:"required"`
+	Content           string `json:"content"`
+	DataCoding        int    `json:"dataCoding"`
+	OperatorID        string `json:"operator"`
+	UpstreamMessageID string `json:"upstreamMessageId"`
+}
+
+// receiveMO accepts an inbound message and routes it to its consumer
+func (s *Server) receiveMO(c *gin.Context) {
+	var req inboundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg := &models.MOMessage{
+		Source:      req.Source,
+		Destination: req.Destination,
+		Content:     req.Content,
+		DataCoding:  req.DataCoding,
+		Origin:      models.MOOriginHTTP,
+		OperatorID:  req.OperatorID,
+		UpstreamID:  req.UpstreamMessageID,
+	}
+
+	err := s.deps.MO.Receive(c.Request.Context(), msg)
+	if errors.Is(err, mo.ErrDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, mo.ErrInvalidMessage) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, msg)
+}
+
+// listMO returns inbound messages, newest first, optionally filtered by
+// ?source=, ?destination=, ?systemId= and ?status=
+func (s *Server) listMO(c *gin.Context) {
+	filter := db.MOFilter{
+		Source:      c.Query("source"),
+		Destination: c.Query("destination"),
+		SystemID:    c.Query("systemId"),
+		Status:      models.MOStatus(c.Query("status")),
+		Cursor:      c.Query("cursor"),
+	}
+	if l := c.Query("limit"); l != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	messages, next, err := s.deps.DB.ListMO(c.Request.Context(), filter)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":   messages,
+		"nextCursor": next,
+	})
+}
+
+func (s *Server) getMO(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+		return
+	}
+
+	msg, err := s.deps.DB.GetMO(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
+func (s *Server) listMORules(c *gin.Context) {
+	c.JSON(http.StatusOK, s.deps.MO.Rules())
+}
+
+func (s *Server) addMORule(c *gin.Context) {
+	var rule mo.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.deps.MO.AddRule(c.Request.Context(), rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) updateMORule(c *gin.Context) {
+	var rule mo.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.deps.MO.UpdateRule(c.Request.Context(), c.Param("id"), rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+func (s *Server) deleteMORule(c *gin.Context) {
+	id := c.Param("id")
+	if err := s.deps.MO.RemoveRule(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("MO rule %s deleted successfully", id)})
+}
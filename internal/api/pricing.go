@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/pricing"
+)
+
+type priceListRequest struct {
+	ID      string              `json:"id"`
+	Name    string              `json:"name" binding:"required"`
+	Entries []models.PriceEntry `json:"entries"`
+	Tiers   []models.VolumeTier `json:"tiers"`
+}
+
+func (r priceListRequest) priceList() models.PriceList {
+	return models.PriceList{
+		ID:      r.ID,
+		Name:    r.Name,
+		Entries: r.Entries,
+		Tiers:   r.Tiers,
+	}
+}
+
+func (s *Server) listPriceLists(c *gin.Context) {
+	c.JSON(http.StatusOK, s.deps.Pricing.PriceLists())
+}
+
+func (s *Server) createPriceList(c *gin.Context) {
+	var req priceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.deps.Pricing.Create(c.Request.Context(), req.priceList())
+	if err != nil {
+		pricingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) getPriceList(c *gin.Context) {
+	found, err := s.deps.Pricing.PriceList(c.Param("id"))
+	if err != nil {
+		pricingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// updatePriceList replaces the entries and tiers of a price list. Messages
+// that were already rated keep their price.
+func (s *Server) updatePriceList(c *gin.Context) {
+	var req priceListRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.ID = c.Param("id")
+
+	updated, err := s.deps.Pricing.Update(c.Request.Context(), req.priceList())
+	if err != nil {
+		pricingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// getMarginReport returns the revenue, operator cost and margin of messages
+// grouped by customer, destination or operator
+func (s *Server) getMarginReport(c *gin.Context) {
+	filter := db.MarginFilter{
+		GroupBy:  c.DefaultQuery("groupBy", "customer"),
+		ClientID: c.Query("client"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := s.deps.Pricing.MarginReport(c.Request.Context(), filter)
+	if err != nil {
+		pricingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groupBy": filter.GroupBy,
+		"rows":    report,
+	})
+}
+
+// pricingError maps pricing service errors to HTTP statuses
+func pricingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, pricing.ErrUnknownPriceList):
+		c.JSON(http.StatusNotFound, gin.H{"error": "price list not found"})
+	case errors.Is(err, pricing.ErrInvalidPriceList):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, pricing.ErrInvalidReport):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -8,6 +8,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"smsc/internal/auth"
+	"smsc/internal/config"
+	"smsc/internal/core"
+	"smsc/internal/db"
+	"smsc/internal/health"
+	"smsc/internal/models"
+	"smsc/internal/ratelimit"
+	"smsc/internal/services/batch"
+	"smsc/internal/services/billing"
+	"smsc/internal/services/campaign"
+	"smsc/internal/services/cdr"
+	"smsc/internal/services/invoice"
+	"smsc/internal/services/mo"
+	"smsc/internal/services/pricing"
+	"smsc/internal/services/routing"
+	"smsc/internal/services/tenant"
+	"smsc/internal/services/upstream"
+	"smsc/internal/services/webhook"
+	"smsc/pkg/utils"
 )
 
 type Config struct {
@@ -16,36 +35,53 @@ type Config struct {
 	ReadTimeout    time.Duration
 	WriteTimeout   time.Duration
 	MaxHeaderBytes int
+	CORSOrigins    []string
+	RateLimit      config.RateLimitConfig
+}
+
+// Dependencies holds the services exposed through the API
+type Dependencies struct {
+	Auth      *auth.Service
+	Limiter   ratelimit.Limiter
+	DB        *db.Database
+	Batch     *batch.Service
+	Billing   *billing.Service
+	Campaigns *campaign.Service
+	CDRs      *cdr.Service
+	Invoices  *invoice.Service
+	Pipeline  *core.Pipeline
+	MO        *mo.Service
+	Pricing   *pricing.Service
+	Routing   *routing.Service
+	Tenants   *tenant.Service
+	Upstream  *upstream.Gateway
+	Webhooks  *webhook.Service
+	Health    *health.Registry
 }
 
 type Server struct {
 	cfg    Config
+	deps   Dependencies
 	log    *logrus.Logger
 	router *gin.Engine
 	srv    *http.Server
 }
 
-func New(cfg Config, log *logrus.Logger) *Server {
+func New(cfg Config, deps Dependencies, log *logrus.Logger) *Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.RateLimit.TrustedProxies); err != nil {
+		log.WithError(err).Warn("Invalid trusted proxies; client addresses are taken from the connection")
+		router.SetTrustedProxies(nil)
+	}
 	router.Use(gin.Recovery())
+	router.Use(tracingMiddleware())
 
-	// CORS middleware ekle
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-
-		c.Next()
-	})
+	router.Use(corsMiddleware(cfg.CORSOrigins))
 
 	s := &Server{
 		cfg:    cfg,
+		deps:   deps,
 		log:    log,
 		router: router,
 	}
@@ -55,9 +91,6 @@ func New(cfg Config, log *logrus.Logger) *Server {
 }
 
 func (s *Server) Start() error {
-	// Set up routes
-	s.setupRoutes()
-
 	// Configure HTTP server
 	s.srv = &http.Server{
 		Addr:           fmt.Sprintf("%s:%d", s.cfg.Host, s.cfg.Port),
@@ -88,20 +121,136 @@ func (s *Server) Stop(ctx context.Context) error {
 func (s *Server) setupRoutes() {
 	// Health check
 	s.router.GET("/health", s.healthCheck)
-
-	// API v1 routes
-	v1 := s.router.Group("/api/v1")
+	s.router.GET("/health/live", s.livenessCheck)
+	s.router.GET("/health/ready", s.healthCheck)
+
+	// Logging in and operator delivery reports, which are signed, are the
+	// only API routes open without credentials
+	public := s.router.Group("/api/v1", s.requestRateLimitMiddleware())
+	public.POST("/auth/login", s.login)
+	public.POST("/dlr/:operator", s.receiveDeliveryReport)
+
+	// API v1 routes. Each group requires its read permission for GET
+	// requests and its write permission for everything else. The global and
+	// per address budgets are taken before credentials are checked, so that
+	// failed authentications count against them too.
+	v1 := s.router.Group("/api/v1", s.requestRateLimitMiddleware(), s.authMiddleware(), s.callerRateLimitMiddleware())
 	{
+		// Session endpoints, open to every caller
+		authn := v1.Group("/auth")
+		{
+			authn.POST("/refresh", s.refreshToken)
+			authn.GET("/me", s.getPrincipal)
+		}
+
+		// API key endpoints
+		keys := v1.Group("/auth/keys", s.authorize(auth.PermKeysRead, auth.PermKeysWrite))
+		{
+			keys.GET("", s.listAPIKeys)
+			keys.POST("", s.createAPIKey)
+			keys.POST("/:id/rotate", s.rotateAPIKey)
+			keys.DELETE("/:id", s.revokeAPIKey)
+		}
+
+		// User endpoints
+		users := v1.Group("/users", s.authorize(auth.PermUsersRead, auth.PermUsersWrite))
+		{
+			users.GET("/", s.listUsers)
+			users.POST("/", s.createUser)
+			users.PUT("/:id", s.updateUser)
+		}
+
+		// Tenant endpoints
+		tenants := v1.Group("/tenants", s.authorize(auth.PermTenantsRead, auth.PermTenantsWrite))
+		{
+			tenants.GET("/", s.listTenants)
+			tenants.POST("/", s.createTenant)
+			tenants.GET("/:id", s.getTenant)
+			tenants.PUT("/:id", s.updateTenant)
+			tenants.GET("/:id/usage", s.getTenantUsage)
+		}
+
+		// Prepaid balance endpoints
+		balances := v1.Group("/balances", s.authorize(auth.PermBillingRead, auth.PermBillingWrite))
+		{
+			balances.GET("/", s.listBalances)
+			balances.GET("/:client", s.getBalance)
+			balances.POST("/:client/adjustments", s.adjustBalance)
+			balances.GET("/:client/transactions", s.listBalanceTransactions)
+		}
+
+		// Call detail record endpoints
+		cdrs := v1.Group("/cdrs", s.authorize(auth.PermBillingRead, auth.PermBillingWrite))
+		{
+			cdrs.GET("/", s.listCDRs)
+			cdrs.GET("/export", s.exportCDRs)
+		}
+
+		// Usage statement and invoice endpoints
+		invoices := v1.Group("/invoices", s.authorize(auth.PermBillingRead, auth.PermBillingWrite))
+		{
+			invoices.GET("/", s.listInvoices)
+			invoices.POST("/", s.createInvoice)
+			invoices.GET("/usage", s.getUsageStatement)
+			invoices.GET("/:id", s.getInvoice)
+		}
+
+		// Price list and margin report endpoints
+		priceLists := v1.Group("/price-lists", s.authorize(auth.PermPricingRead, auth.PermPricingWrite))
+		{
+			priceLists.GET("/", s.listPriceLists)
+			priceLists.POST("/", s.createPriceList)
+			priceLists.GET("/:id", s.getPriceList)
+			priceLists.PUT("/:id", s.updatePriceList)
+		}
+		v1.GET("/reports/margin", s.authorize(auth.PermPricingRead, auth.PermPricingWrite), s.getMarginReport)
+
 		// Message endpoints
-		messages := v1.Group("/messages")
+		messages := v1.Group("/messages", s.authorize(auth.PermMessagesRead, auth.PermMessagesSend))
 		{
 			messages.POST("/send", s.sendMessage)
 			messages.GET("/status/:id", s.getMessageStatus)
 			messages.GET("/list", s.listMessages)
+			messages.POST("/batch", s.createBatch)
+			messages.GET("/batch/:id", s.getBatch)
+			messages.GET("/batch/:id/recipients", s.listBatchRecipients)
+		}
+
+		// Campaign endpoints
+		campaigns := v1.Group("/campaigns", s.authorize(auth.PermCampaignsRead, auth.PermCampaignsWrite))
+		{
+			campaigns.GET("/", s.listCampaigns)
+			campaigns.POST("/", s.createCampaign)
+			campaigns.GET("/:id", s.getCampaign)
+			campaigns.PUT("/:id", s.updateCampaign)
+			campaigns.POST("/:id/audience", s.addCampaignAudience)
+			campaigns.POST("/:id/actions/:action", s.controlCampaign)
+			campaigns.GET("/:id/stats", s.getCampaignStats)
+		}
+
+		// Webhook delivery log
+		webhooks := v1.Group("/webhooks", s.authorize(auth.PermWebhooksRead, auth.PermWebhooksWrite))
+		{
+			webhooks.GET("/deliveries", s.listWebhookDeliveries)
+			webhooks.GET("/deliveries/:id", s.getWebhookDelivery)
+			webhooks.POST("/deliveries/:id/replay", s.replayWebhookDelivery)
+			webhooks.POST("/replay", s.replayWebhookDeliveries)
+		}
+
+		// Mobile-originated message endpoints
+		inbound := v1.Group("/mo", s.authorize(auth.PermMORead, auth.PermMOWrite))
+		{
+			inbound.POST("/inbound", s.receiveMO)
+			inbound.GET("/messages", s.listMO)
+			inbound.GET("/messages/:id", s.getMO)
+			inbound.GET("/rules", s.listMORules)
+			inbound.POST("/rules", s.addMORule)
+			inbound.PUT("/rules/:id", s.updateMORule)
+			inbound.DELETE("/rules/:id", s.deleteMORule)
 		}
 
 		// Operator endpoints
-		operators := v1.Group("/operators")
+		operators := v1.Group("/operators", s.authorize(auth.PermOperatorsRead, auth.PermOperatorsWrite))
 		{
 			operators.GET("/", s.listOperators)
 			operators.POST("/", s.addOperator)
@@ -110,16 +259,23 @@ func (s *Server) setupRoutes() {
 		}
 
 		// Routing endpoints
-		routing := v1.Group("/routing")
+		routing := v1.Group("/routing", s.authorize(auth.PermRoutingRead, auth.PermRoutingWrite))
 		{
 			routing.GET("/rules", s.listRoutingRules)
 			routing.POST("/rules", s.addRoutingRule)
 			routing.PUT("/rules/:id", s.updateRoutingRule)
 			routing.DELETE("/rules/:id", s.deleteRoutingRule)
+			routing.GET("/plans", s.listRoutePlans)
+			routing.PUT("/plans/:name", s.saveRoutePlan)
+			routing.DELETE("/plans/:name", s.deleteRoutePlan)
+			routing.PUT("/plans/:name/clients/:client", s.assignRoutePlan)
+			routing.POST("/simulate", s.simulateRoute)
+			routing.POST("/portability/import", s.importPortability)
+			routing.GET("/portability/:msisdn", s.lookupPortability)
 		}
 
 		// System endpoints
-		system := v1.Group("/system")
+		system := v1.Group("/system", s.authorize(auth.PermSystemRead, auth.PermSystemRead))
 		{
 			system.GET("/status", s.getSystemStatus)
 			system.GET("/metrics", s.getMetrics)
@@ -129,43 +285,43 @@ func (s *Server) setupRoutes() {
 
 // Handler implementations
 
-func (s *Server) healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
-}
-
-func (s *Server) sendMessage(c *gin.Context) {
-	// TODO: Implement message sending
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
-}
-
-func (s *Server) getMessageStatus(c *gin.Context) {
-	// TODO: Implement message status retrieval
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+func (s *Server) livenessCheck(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
 }
 
-func (s *Server) listMessages(c *gin.Context) {
-	// TODO: Implement message listing
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+// healthCheck answers the public health and readiness probes with the
+// overall status only; component details are served by the system status
+// endpoint to authorized users
+func (s *Server) healthCheck(c *gin.Context) {
+	report := s.deps.Health.Check(c.Request.Context())
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": report.Status})
 }
 
 func (s *Server) listOperators(c *gin.Context) {
-	operators := []map[string]interface{}{
-		{
-			"id":       1,
-			"name":     "Operator 1",
-			"priority": 1,
-			"weight":   100,
-			"maxTps":   1000,
-			"status":   "active",
-		},
-		{
-			"id":       2,
-			"name":     "Operator 2",
-			"priority": 2,
-			"weight":   50,
-			"maxTps":   500,
-			"status":   "active",
-		},
+	operators := make([]map[string]interface{}, 0)
+	for _, op := range s.deps.Routing.Operators() {
+		status := "active"
+		if !op.Active {
+			status = "inactive"
+		} else if op.Load.Saturated {
+			status = "saturated"
+		}
+
+		operators = append(operators, map[string]interface{}{
+			"id":          op.Name,
+			"name":        op.Name,
+			"priority":    op.Priority,
+			"weight":      op.Weight,
+			"maxTps":      op.MaxTPS,
+			"status":      status,
+			"tps":         op.Load.TPS,
+			"inFlight":    op.Load.InFlight,
+			"utilization": op.Load.Utilization,
+		})
 	}
 	c.JSON(http.StatusOK, operators)
 }
@@ -235,31 +391,192 @@ func (s *Server) deleteOperator(c *gin.Context) {
 }
 
 func (s *Server) listRoutingRules(c *gin.Context) {
-	// TODO: Implement routing rule listing
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	rules := s.deps.Routing.Rules()
+	if plan := c.Query("plan"); plan != "" {
+		filtered := make([]routing.Rule, 0, len(rules))
+		for _, rule := range rules {
+			if rule.Plan == plan {
+				filtered = append(filtered, rule)
+			}
+		}
+		rules = filtered
+	}
+	c.JSON(http.StatusOK, rules)
 }
 
 func (s *Server) addRoutingRule(c *gin.Context) {
-	// TODO: Implement routing rule addition
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	var rule routing.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.deps.Routing.AddRule(c.Request.Context(), rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
 }
 
 func (s *Server) updateRoutingRule(c *gin.Context) {
-	// TODO: Implement routing rule update
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	var rule routing.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := s.deps.Routing.UpdateRule(c.Request.Context(), c.Param("id"), rule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
 }
 
 func (s *Server) deleteRoutingRule(c *gin.Context) {
-	// TODO: Implement routing rule deletion
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	id := c.Param("id")
+	if err := s.deps.Routing.RemoveRule(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Routing rule %s deleted successfully", id)})
+}
+
+func (s *Server) listRoutePlans(c *gin.Context) {
+	c.JSON(http.StatusOK, s.deps.Routing.Plans())
+}
+
+func (s *Server) saveRoutePlan(c *gin.Context) {
+	var req struct {
+		DefaultRoute string `json:"defaultRoute"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan := routing.Plan{Name: c.Param("name"), DefaultRoute: req.DefaultRoute}
+	if err := s.deps.Routing.SavePlan(c.Request.Context(), plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+func (s *Server) deleteRoutePlan(c *gin.Context) {
+	name := c.Param("name")
+	if err := s.deps.Routing.RemovePlan(c.Request.Context(), name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Route plan %s deleted successfully", name)})
+}
+
+func (s *Server) assignRoutePlan(c *gin.Context) {
+	name, client := c.Param("name"), c.Param("client")
+	if err := s.deps.Routing.AssignPlan(c.Request.Context(), client, name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"client": client, "plan": name})
+}
+
+func (s *Server) simulateRoute(c *gin.Context) {
+	var req struct {
+		Recipient   string `json:"recipient" binding:"required"`
+		Sender      string `json:"sender"`
+		ClientID    string `json:"clientId"`
+		Content     string `json:"content"`
+		ServiceType string `json:"serviceType"`
+		Priority    *int   `json:"priority"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	msg := models.NewMessage(req.Sender, req.Recipient, req.Content)
+	msg.ClientID = req.ClientID
+	msg.ServiceType = req.ServiceType
+	if req.Priority != nil {
+		msg.Priority = *req.Priority
+	}
+
+	encoding, segments := utils.Segments(req.Content)
+	msg.Encoding = encoding
+	msg.DataCoding = utils.DataCoding(encoding)
+
+	decision, err := s.deps.Routing.Simulate(c.Request.Context(), msg)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"decision": decision,
+		"encoding": encoding,
+		"segments": segments,
+	}
+	if decision.Price != nil {
+		response["totalPrice"] = *decision.Price * float64(segments)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (s *Server) importPortability(c *gin.Context) {
+	full := c.Query("mode") == "full"
+
+	body := c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	stats, err := s.deps.Routing.Portability().Import(body, full)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (s *Server) lookupPortability(c *gin.Context) {
+	msisdn := c.Param("msisdn")
+	network, err := s.deps.Routing.Portability().Resolve(c.Request.Context(), msisdn)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"msisdn":   msisdn,
+		"network":  network,
+		"resolved": network != "",
+	})
 }
 
 func (s *Server) getSystemStatus(c *gin.Context) {
-	// TODO: Implement system status retrieval
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	c.JSON(http.StatusOK, s.deps.Health.Check(c.Request.Context()))
 }
 
 func (s *Server) getMetrics(c *gin.Context) {
-	// TODO: Implement metrics retrieval
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "not implemented"})
+	c.JSON(http.StatusOK, gin.H{
+		"operators": s.deps.Routing.Operators(),
+	})
 } 
\ No newline at end of file
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/tenant"
+)
+
+type tenantRequest struct {
+	ID           string             `json:"id"`
+	Name         string             `json:"name" binding:"required"`
+	SystemIDs    []string           `json:"systemIds"`
+	SenderIDs    []string           `json:"senderIds"`
+	RoutePlan    string             `json:"routePlan"`
+	PriceList    string             `json:"priceList"`
+	Prices       map[string]float64 `json:"prices"`
+	DailyQuota   int64              `json:"dailyQuota"`
+	MonthlyQuota int64              `json:"monthlyQuota"`
+	MaxTPS       int                `json:"maxTps"`
+	Disabled     bool               `json:"disabled"`
+}
+
+func (r tenantRequest) tenant() models.Tenant {
+	return models.Tenant{
+		ID:           r.ID,
+		Name:         r.Name,
+		SystemIDs:    r.SystemIDs,
+		SenderIDs:    r.SenderIDs,
+		RoutePlan:    r.RoutePlan,
+		PriceList:    r.PriceList,
+		Prices:       r.Prices,
+		DailyQuota:   r.DailyQuota,
+		MonthlyQuota: r.MonthlyQuota,
+		MaxTPS:       r.MaxTPS,
+		Disabled:     r.Disabled,
+	}
+}
+
+// listTenants returns the tenants; tenant callers only see their own
+func (s *Server) listTenants(c *gin.Context) {
+	tenants := s.deps.Tenants.Tenants()
+	if own := principal(c).Tenant(); own != "" {
+		scoped := tenants[:0]
+		for _, t := range tenants {
+			if t.ID == own {
+				scoped = append(scoped, t)
+			}
+		}
+		tenants = scoped
+	}
+
+	c.JSON(http.StatusOK, tenants)
+}
+
+func (s *Server) createTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := s.deps.Tenants.Create(c.Request.Context(), req.tenant())
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+func (s *Server) getTenant(c *gin.Context) {
+	id := c.Param("id")
+	if !canAccess(c, id) {
+		tenantError(c, tenant.ErrUnknownTenant)
+		return
+	}
+
+	found, err := s.deps.Tenants.Tenant(id)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, found)
+}
+
+// updateTenant replaces the settings of a tenant. Tenants are disabled
+// rather than deleted, since their messages and accounts refer to them.
+func (s *Server) updateTenant(c *gin.Context) {
+	var req tenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.ID = c.Param("id")
+
+	updated, err := s.deps.Tenants.Update(c.Request.Context(), req.tenant())
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// getTenantUsage returns the message volume of a tenant against its quotas
+func (s *Server) getTenantUsage(c *gin.Context) {
+	id := c.Param("id")
+	if !canAccess(c, id) {
+		tenantError(c, tenant.ErrUnknownTenant)
+		return
+	}
+
+	usage, err := s.deps.Tenants.Usage(c.Request.Context(), id)
+	if err != nil {
+		tenantError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// checkTenant verifies that accounts are only created for clients allowed to
+// use the SMSC and writes an error response otherwise
+func (s *Server) checkTenant(c *gin.Context, clientID string) bool {
+	if clientID == "" {
+		return true
+	}
+	if err := s.deps.Tenants.Check(clientID); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// tenantError maps tenant service errors to HTTP statuses
+func tenantError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, tenant.ErrUnknownTenant):
+		c.JSON(http.StatusNotFound, gin.H{"error": "tenant not found"})
+	case errors.Is(err, tenant.ErrInvalidTenant):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// submitError maps the errors of submitting a message to HTTP statuses:
+// quota errors ask the client to retry later, a prepaid balance that does not
+// cover the message asks for payment, refused tenants and senders are
+// forbidden and anything else means the SMSC cannot take messages right now
+func submitError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, tenant.ErrQuotaExceeded):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, db.ErrInsufficientBalance):
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error()})
+	case errors.Is(err, tenant.ErrUnknownTenant), errors.Is(err, tenant.ErrTenantDisabled),
+		errors.Is(err, tenant.ErrSenderNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	}
+}
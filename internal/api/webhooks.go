@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"smsc/internal/db"
+	"smsc/internal/models"
+)
+
+// listWebhookDeliveries returns the webhook delivery log, newest first,
+// optionally filtered by ?message=, ?client= and ?status=
+func (s *Server) listWebhookDeliveries(c *gin.Context) {
+	filter := db.DeliveryFilter{
+		ClientID: scopeClient(c, c.Query("client")),
+		Status:   models.DeliveryStatus(c.Query("status")),
+		Cursor:   c.Query("cursor"),
+	}
+
+	var err error
+	if m := c.Query("message"); m != "" {
+		if filter.MessageID, err = strconv.ParseInt(m, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message ID"})
+			return
+		}
+	}
+	if l := c.Query("limit"); l != "" {
+		if filter.Limit, err = strconv.Atoi(l); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+	}
+
+	deliveries, next, err := s.deps.DB.ListDeliveries(c.Request.Context(), filter)
+	if errors.Is(err, db.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"nextCursor": next,
+	})
+}
+
+func (s *Server) getWebhookDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery ID"})
+		return
+	}
+
+	delivery, err := s.deps.DB.GetDelivery(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && !canAccess(c, delivery.ClientID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
+
+// replayWebhookDelivery sends a failed delivery again from its first attempt
+func (s *Server) replayWebhookDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery ID"})
+		return
+	}
+
+	delivery, err := s.deps.DB.GetDelivery(c.Request.Context(), id)
+	if errors.Is(err, db.ErrNotFound) || (err == nil && !canAccess(c, delivery.ClientID)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if delivery.Status != models.DeliveryFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "only failed deliveries can be replayed"})
+		return
+	}
+
+	if _, err := s.deps.Webhooks.Replay(c.Request.Context(), id, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"replayed": 1})
+}
+
+// replayWebhookDeliveries sends every failed delivery again, optionally of a
+// single ?client= only
+func (s *Server) replayWebhookDeliveries(c *gin.Context) {
+	n, err := s.deps.Webhooks.Replay(c.Request.Context(), 0, scopeClient(c, c.Query("client")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"replayed": n})
+}
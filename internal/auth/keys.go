@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key so keys are recognizable in headers and
+// secret scanners
+const APIKeyPrefix = "smsc_"
+
+const (
+	keyIDBytes     = 6
+	keySecretBytes = 24
+)
+
+// GenerateAPIKey returns a new API key, its public prefix and its hash. The
+// key has the form smsc_<prefix>_<secret>; only the prefix and hash are kept.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, keyIDBytes)
+	secret := make([]byte, keySecretBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	prefix = hex.EncodeToString(id)
+	key = APIKeyPrefix + prefix + "_" + hex.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the stored hash of an API key. Keys carry enough entropy
+// that a fast hash is safe, and it keeps per-request verification cheap.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a credential looks like an API key
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// apiKeyPrefix extracts the public prefix of an API key
+func apiKeyPrefix(key string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if len(parts) != 2 || len(parts[0]) != keyIDBytes*2 || len(parts[1]) != keySecretBytes*2 {
+		return "", false
+	}
+	return parts[0], true
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"smsc/internal/models"
+)
+
+// ErrInvalidRole is returned for unknown roles and roles that do not fit the
+// client of the account
+var ErrInvalidRole = errors.New("invalid role")
+
+// Permission is an action on a group of API resources
+type Permission string
+
+const (
+	PermMessagesRead   Permission = "messages:read"
+	PermMessagesSend   Permission = "messages:send"
+	PermCampaignsRead  Permission = "campaigns:read"
+	PermCampaignsWrite Permission = "campaigns:write"
+	PermWebhooksRead   Permission = "webhooks:read"
+	PermWebhooksWrite  Permission = "webhooks:write"
+	PermMORead         Permission = "mo:read"
+	PermMOWrite        Permission = "mo:write"
+	PermOperatorsRead  Permission = "operators:read"
+	PermOperatorsWrite Permission = "operators:write"
+	PermRoutingRead    Permission = "routing:read"
+	PermRoutingWrite   Permission = "routing:write"
+	PermSystemRead     Permission = "system:read"
+	PermKeysRead       Permission = "keys:read"
+	PermKeysWrite      Permission = "keys:write"
+	PermUsersRead      Permission = "users:read"
+	PermUsersWrite     Permission = "users:write"
+	PermTenantsRead    Permission = "tenants:read"
+	PermTenantsWrite   Permission = "tenants:write"
+	PermBillingRead    Permission = "billing:read"
+	PermBillingWrite   Permission = "billing:write"
+	PermPricingRead    Permission = "pricing:read"
+	PermPricingWrite   Permission = "pricing:write"
+)
+
+// readPermissions are granted to every staff role
+var readPermissions = []Permission{
+	PermMessagesRead, PermCampaignsRead, PermWebhooksRead, PermMORead, PermOperatorsRead,
+	PermRoutingRead, PermSystemRead, PermKeysRead, PermUsersRead, PermTenantsRead, PermBillingRead,
+	PermPricingRead,
+}
+
+// rolePermissions is the permission set of each role. Admins hold every
+// permission and are not listed.
+var rolePermissions = map[models.Role]map[Permission]bool{
+	models.RoleNOC: permissionSet(readPermissions,
+		PermOperatorsWrite, PermRoutingWrite, PermMOWrite, PermWebhooksWrite, PermCampaignsWrite),
+	models.RoleSupport: permissionSet(readPermissions),
+	models.RoleTenant: permissionSet(nil,
+		PermMessagesRead, PermMessagesSend, PermCampaignsRead, PermCampaignsWrite,
+		PermWebhooksRead, PermWebhooksWrite, PermKeysRead, PermKeysWrite, PermTenantsRead, PermBillingRead),
+}
+
+func permissionSet(base []Permission, extra ...Permission) map[Permission]bool {
+	set := make(map[Permission]bool, len(base)+len(extra))
+	for _, p := range base {
+		set[p] = true
+	}
+	for _, p := range extra {
+		set[p] = true
+	}
+	return set
+}
+
+// Can reports whether the caller holds a permission
+func (p *Principal) Can(perm Permission) bool {
+	if p.Role == models.RoleAdmin {
+		return true
+	}
+	return rolePermissions[p.Role][perm]
+}
+
+// Tenant returns the client ID a tenant caller is confined to, or an empty
+// string for staff, who see every client
+func (p *Principal) Tenant() string {
+	if p.Role != models.RoleTenant {
+		return ""
+	}
+	return p.ClientID
+}
+
+// ValidateRole checks a role and the client of the account it is given to:
+// tenants belong to exactly one client, staff to none
+func ValidateRole(role models.Role, clientID string) error {
+	if !role.Valid() {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	if role == models.RoleTenant && clientID == "" {
+		return fmt.Errorf("%w: tenant accounts need a client ID", ErrInvalidRole)
+	}
+	if role != models.RoleTenant && clientID != "" {
+		return fmt.Errorf("%w: only tenant accounts belong to a client", ErrInvalidRole)
+	}
+	return nil
+}
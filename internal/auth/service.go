@@ -0,0 +1,396 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+)
+
+const (
+	defaultTokenExpiry = 24 * time.Hour
+	defaultKeyGrace    = 24 * time.Hour
+
+	// minAdminPassword is the shortest password the admin user is bootstrapped with
+	minAdminPassword = 12
+)
+
+var (
+	// ErrInvalidCredentials is returned for a failed login
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidAPIKey is returned for unknown, expired and revoked API keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrKeyInactive is returned when rotating an expired or revoked API key
+	ErrKeyInactive = errors.New("API key is expired or revoked")
+)
+
+// knownPasswords are refused for the bootstrapped admin user, whatever their length
+var knownPasswords = map[string]bool{
+	"change-me": true,
+	"changeme":  true,
+	"admin":     true,
+	"password":  true,
+	"secret":    true,
+}
+
+// dummyHash is compared against on logins of unknown users, so that they take
+// as long as logins with a wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("smsc-dummy-password"), bcrypt.DefaultCost)
+
+// Principal is the authenticated caller of an API request
+type Principal struct {
+	Subject  string      `json:"subject"`
+	Role     models.Role `json:"role"`
+	UserID   int64       `json:"userId,omitempty"`
+	ClientID string      `json:"clientId,omitempty"`
+	KeyID    int64       `json:"keyId,omitempty"`
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key
+func (p *Principal) IsAPIKey() bool {
+	return p.KeyID != 0
+}
+
+// Service issues and verifies the credentials of REST API callers: JWTs for
+// users logging in and hashed long-lived API keys for machine clients
+type Service struct {
+	cfg config.SecurityConfig
+	db  *db.Database
+	log *logrus.Logger
+}
+
+func New(cfg config.SecurityConfig, database *db.Database, log *logrus.Logger) *Service {
+	if cfg.TokenExpiry <= 0 {
+		cfg.TokenExpiry = defaultTokenExpiry
+	}
+	if cfg.KeyRotationGrace <= 0 {
+		cfg.KeyRotationGrace = defaultKeyGrace
+	}
+
+	return &Service{
+		cfg: cfg,
+		db:  database,
+		log: log,
+	}
+}
+
+// Bootstrap creates the configured admin user when it does not exist yet. It
+// refuses to create it with a well-known or short password.
+func (s *Service) Bootstrap(ctx context.Context) error {
+	if s.cfg.AdminUser == "" {
+		return nil
+	}
+
+	_, err := s.db.GetUserByUsername(ctx, s.cfg.AdminUser)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+
+	if s.cfg.AdminPassword == "" {
+		s.log.Warnf("Admin user %q does not exist and no admin password is configured", s.cfg.AdminUser)
+		return nil
+	}
+
+	if knownPasswords[strings.ToLower(s.cfg.AdminPassword)] || strings.EqualFold(s.cfg.AdminPassword, s.cfg.AdminUser) {
+		return fmt.Errorf("admin password must not be a well-known password")
+	}
+	if len(s.cfg.AdminPassword) < minAdminPassword {
+		return fmt.Errorf("admin password must be at least %d characters", minAdminPassword)
+	}
+
+	hash, err := HashPassword(s.cfg.AdminPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.db.CreateUser(ctx, &models.User{Username: s.cfg.AdminUser, PasswordHash: hash, Role: models.RoleAdmin}); err != nil {
+		return err
+	}
+
+	s.log.Infof("Created admin user %q", s.cfg.AdminUser)
+	return nil
+}
+
+// Login verifies a username and password and issues a token for the user
+func (s *Service) Login(ctx context.Context, username, password string) (string, time.Time, error) {
+	user, err := s.db.GetUserByUsername(ctx, username)
+	if errors.Is(err, db.ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil || user.Disabled {
+		return "", time.Time{}, ErrInvalidCredentials
+	}
+
+	if err := s.db.TouchUserLogin(ctx, user.ID); err != nil {
+		s.log.WithError(err).Warn("Failed to record user login")
+	}
+
+	return s.Issue(&Principal{Subject: user.Username, Role: user.Role, UserID: user.ID, ClientID: user.ClientID})
+}
+
+// Refresh issues a new token to a logged in user before their token expires.
+// The user is loaded again, so disabled users get no new token and role and
+// client changes apply to it.
+func (s *Service) Refresh(ctx context.Context, p *Principal) (string, time.Time, error) {
+	user, err := s.user(ctx, p.UserID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return s.Issue(&Principal{Subject: user.Username, Role: user.Role, UserID: user.ID, ClientID: user.ClientID})
+}
+
+// Issue signs a new token for an authenticated user
+func (s *Service) Issue(p *Principal) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(s.cfg.TokenExpiry)
+
+	token, err := IssueToken(s.cfg.JWTSecret, Claims{
+		Subject:   p.Subject,
+		Role:      p.Role,
+		UserID:    p.UserID,
+		ClientID:  p.ClientID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// Authenticate verifies a bearer token or API key and returns its caller
+func (s *Service) Authenticate(ctx context.Context, credential string) (*Principal, error) {
+	if IsAPIKey(credential) {
+		return s.authenticateKey(ctx, credential)
+	}
+
+	claims, err := ParseToken(s.cfg.JWTSecret, credential, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens carry the role of the user at login; the current one applies
+	user, err := s.user(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: user.Username, Role: user.Role, UserID: user.ID, ClientID: user.ClientID}, nil
+}
+
+// user returns the user a token was issued to. Deleted and disabled users
+// and users with an invalid role are refused with ErrInvalidToken.
+func (s *Service) user(ctx context.Context, id int64) (*models.User, error) {
+	if id <= 0 {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.db.GetUser(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled || ValidateRole(user.Role, user.ClientID) != nil {
+		return nil, ErrInvalidToken
+	}
+	return user, nil
+}
+
+func (s *Service) authenticateKey(ctx context.Context, key string) (*Principal, error) {
+	prefix, ok := apiKeyPrefix(key)
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	k, err := s.db.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !secureEqual(k.Hash, HashAPIKey(key)) || !k.Active(time.Now()) || ValidateRole(k.Role, k.ClientID) != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.db.TouchAPIKey(ctx, k.ID); err != nil {
+		s.log.WithError(err).Warn("Failed to record API key use")
+	}
+
+	return &Principal{Subject: "key:" + k.Name, Role: k.Role, ClientID: k.ClientID, KeyID: k.ID}, nil
+}
+
+// CreateKey creates an API key and returns it together with the key itself,
+// which is not stored and cannot be shown again. A zero ttl never expires.
+func (s *Service) CreateKey(ctx context.Context, name string, role models.Role, clientID, createdBy string, ttl time.Duration) (*models.APIKey, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("API key name is required")
+	}
+	if err := ValidateRole(role, clientID); err != nil {
+		return nil, "", err
+	}
+
+	secret, prefix, hash, err := GenerateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	k := &models.APIKey{
+		Name:      name,
+		Role:      role,
+		ClientID:  clientID,
+		Prefix:    prefix,
+		Hash:      hash,
+		CreatedBy: createdBy,
+	}
+	if ttl > 0 {
+		expires := time.Now().Add(ttl)
+		k.ExpiresAt = &expires
+	}
+
+	if err := s.db.CreateAPIKey(ctx, k); err != nil {
+		return nil, "", err
+	}
+	return k, secret, nil
+}
+
+// RotateKey replaces an API key with a new one of the same name, role, client
+// and lifetime. The old key keeps working for the rotation grace period so that
+// clients can switch over without downtime.
+func (s *Service) RotateKey(ctx context.Context, id int64, rotatedBy string) (*models.APIKey, string, error) {
+	old, err := s.db.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !old.Active(time.Now()) || old.RotatedTo != nil {
+		return nil, "", ErrKeyInactive
+	}
+
+	var ttl time.Duration
+	if old.ExpiresAt != nil {
+		ttl = old.ExpiresAt.Sub(old.CreatedAt)
+	}
+
+	k, secret, err := s.CreateKey(ctx, old.Name, old.Role, old.ClientID, rotatedBy, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.db.RotateAPIKey(ctx, old.ID, k.ID, time.Now().Add(s.cfg.KeyRotationGrace)); err != nil {
+		return nil, "", err
+	}
+
+	s.log.WithFields(logrus.Fields{"key_id": old.ID, "new_key_id": k.ID}).Info("API key rotated")
+	return k, secret, nil
+}
+
+// RevokeKey disables an API key immediately
+func (s *Service) RevokeKey(ctx context.Context, id int64) error {
+	if err := s.db.RevokeAPIKey(ctx, id); err != nil {
+		return err
+	}
+
+	s.log.WithField("key_id", id).Info("API key revoked")
+	return nil
+}
+
+// Keys returns the API keys, optionally of one client only
+func (s *Service) Keys(ctx context.Context, clientID string) ([]*models.APIKey, error) {
+	return s.db.ListAPIKeys(ctx, clientID)
+}
+
+// Key returns an API key by ID
+func (s *Service) Key(ctx context.Context, id int64) (*models.APIKey, error) {
+	return s.db.GetAPIKey(ctx, id)
+}
+
+// UserUpdate holds the user settings to change; nil fields are kept
+type UserUpdate struct {
+	Password *string
+	Role     *models.Role
+	ClientID *string
+	Disabled *bool
+}
+
+// CreateUser creates a user with the given role
+func (s *Service) CreateUser(ctx context.Context, username, password string, role models.Role, clientID string) (*models.User, error) {
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+	if err := ValidateRole(role, clientID); err != nil {
+		return nil, err
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &models.User{Username: username, PasswordHash: hash, Role: role, ClientID: clientID}
+	if err := s.db.CreateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// UpdateUser changes the password, role, client or state of a user
+func (s *Service) UpdateUser(ctx context.Context, id int64, update UserUpdate) (*models.User, error) {
+	u, err := s.db.GetUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Role != nil {
+		u.Role = *update.Role
+	}
+	if update.ClientID != nil {
+		u.ClientID = *update.ClientID
+	}
+	if update.Disabled != nil {
+		u.Disabled = *update.Disabled
+	}
+	if err := ValidateRole(u.Role, u.ClientID); err != nil {
+		return nil, err
+	}
+	if update.Password != nil {
+		if *update.Password == "" {
+			return nil, fmt.Errorf("password must not be empty")
+		}
+		if u.PasswordHash, err = HashPassword(*update.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.UpdateUser(ctx, u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Users returns the users, optionally of one client only
+func (s *Service) Users(ctx context.Context, clientID string) ([]*models.User, error) {
+	return s.db.ListUsers(ctx, clientID)
+}
+
+// HashPassword returns the bcrypt hash of a password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
@@ -19,6 +19,16 @@ type Config struct {
 	Logging    LoggingConfig    `mapstructure:"logging"`
 	Queue      QueueConfig      `mapstructure:"queue"`
 	RateLimit  RateLimitConfig  `mapstructure:"rate_limiting"`
+	TPS        TPSConfig        `mapstructure:"tps"`
+	Redis      RedisConfig      `mapstructure:"redis"`
+	Tracing    TracingConfig    `mapstructure:"tracing"`
+	Batch      BatchConfig      `mapstructure:"batch"`
+	Webhooks   WebhookConfig    `mapstructure:"webhooks"`
+	MO         MOConfig         `mapstructure:"mo"`
+	Tenants    TenantConfig     `mapstructure:"tenants"`
+	Billing    BillingConfig    `mapstructure:"billing"`
+	CDR        CDRConfig        `mapstructure:"cdr"`
+	Invoices   InvoiceConfig    `mapstructure:"invoices"`
 }
 
 type ServerConfig struct {
@@ -70,10 +80,14 @@ type SCCPConfig struct {
 }
 
 type SecurityConfig struct {
-	JWTSecret   string        `mapstructure:"jwt_secret"`
-	TokenExpiry time.Duration `mapstructure:"token_expiry"`
-	TLSCert     string        `mapstructure:"tls_cert"`
-	TLSKey      string        `mapstructure:"tls_key"`
+	JWTSecret        string        `mapstructure:"jwt_secret"`
+	TokenExpiry      time.Duration `mapstructure:"token_expiry"`
+	TLSCert          string        `mapstructure:"tls_cert"`
+	TLSKey           string        `mapstructure:"tls_key"`
+	AdminUser        string        `mapstructure:"admin_user"` // created on startup when missing
+	AdminPassword    string        `mapstructure:"admin_password"`
+	KeyRotationGrace time.Duration `mapstructure:"key_rotation_grace"` // how long a rotated API key keeps working
+	CORSOrigins      []string      `mapstructure:"cors_origins"`
 }
 
 type RoutingConfig struct {
@@ -81,6 +95,52 @@ type RoutingConfig struct {
 	MaxRetries    int              `mapstructure:"max_retries"`
 	RetryInterval time.Duration    `mapstructure:"retry_interval"`
 	Operators     []OperatorConfig `mapstructure:"operators"`
+	Portability   PortabilityConfig `mapstructure:"portability"`
+	Rules         []RoutingRuleConfig `mapstructure:"rules"`
+	Timezones     map[string]string   `mapstructure:"timezones"`
+	Calendars     map[string][]string `mapstructure:"calendars"`
+	Plans         []RoutePlanConfig   `mapstructure:"plans"`
+}
+
+type RoutePlanConfig struct {
+	Name         string              `mapstructure:"name"`
+	DefaultRoute string              `mapstructure:"default_route"`
+	Clients      []string            `mapstructure:"clients"`
+	Rules        []RoutingRuleConfig `mapstructure:"rules"`
+}
+
+type RoutingRuleConfig struct {
+	Pattern       string   `mapstructure:"pattern"`
+	Network       string   `mapstructure:"network"`
+	Operator      string   `mapstructure:"operator"`
+	Priority      int      `mapstructure:"priority"`
+	Weight        int      `mapstructure:"weight"`
+	Clients       []string `mapstructure:"clients"`
+	SenderType    string   `mapstructure:"sender_type"`
+	SenderPattern string   `mapstructure:"sender_pattern"`
+	ServiceTypes  []string `mapstructure:"service_types"`
+	DataCodings   []int    `mapstructure:"data_codings"`
+	Priorities    []int    `mapstructure:"message_priorities"`
+	Windows       []TimeWindowConfig `mapstructure:"windows"`
+	Timezone      string   `mapstructure:"timezone"`
+	Calendar      string   `mapstructure:"calendar"`
+	Hold          bool     `mapstructure:"hold"`
+}
+
+type TimeWindowConfig struct {
+	Days  []string `mapstructure:"days"`
+	Start string   `mapstructure:"start"`
+	End   string   `mapstructure:"end"`
+}
+
+type PortabilityConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	DumpFile  string        `mapstructure:"dump_file"`
+	CacheTTL  time.Duration `mapstructure:"cache_ttl"`
+	CacheSize int           `mapstructure:"cache_size"`
+	// HLRURL enables HLR lookups of numbers missing from the MNP database
+	HLRURL     string        `mapstructure:"hlr_url"`
+	HLRTimeout time.Duration `mapstructure:"hlr_timeout"`
 }
 
 type OperatorConfig struct {
@@ -88,12 +148,25 @@ type OperatorConfig struct {
 	Priority int    `mapstructure:"priority"`
 	Weight   int    `mapstructure:"weight"`
 	MaxTPS   int    `mapstructure:"max_tps"`
+	Timezone string `mapstructure:"timezone"`
+	Prices   map[string]float64 `mapstructure:"prices"`
+	// SubmitURL is the HTTP gateway messages are submitted to; operators
+	// without one get messages routed to them but not sent
+	SubmitURL string `mapstructure:"submit_url"`
+	Secret    string `mapstructure:"secret"` // signs submits and delivery reports
 }
 
 type MonitoringConfig struct {
 	PrometheusEnabled  bool          `mapstructure:"prometheus_enabled"`
 	MetricsPath       string        `mapstructure:"metrics_path"`
 	CollectionInterval time.Duration `mapstructure:"collection_interval"`
+	Host               string        `mapstructure:"host"`
+	Port               int           `mapstructure:"port"`
+	Username           string        `mapstructure:"username"`
+	Password           string        `mapstructure:"password"`
+	BearerToken        string        `mapstructure:"bearer_token"`
+	TLSCert            string        `mapstructure:"tls_cert"`
+	TLSKey             string        `mapstructure:"tls_key"`
 }
 
 type LoggingConfig struct {
@@ -110,12 +183,135 @@ type QueueConfig struct {
 	Password string `mapstructure:"password"`
 	DB       int    `mapstructure:"db"`
 	PoolSize int    `mapstructure:"pool_size"`
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	HighWater     int           `mapstructure:"high_water"` // ready depth at which bulk producers wait
+}
+
+type BatchConfig struct {
+	MaxRecipients int `mapstructure:"max_recipients"`
+}
+
+type WebhookConfig struct {
+	Enabled     bool                           `mapstructure:"enabled"`
+	Secret      string                         `mapstructure:"secret"` // signs callbacks without a client secret
+	Timeout     time.Duration                  `mapstructure:"timeout"`
+	Workers     int                            `mapstructure:"workers"`
+	MaxAttempts int                            `mapstructure:"max_attempts"`
+	Backoff     time.Duration                  `mapstructure:"backoff"`
+	MaxBackoff  time.Duration                  `mapstructure:"max_backoff"`
+	Clients     map[string]WebhookClientConfig `mapstructure:"clients"`
+}
+
+// WebhookClientConfig is the account-level callback of an API client, used
+// for messages sent without their own callback URL
+type WebhookClientConfig struct {
+	URL    string `mapstructure:"url"`
+	Secret string `mapstructure:"secret"`
+}
+
+// MOConfig controls routing of mobile-originated messages to consumers
+type MOConfig struct {
+	Enabled       bool           `mapstructure:"enabled"`
+	Secret        string         `mapstructure:"secret"` // signs HTTP deliveries
+	Timeout       time.Duration  `mapstructure:"timeout"`
+	Workers       int            `mapstructure:"workers"`
+	RetryInterval time.Duration  `mapstructure:"retry_interval"` // first HTTP retry and offline ESME recheck
+	MaxBackoff    time.Duration  `mapstructure:"max_backoff"`
+	MaxAttempts   int            `mapstructure:"max_attempts"`
+	MaxAge        time.Duration  `mapstructure:"max_age"` // queued messages older than this expire
+	Rules         []MORuleConfig `mapstructure:"rules"`
+}
+
+// MORuleConfig matches inbound messages on their destination and first word
+// and names the consumer they are delivered to
+type MORuleConfig struct {
+	Name      string `mapstructure:"name"`
+	ShortCode string `mapstructure:"short_code"`
+	Number    string `mapstructure:"number"` // destination prefix pattern, e.g. "+4470*"
+	Keyword   string `mapstructure:"keyword"`
+	Priority  int    `mapstructure:"priority"`
+	SystemID  string `mapstructure:"system_id"` // ESME receiving the messages over SMPP
+	URL       string `mapstructure:"url"`
+}
+
+// TenantConfig controls how traffic of clients without a tenant is treated
+type TenantConfig struct {
+	Required bool `mapstructure:"required"` // reject messages of unknown clients
+}
+
+// BillingConfig sets how messages of clients with a prepaid balance are
+// charged. Their price is reserved when they are submitted and charged or
+// refunded once their outcome is known.
+type BillingConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	ChargeOn string   `mapstructure:"charge_on"` // "submit" or "delivery"
+	RefundOn []string `mapstructure:"refund_on"` // final statuses whose charge is refunded
+}
+
+// CDRConfig sets where the call detail records of finished messages are
+// written. Records are always stored in the database; with a directory set
+// they are also appended to one file per day and format.
+type CDRConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Directory string   `mapstructure:"directory"`
+	Formats   []string `mapstructure:"formats"` // "csv" and/or "json"
 }
 
+// InvoiceConfig sets how monthly invoices are issued
+type InvoiceConfig struct {
+	Issuer       string  `mapstructure:"issuer"` // name printed on invoices
+	Currency     string  `mapstructure:"currency"`
+	NumberPrefix string  `mapstructure:"number_prefix"`
+	TaxName      string  `mapstructure:"tax_name"`
+	TaxRate      float64 `mapstructure:"tax_rate"` // percent
+}
+
+// RateLimitConfig sets the token buckets of the REST API: one shared by all
+// requests and one per API key or user and per tenant. A zero rate disables a
+// bucket; a zero burst defaults to one second's worth of requests.
 type RateLimitConfig struct {
-	Enabled           bool `mapstructure:"enabled"`
-	RequestsPerSecond int  `mapstructure:"requests_per_second"`
-	Burst            int  `mapstructure:"burst"`
+	Enabled                 bool   `mapstructure:"enabled"`
+	RequestsPerSecond       int    `mapstructure:"requests_per_second"`
+	Burst                   int    `mapstructure:"burst"`
+	KeyRequestsPerSecond    int    `mapstructure:"key_requests_per_second"`
+	KeyBurst                int    `mapstructure:"key_burst"`
+	TenantRequestsPerSecond int    `mapstructure:"tenant_requests_per_second"`
+	TenantBurst             int    `mapstructure:"tenant_burst"`
+	IPRequestsPerSecond     int    `mapstructure:"ip_requests_per_second"`
+	IPBurst                 int    `mapstructure:"ip_burst"`
+	// TrustedProxies may set the client address through X-Forwarded-For;
+	// without them the IP budget applies to the connecting address
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	Driver                  string `mapstructure:"driver"` // "memory" or "redis" to share budgets between instances
+}
+
+// TPSConfig sets how the TPS limits of operators and clients are shared by
+// the instances of the SMSC. With the redis driver each limit holds across
+// all instances; while Redis is unreachable, or with the memory driver, every
+// instance enforces its share of the limit.
+type TPSConfig struct {
+	Driver    string        `mapstructure:"driver"`    // "memory" or "redis"
+	Instances int           `mapstructure:"instances"` // instances sharing the limits
+	Lease     time.Duration `mapstructure:"lease"`     // how long tokens taken from Redis may be used locally
+}
+
+// RedisConfig is the Redis server shared state is kept in
+type RedisConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+}
+
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	FilePath    string  `mapstructure:"file_path"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+	ServiceName string  `mapstructure:"service_name"`
 }
 
 // Load loads the configuration from a file
@@ -131,6 +327,11 @@ func Load(configFile string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// The metrics listener binds to the server host unless configured otherwise
+	if config.Monitoring.Host == "" {
+		config.Monitoring.Host = config.Server.Host
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,492 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/monitoring"
+	"smsc/internal/services/queue"
+	"smsc/internal/services/routing"
+	"smsc/internal/tracing"
+	"smsc/pkg/utils"
+)
+
+const (
+	// instanceTTL is how long the queued messages of an instance stay its own
+	// after it last renewed its lease
+	instanceTTL = 90 * time.Second
+	// recoverInterval is how often messages of stopped instances are claimed
+	recoverInterval = 30 * time.Second
+	// recoverBatch is the number of messages claimed at a time
+	recoverBatch = 500
+)
+
+// StatusListener is notified after the stored status of a message changed
+type StatusListener func(ctx context.Context, messageID int64, status models.MessageStatus)
+
+// Admission decides whether a new message is accepted. It may adjust the
+// message, e.g. to set its price, before it is stored.
+type Admission func(ctx context.Context, msg *models.Message) error
+
+// Submitter sends a routed message over an upstream bind of the operator and
+// returns the ID the operator assigned to it. Delivery receipts for that ID
+// are passed to Pipeline.DeliveryReport. It returns ErrNoUpstream for
+// operators it cannot reach at all.
+type Submitter func(ctx context.Context, operatorID string, msg *models.Message) (string, error)
+
+// ErrNoUpstream is returned by a Submitter for operators without an upstream
+var ErrNoUpstream = errors.New("operator has no upstream")
+
+// Pipeline moves queued messages through routing towards the operators
+type Pipeline struct {
+	db         *db.Database
+	queue      *queue.Service
+	routing    *routing.Service
+	monitoring *monitoring.Service
+	log        *logrus.Logger
+	submit     Submitter
+	admissions []Admission
+	listeners  []StatusListener
+	mu         sync.Mutex
+	active     bool
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewPipeline creates a message pipeline on top of the routing service
+func NewPipeline(database *db.Database, queueService *queue.Service, routingService *routing.Service, monitoringService *monitoring.Service, log *logrus.Logger) *Pipeline {
+	return &Pipeline{
+		db:         database,
+		queue:      queueService,
+		routing:    routingService,
+		monitoring: monitoringService,
+		log:        log,
+	}
+}
+
+// AddStatusListener registers a listener for message status changes. It must
+// be called before messages start flowing.
+func (p *Pipeline) AddStatusListener(l StatusListener) {
+	p.listeners = append(p.listeners, l)
+}
+
+// SetSubmitter sets how routed messages are sent to the operators. Without a
+// submitter, or for operators it has no upstream for, messages end in the
+// routed status. It must be called before messages start flowing.
+func (p *Pipeline) SetSubmitter(submit Submitter) {
+	p.submit = submit
+}
+
+// AddAdmission registers a check new messages must pass before they are
+// stored. Checks run in the order they were added. It must be called before
+// messages start flowing.
+func (p *Pipeline) AddAdmission(a Admission) {
+	p.admissions = append(p.admissions, a)
+}
+
+// Submit stores a new message and queues it for delivery. Scheduled messages
+// stay on the delayed queue until their scheduled time. Messages refused by
+// an admission check are not stored and its error is returned unchanged, as
+// is db.ErrInsufficientBalance when their charge cannot be reserved.
+func (p *Pipeline) Submit(ctx context.Context, msg *models.Message) error {
+	for _, admit := range p.admissions {
+		if err := admit(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	msg.Status = models.StatusPending
+	if msg.ScheduledTime != nil && msg.ScheduledTime.After(time.Now()) {
+		msg.Status = models.StatusScheduled
+	}
+
+	if err := p.db.InsertMessage(ctx, msg); err != nil {
+		return err
+	}
+
+	queued := fromModel(msg)
+	p.record(ctx, queued, models.EventReceived, "")
+
+	if err := p.queue.QueueMessage(ctx, queued); err != nil {
+		p.setStatus(ctx, queued, models.StatusFailed, err.Error())
+		p.record(ctx, queued, models.EventFailed, err.Error())
+		return fmt.Errorf("failed to queue message: %w", err)
+	}
+
+	detail := fmt.Sprintf("priority %d", queued.Priority)
+	if msg.Status == models.StatusScheduled {
+		detail = "scheduled for " + msg.ScheduledTime.Format(time.RFC3339)
+	}
+	p.record(ctx, queued, models.EventQueued, detail)
+	return nil
+}
+
+// Start keeps this instance marked as running and claims the queued messages
+// of instances that stopped, including this process before a restart, since
+// the queue only holds them in memory. It must be called once the queue runs.
+func (p *Pipeline) Start(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.active {
+		return fmt.Errorf("pipeline is already running")
+	}
+
+	// Without a live lease the messages stored from now on could be claimed
+	if err := p.db.KeepAlive(ctx, instanceTTL); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+
+	p.wg.Add(2)
+	go p.keepAlive(ctx)
+	go p.recoverLoop(ctx)
+
+	p.active = true
+	p.log.Info("Message pipeline started")
+	return nil
+}
+
+// Stop stops claiming messages and marks this instance as stopped, so that
+// the other instances take over the messages still queued here
+func (p *Pipeline) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.active {
+		p.mu.Unlock()
+		return nil
+	}
+	p.active = false
+	p.cancel()
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop pipeline: %w", ctx.Err())
+	}
+
+	if err := p.db.Retire(ctx); err != nil {
+		return err
+	}
+	p.log.Info("Message pipeline stopped")
+	return nil
+}
+
+// keepAlive renews the lease that keeps this instance's queued messages its own
+func (p *Pipeline) keepAlive(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(instanceTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.db.KeepAlive(ctx, instanceTTL); err != nil && ctx.Err() == nil {
+				p.log.WithError(err).Error("Failed to renew instance lease")
+			}
+		}
+	}
+}
+
+// recoverLoop claims orphaned messages at start and then periodically
+func (p *Pipeline) recoverLoop(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(recoverInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := p.Recover(ctx)
+		if err != nil && ctx.Err() == nil {
+			p.log.WithError(err).Error("Failed to recover queued messages")
+		}
+		if n > 0 {
+			p.log.WithField("messages", n).Info("Recovered queued messages")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Recover queues the pending and scheduled messages of instances that are no
+// longer running, a page at a time, waiting for queue capacity between pages.
+// Their charges stay reserved until they reach a final status. It returns the
+// number of recovered messages.
+func (p *Pipeline) Recover(ctx context.Context) (int, error) {
+	var (
+		recovered int
+		afterID   int64
+	)
+	for {
+		if err := p.queue.WaitCapacity(ctx); err != nil {
+			return recovered, err
+		}
+
+		messages, err := p.db.ClaimQueuedMessages(ctx, afterID, recoverBatch)
+		if err != nil {
+			return recovered, err
+		}
+
+		for _, m := range messages {
+			afterID = m.ID
+			queued := fromModel(m)
+			queued.Attempts = m.RetryCount
+			if err := p.queue.QueueMessage(ctx, queued); err != nil {
+				p.setStatus(ctx, queued, models.StatusFailed, err.Error())
+				p.record(ctx, queued, models.EventFailed, err.Error())
+				continue
+			}
+			p.record(ctx, queued, models.EventQueued, "recovered")
+			recovered++
+		}
+
+		if len(messages) < recoverBatch {
+			return recovered, nil
+		}
+	}
+}
+
+// Process routes a message taken off the queue. Routing hold and throttle
+// errors are wrapped so the queue can hold the message until its window
+// closes or the operator's TPS budget refills.
+func (p *Pipeline) Process(ctx context.Context, msg *queue.Message) error {
+	if !msg.ExpiresAt.IsZero() && time.Now().After(msg.ExpiresAt) {
+		p.setStatus(ctx, msg, models.StatusExpired, "validity period expired")
+		p.record(ctx, msg, models.EventDropped, "validity period expired")
+		return nil
+	}
+
+	if msg.Attempts > 0 {
+		p.record(ctx, msg, models.EventRetried, fmt.Sprintf("attempt %d", msg.Attempts+1))
+	}
+
+	operatorID, err := p.routing.RouteMessage(ctx, toModel(msg))
+	if err != nil {
+		var hold *routing.HoldError
+		var throttle *routing.ThrottleError
+		switch {
+		case errors.As(err, &hold):
+			p.record(ctx, msg, models.EventHeld, hold.Error())
+		case errors.As(err, &throttle):
+			// Held for a moment only; not worth an event on the timeline
+		default:
+			p.record(ctx, msg, models.EventFailed, err.Error())
+		}
+		return fmt.Errorf("failed to route message: %w", err)
+	}
+
+	msg.OperatorID = operatorID
+	p.log.WithFields(logrus.Fields{
+		"message_id": msg.ID,
+		"operator":   operatorID,
+	}).Debug("Message routed")
+	p.record(ctx, msg, models.EventRouted, "operator "+operatorID)
+	p.setCost(ctx, msg)
+
+	if p.submit == nil {
+		p.routedOnly(ctx, msg)
+		return nil
+	}
+	return p.submitTo(ctx, msg, operatorID)
+}
+
+// routedOnly ends a message nothing can send in the routed status, which is
+// final: its charge is settled and its CDR written like for a sent message
+func (p *Pipeline) routedOnly(ctx context.Context, msg *queue.Message) {
+	p.setStatus(ctx, msg, models.StatusRouted, "")
+}
+
+// submitTo sends a routed message to its operator. Failed submits are
+// returned so the queue retries them; the message only counts as sent once
+// the operator accepted it. Operator load is recorded here, so it needs a
+// submitter; a submit to an operator without an upstream counts as load even
+// though the message ends routed.
+func (p *Pipeline) submitTo(ctx context.Context, msg *queue.Message, operatorID string) error {
+	ctx, span := tracing.StartMessage(ctx, "operator.submit", msg.ID, attribute.String("smsc.operator", operatorID))
+	defer span.End()
+
+	p.routing.BeginSubmit(operatorID)
+	upstreamID, err := p.submit(ctx, operatorID, toModel(msg))
+	p.routing.EndSubmit(operatorID)
+	if errors.Is(err, ErrNoUpstream) {
+		p.routedOnly(ctx, msg)
+		return nil
+	}
+	if err != nil {
+		p.record(ctx, msg, models.EventFailed, err.Error())
+		return fmt.Errorf("failed to submit message: %w", err)
+	}
+
+	if id, ok := storedID(msg); ok && p.db != nil && upstreamID != "" {
+		if err := p.db.SetMessageUpstreamID(ctx, id, upstreamID); err != nil {
+			p.log.WithError(err).WithField("message_id", msg.ID).Warn("Failed to set upstream message ID")
+		}
+	}
+
+	p.monitoring.MessageSubmitted(msg.ClientID, operatorID)
+	p.setStatus(ctx, msg, models.StatusSent, "")
+	p.record(ctx, msg, models.EventSubmitted, "operator "+operatorID)
+	return nil
+}
+
+// Drop marks a message the queue gave up on as failed
+func (p *Pipeline) Drop(ctx context.Context, msg *queue.Message, err error) {
+	p.monitoring.MessageFailed(msg.ClientID, msg.OperatorID)
+	p.setStatus(ctx, msg, models.StatusFailed, err.Error())
+	p.record(ctx, msg, models.EventDropped, err.Error())
+}
+
+// DeliveryReport applies a delivery receipt from an operator to the message
+// submitted to it under upstreamID. Receipts for messages of other operators
+// fail with db.ErrNotFound.
+func (p *Pipeline) DeliveryReport(ctx context.Context, operatorID, upstreamID string, status models.MessageStatus, report string) error {
+	switch status {
+	case models.StatusDelivered, models.StatusFailed, models.StatusExpired, models.StatusRejected:
+	default:
+		return fmt.Errorf("invalid delivery report status: %s", status)
+	}
+
+	msg, err := p.db.GetMessageByUpstreamID(ctx, upstreamID)
+	if err == nil && msg.OperatorID != operatorID {
+		err = db.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find message for delivery report: %w", err)
+	}
+
+	if err := p.db.RecordDeliveryReport(ctx, msg.ID, status, report); err != nil {
+		return err
+	}
+
+	if status == models.StatusDelivered {
+		var latency time.Duration
+		if msg.SentAt != nil {
+			latency = time.Since(*msg.SentAt)
+		}
+		p.monitoring.MessageDelivered(msg.ClientID, msg.OperatorID, latency)
+	} else {
+		p.monitoring.MessageFailed(msg.ClientID, msg.OperatorID)
+	}
+
+	if err := p.db.AddMessageEvent(ctx, msg.ID, models.EventDLR, string(status)); err != nil {
+		p.log.WithError(err).WithField("message_id", msg.ID).Warn("Failed to record message event")
+	}
+	p.notify(ctx, msg.ID, status)
+	return nil
+}
+
+// record appends an event to the timeline of a stored message. Messages
+// without a stored record are skipped; failures are logged, not returned, so
+// they never hold up delivery.
+func (p *Pipeline) record(ctx context.Context, msg *queue.Message, event models.EventType, detail string) {
+	id, ok := storedID(msg)
+	if !ok || p.db == nil {
+		return
+	}
+	if err := p.db.AddMessageEvent(ctx, id, event, detail); err != nil {
+		p.log.WithError(err).WithField("message_id", msg.ID).Warn("Failed to record message event")
+	}
+}
+
+// setStatus updates the stored status of a message
+func (p *Pipeline) setStatus(ctx context.Context, msg *queue.Message, status models.MessageStatus, lastError string) {
+	id, ok := storedID(msg)
+	if !ok || p.db == nil {
+		return
+	}
+	if err := p.db.UpdateMessageStatus(ctx, id, status, msg.OperatorID, lastError); err != nil {
+		p.log.WithError(err).WithField("message_id", msg.ID).Warn("Failed to update message status")
+		return
+	}
+	p.notify(ctx, id, status)
+}
+
+// setCost stores what the routed operator charges for a message, so margins
+// can be reported against the price charged to the client
+func (p *Pipeline) setCost(ctx context.Context, msg *queue.Message) {
+	id, ok := storedID(msg)
+	if !ok || p.db == nil {
+		return
+	}
+	price, ok := p.routing.OperatorPrice(msg.OperatorID, msg.Recipient)
+	if !ok {
+		return
+	}
+	_, segments := utils.Segments(msg.Content)
+	if err := p.db.SetMessageCost(ctx, id, price*float64(segments)); err != nil {
+		p.log.WithError(err).WithField("message_id", msg.ID).Warn("Failed to set message cost")
+	}
+}
+
+// notify passes a status change to the registered listeners
+func (p *Pipeline) notify(ctx context.Context, id int64, status models.MessageStatus) {
+	for _, l := range p.listeners {
+		l(ctx, id, status)
+	}
+}
+
+// storedID returns the database ID of a queued message
+func storedID(msg *queue.Message) (int64, bool) {
+	id, err := strconv.ParseInt(msg.ID, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// fromModel converts a stored message to its queue entry
+func fromModel(m *models.Message) *queue.Message {
+	msg := &queue.Message{
+		ID:          strconv.FormatInt(m.ID, 10),
+		Sender:      m.Sender,
+		Recipient:   m.Recipient,
+		Content:     m.Content,
+		Priority:    m.Priority,
+		ClientID:    m.ClientID,
+		ServiceType: m.ServiceType,
+		DataCoding:  m.DataCoding,
+	}
+	start := m.CreatedAt
+	if m.ScheduledTime != nil {
+		msg.ScheduledAt = *m.ScheduledTime
+		if m.ScheduledTime.After(start) {
+			start = *m.ScheduledTime
+		}
+	}
+	if m.ValidityPeriod > 0 {
+		msg.ExpiresAt = start.Add(m.ValidityPeriod)
+	}
+	return msg
+}
+
+// toModel converts a queued message to the model routing decisions are made on
+func toModel(msg *queue.Message) *models.Message {
+	m := models.NewMessage(msg.Sender, msg.Recipient, msg.Content)
+	m.MessageID = msg.ID
+	m.Priority = msg.Priority
+	m.ClientID = msg.ClientID
+	m.ServiceType = msg.ServiceType
+	m.DataCoding = msg.DataCoding
+	m.RetryCount = msg.Attempts
+	return m
+}
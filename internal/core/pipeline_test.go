@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/models"
+	"smsc/internal/services/monitoring"
+	"smsc/internal/services/queue"
+	"smsc/internal/services/routing"
+)
+
+func newTestPipeline(t *testing.T) (*Pipeline, *routing.Service) {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	rs := routing.New(config.RoutingConfig{
+		Operators: []config.OperatorConfig{{Name: "op1", Priority: 1, Weight: 1, MaxTPS: 100}},
+	}, log)
+	if err := rs.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start routing: %v", err)
+	}
+	return NewPipeline(nil, nil, rs, monitoring.New(config.MonitoringConfig{}, log), log), rs
+}
+
+func testMessage(id string) *queue.Message {
+	return &queue.Message{ID: id, Sender: "SMSC", Recipient: "447700900123", Content: "hello"}
+}
+
+func TestProcessTracksOperatorLoad(t *testing.T) {
+	p, rs := newTestPipeline(t)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	p.SetSubmitter(func(ctx context.Context, operatorID string, msg *models.Message) (string, error) {
+		close(entered)
+		<-release
+		return "up-1", nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- p.Process(context.Background(), testMessage("q1")) }()
+
+	<-entered
+	load, err := rs.OperatorLoad("op1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load.InFlight != 1 {
+		t.Errorf("in flight during submit = %d, want 1", load.InFlight)
+	}
+
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Process: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Process did not return")
+	}
+
+	load, _ = rs.OperatorLoad("op1")
+	if load.InFlight != 0 {
+		t.Errorf("in flight after submit = %d, want 0", load.InFlight)
+	}
+	if load.TPS <= 0 {
+		t.Errorf("TPS after submit = %v, want > 0", load.TPS)
+	}
+}
+
+func TestProcessReleasesLoadOnFailedSubmit(t *testing.T) {
+	p, rs := newTestPipeline(t)
+	p.SetSubmitter(func(ctx context.Context, operatorID string, msg *models.Message) (string, error) {
+		return "", errors.New("bind down")
+	})
+
+	if err := p.Process(context.Background(), testMessage("q1")); err == nil {
+		t.Fatal("expected the failed submit to be returned")
+	}
+	if load, _ := rs.OperatorLoad("op1"); load.InFlight != 0 {
+		t.Errorf("in flight after failed submit = %d, want 0", load.InFlight)
+	}
+}
+
+func TestProcessWithoutSubmitterDoesNotSubmit(t *testing.T) {
+	p, rs := newTestPipeline(t)
+
+	if err := p.Process(context.Background(), testMessage("q1")); err != nil {
+		t.Fatalf("Process: %v", err)
+	}
+	if load, _ := rs.OperatorLoad("op1"); load.TPS != 0 || load.InFlight != 0 {
+		t.Errorf("load without a submit = %+v, want idle", load)
+	}
+}
+
+func TestProcessWithoutUpstreamEndsRouted(t *testing.T) {
+	p, _ := newTestPipeline(t)
+	p.SetSubmitter(func(ctx context.Context, operatorID string, msg *models.Message) (string, error) {
+		return "", ErrNoUpstream
+	})
+
+	if err := p.Process(context.Background(), testMessage("q1")); err != nil {
+		t.Fatalf("Process without an upstream = %v, want the message to end routed", err)
+	}
+}
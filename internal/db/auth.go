@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"smsc/internal/models"
+)
+
+const userColumns = `id, username, password_hash, role, client_id, disabled, created_at, last_login_at`
+
+const apiKeyColumns = `id, name, role, client_id, prefix, hash, created_by, rotated_to, created_at,
+	expires_at, last_used_at, revoked_at`
+
+// apiKeyTouchInterval limits how often the last use of an API key is written
+const apiKeyTouchInterval = time.Minute
+
+// CreateUser stores a new user and sets its ID
+func (d *Database) CreateUser(ctx context.Context, u *models.User) error {
+	err := d.db.QueryRowContext(ctx, `INSERT INTO users (username, password_hash, role, client_id, disabled)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		u.Username, u.PasswordHash, u.Role, u.ClientID, u.Disabled,
+	).Scan(&u.ID, &u.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// UpdateUser stores the password, role, client and state of a user
+func (d *Database) UpdateUser(ctx context.Context, u *models.User) error {
+	res, err := d.db.ExecContext(ctx, `UPDATE users SET
+			password_hash = $2, role = $3, client_id = $4, disabled = $5
+		WHERE id = $1`,
+		u.ID, u.PasswordHash, u.Role, u.ClientID, u.Disabled)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// GetUser returns a user by ID
+func (d *Database) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	u, err := scanUser(d.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return u, nil
+}
+
+// GetUserByUsername returns a user by username
+func (d *Database) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	u, err := scanUser(d.db.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return u, nil
+}
+
+// ListUsers returns users ordered by username, optionally of one client only
+func (d *Database) ListUsers(ctx context.Context, clientID string) ([]*models.User, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users
+		WHERE ($1 = '' OR client_id = $1)
+		ORDER BY username`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
+
+// TouchUserLogin records a successful login
+func (d *Database) TouchUserLogin(ctx context.Context, id int64) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE users SET last_login_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user login: %w", err)
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key and sets its ID
+func (d *Database) CreateAPIKey(ctx context.Context, k *models.APIKey) error {
+	err := d.db.QueryRowContext(ctx, `INSERT INTO api_keys (name, role, client_id, prefix, hash, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		k.Name, k.Role, k.ClientID, k.Prefix, k.Hash, k.CreatedBy, k.ExpiresAt,
+	).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey returns an API key by ID
+func (d *Database) GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	k, err := scanAPIKey(d.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return k, nil
+}
+
+// GetAPIKeyByPrefix returns the API key with the given public prefix
+func (d *Database) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	k, err := scanAPIKey(d.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = $1`, prefix))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return k, nil
+}
+
+// ListAPIKeys returns API keys, newest first, optionally of one client only
+func (d *Database) ListAPIKeys(ctx context.Context, clientID string) ([]*models.APIKey, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE ($1 = '' OR client_id = $1)
+		ORDER BY id DESC`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]*models.APIKey, 0)
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RotateAPIKey links a key to its replacement and makes it expire at the
+// given time, unless it already expires earlier
+func (d *Database) RotateAPIKey(ctx context.Context, id, replacement int64, expiresAt time.Time) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE api_keys SET rotated_to = $2,
+			expires_at = CASE WHEN expires_at IS NULL OR expires_at > $3 THEN $3 ELSE expires_at END
+		WHERE id = $1`,
+		id, replacement, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to rotate API key: %w", err)
+	}
+	return nil
+}
+
+// RevokeAPIKey disables an API key immediately
+func (d *Database) RevokeAPIKey(ctx context.Context, id int64) error {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TouchAPIKey records the use of an API key, at most once per minute
+func (d *Database) TouchAPIKey(ctx context.Context, id int64) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`,
+		id, time.Now().Add(-apiKeyTouchInterval))
+	if err != nil {
+		return fmt.Errorf("failed to update API key use: %w", err)
+	}
+	return nil
+}
+
+func scanUser(row scanner) (*models.User, error) {
+	var u models.User
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.ClientID, &u.Disabled, &u.CreatedAt, &u.LastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var k models.APIKey
+	err := row.Scan(&k.ID, &k.Name, &k.Role, &k.ClientID, &k.Prefix, &k.Hash, &k.CreatedBy, &k.RotatedTo, &k.CreatedAt,
+		&k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"smsc/internal/models"
+)
+
+// ErrInsufficientBalance is returned when a prepaid balance does not cover a charge
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+const balanceColumns = `client_id, available, reserved, updated_at`
+
+const transactionColumns = `id, client_id, type, amount, available, message_id, note, created_at`
+
+// GetBalance returns the prepaid balance of a client
+func (d *Database) GetBalance(ctx context.Context, clientID string) (*models.Balance, error) {
+	b, err := scanBalance(d.db.QueryRowContext(ctx, `SELECT `+balanceColumns+` FROM balances WHERE client_id = $1`, clientID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+	return b, nil
+}
+
+// ListBalances returns every prepaid balance ordered by client ID
+func (d *Database) ListBalances(ctx context.Context) ([]*models.Balance, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+balanceColumns+` FROM balances ORDER BY client_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list balances: %w", err)
+	}
+	defer rows.Close()
+
+	balances := make([]*models.Balance, 0)
+	for rows.Next() {
+		b, err := scanBalance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		balances = append(balances, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list balances: %w", err)
+	}
+	return balances, nil
+}
+
+// AdjustBalance adds an amount to the available balance of a client, opening
+// the prepaid account if it does not exist. Negative amounts may not take the
+// balance below zero.
+func (d *Database) AdjustBalance(ctx context.Context, clientID string, amount float64, note string) (*models.Balance, error) {
+	var b *models.Balance
+	err := d.Transaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		b, err = scanBalance(tx.QueryRowContext(ctx, `INSERT INTO balances (client_id, available) VALUES ($1, $2)
+			ON CONFLICT (client_id) DO UPDATE SET
+				available = balances.available + EXCLUDED.available,
+				updated_at = CURRENT_TIMESTAMP
+			RETURNING `+balanceColumns,
+			clientID, amount,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to adjust balance: %w", err)
+		}
+		if b.Available < 0 {
+			return ErrInsufficientBalance
+		}
+
+		kind := models.TransactionTopUp
+		if amount < 0 {
+			kind = models.TransactionAdjustment
+		}
+		return addTransaction(ctx, tx, &models.BalanceTransaction{
+			ClientID:  clientID,
+			Type:      kind,
+			Amount:    amount,
+			Available: b.Available,
+			Note:      note,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// BalanceTransactions returns the ledger of a prepaid account, newest first,
+// and the cursor of the next page or an empty string on the last page
+func (d *Database) BalanceTransactions(ctx context.Context, clientID string, limit int, cursor string) ([]*models.BalanceTransaction, string, error) {
+	args := []interface{}{clientID}
+	query := `SELECT ` + transactionColumns + ` FROM balance_transactions WHERE client_id = $1`
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, after)
+		query += ` AND id < $2`
+	}
+
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT %d`, limit+1)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list balance transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := make([]*models.BalanceTransaction, 0, limit)
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan balance transaction: %w", err)
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list balance transactions: %w", err)
+	}
+
+	next := ""
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		next = encodeCursor(transactions[limit-1].ID)
+	}
+	return transactions, next, nil
+}
+
+// ChargeMessage commits the reserved charge of a message. It reports false
+// when the message has no reserved charge, so settling twice has no effect.
+func (d *Database) ChargeMessage(ctx context.Context, id int64) (bool, error) {
+	settled := false
+	err := d.Transaction(ctx, func(tx *sql.Tx) error {
+		var (
+			clientID string
+			price    float64
+		)
+		err := tx.QueryRowContext(ctx, `UPDATE messages SET billing_info = $2
+			WHERE id = $1 AND billing_info = $3
+			RETURNING client_id, price`,
+			id, models.ChargeCharged, models.ChargeReserved,
+		).Scan(&clientID, &price)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to charge message: %w", err)
+		}
+
+		var available float64
+		err = tx.QueryRowContext(ctx, `UPDATE balances SET reserved = reserved - $2, updated_at = CURRENT_TIMESTAMP
+			WHERE client_id = $1
+			RETURNING available`,
+			clientID, price,
+		).Scan(&available)
+		if err != nil {
+			return fmt.Errorf("failed to charge message: %w", err)
+		}
+
+		settled = true
+		return addTransaction(ctx, tx, &models.BalanceTransaction{
+			ClientID:  clientID,
+			Type:      models.TransactionCharge,
+			Amount:    -price,
+			Available: available,
+			MessageID: &id,
+		})
+	})
+	return settled, err
+}
+
+// RefundMessage returns the reserved or committed charge of a message to the
+// available balance. It reports false when the message has no charge to
+// refund, so settling twice has no effect.
+func (d *Database) RefundMessage(ctx context.Context, id int64) (bool, error) {
+	settled := false
+	err := d.Transaction(ctx, func(tx *sql.Tx) error {
+		var (
+			clientID string
+			price    float64
+			state    string
+		)
+		err := tx.QueryRowContext(ctx, `WITH old AS (
+				SELECT id, billing_info FROM messages WHERE id = $1 AND billing_info IN ($3, $4) FOR UPDATE
+			)
+			UPDATE messages m SET billing_info = $2 FROM old
+			WHERE m.id = old.id
+			RETURNING m.client_id, m.price, old.billing_info`,
+			id, models.ChargeRefunded, models.ChargeReserved, models.ChargeCharged,
+		).Scan(&clientID, &price, &state)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to refund message: %w", err)
+		}
+
+		// Reserved charges are still held; committed ones were settled already
+		held := 0.0
+		if state == models.ChargeReserved {
+			held = price
+		}
+
+		var available float64
+		err = tx.QueryRowContext(ctx, `UPDATE balances SET
+				available = available + $2,
+				reserved = reserved - $3,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE client_id = $1
+			RETURNING available`,
+			clientID, price, held,
+		).Scan(&available)
+		if err != nil {
+			return fmt.Errorf("failed to refund message: %w", err)
+		}
+
+		settled = true
+		return addTransaction(ctx, tx, &models.BalanceTransaction{
+			ClientID:  clientID,
+			Type:      models.TransactionRefund,
+			Amount:    price,
+			Available: available,
+			MessageID: &id,
+		})
+	})
+	return settled, err
+}
+
+// reserve moves an amount from the available to the reserved balance of a
+// client and returns the available balance left. It returns ErrNotFound for
+// clients without a prepaid account.
+func reserve(ctx context.Context, tx *sql.Tx, clientID string, amount float64) (float64, error) {
+	var available float64
+	err := tx.QueryRowContext(ctx, `UPDATE balances SET
+			available = available - $2,
+			reserved = reserved + $2,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE client_id = $1 AND available >= $2
+		RETURNING available`,
+		clientID, amount,
+	).Scan(&available)
+	if err == nil {
+		return available, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("failed to reserve charge: %w", err)
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM balances WHERE client_id = $1)`, clientID).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve charge: %w", err)
+	}
+	if !exists {
+		return 0, ErrNotFound
+	}
+	return 0, ErrInsufficientBalance
+}
+
+// addTransaction appends an entry to the ledger of a prepaid account
+func addTransaction(ctx context.Context, tx *sql.Tx, t *models.BalanceTransaction) error {
+	err := tx.QueryRowContext(ctx, `INSERT INTO balance_transactions (client_id, type, amount, available, message_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		t.ClientID, t.Type, t.Amount, t.Available, t.MessageID, t.Note,
+	).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record balance transaction: %w", err)
+	}
+	return nil
+}
+
+func scanBalance(row scanner) (*models.Balance, error) {
+	var b models.Balance
+	if err := row.Scan(&b.ClientID, &b.Available, &b.Reserved, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func scanTransaction(row scanner) (*models.BalanceTransaction, error) {
+	var t models.BalanceTransaction
+	err := row.Scan(&t.ID, &t.ClientID, &t.Type, &t.Amount, &t.Available, &t.MessageID, &t.Note, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"smsc/internal/models"
+)
+
+// CreateBatch stores a new batch and sets its ID
+func (d *Database) CreateBatch(ctx context.Context, batch *models.Batch) error {
+	err := d.db.QueryRowContext(ctx,
+		`INSERT INTO batches (client_id, sender, template, status, total) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		batch.ClientID, batch.Sender, batch.Template, batch.Status, batch.Total,
+	).Scan(&batch.ID, &batch.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+	return nil
+}
+
+// UpdateBatch stores the status and progress counters of a batch
+func (d *Database) UpdateBatch(ctx context.Context, batch *models.Batch) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE batches SET
+			status = $2, processed = $3, queued = $4, invalid = $5, duplicates = $6,
+			failed = $7, completed_at = $8
+		WHERE id = $1`,
+		batch.ID, batch.Status, batch.Processed, batch.Queued, batch.Invalid, batch.Duplicates,
+		batch.Failed, batch.CompletedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update batch: %w", err)
+	}
+	return nil
+}
+
+// GetBatch returns a batch by ID
+func (d *Database) GetBatch(ctx context.Context, id int64) (*models.Batch, error) {
+	var b models.Batch
+	err := d.db.QueryRowContext(ctx, `SELECT id, client_id, sender, template, status, total, processed,
+			queued, invalid, duplicates, failed, created_at, completed_at
+		FROM batches WHERE id = $1`, id,
+	).Scan(&b.ID, &b.ClientID, &b.Sender, &b.Template, &b.Status, &b.Total, &b.Processed,
+		&b.Queued, &b.Invalid, &b.Duplicates, &b.Failed, &b.CreatedAt, &b.CompletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+	return &b, nil
+}
+
+// InterruptBatches marks batches left processing by a previous run as interrupted
+func (d *Database) InterruptBatches(ctx context.Context) (int64, error) {
+	res, err := d.db.ExecContext(ctx,
+		`UPDATE batches SET status = $1 WHERE status = $2`,
+		models.BatchInterrupted, models.BatchProcessing)
+	if err != nil {
+		return 0, fmt.Errorf("failed to interrupt batches: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// AddBatchRecipients stores the outcomes of batch recipients
+func (d *Database) AddBatchRecipients(ctx context.Context, recipients []models.BatchRecipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(recipients))
+	args := make([]interface{}, 0, len(recipients)*5)
+	for i, r := range recipients {
+		n := i * 5
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, r.BatchID, r.Recipient, r.Status, r.MessageID, r.Error)
+	}
+
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO batch_recipients (batch_id, recipient, status, message_id, error) VALUES `+
+			strings.Join(values, ", "), args...)
+	if err != nil {
+		return fmt.Errorf("failed to add batch recipients: %w", err)
+	}
+	return nil
+}
+
+// ListBatchRecipients returns the recipient outcomes of a batch in input
+// order, optionally filtered by status, and the cursor of the next page
+func (d *Database) ListBatchRecipients(ctx context.Context, batchID int64, status models.RecipientStatus, cursor string, limit int) ([]models.BatchRecipient, string, error) {
+	var after int64
+	if cursor != "" {
+		var err error
+		if after, err = decodeCursor(cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT id, batch_id, recipient, status, message_id, error
+		FROM batch_recipients
+		WHERE batch_id = $1 AND id > $2 AND ($3 = '' OR status = $3)
+		ORDER BY id LIMIT $4`,
+		batchID, after, status, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list batch recipients: %w", err)
+	}
+	defer rows.Close()
+
+	recipients := make([]models.BatchRecipient, 0, limit)
+	for rows.Next() {
+		var r models.BatchRecipient
+		if err := rows.Scan(&r.ID, &r.BatchID, &r.Recipient, &r.Status, &r.MessageID, &r.Error); err != nil {
+			return nil, "", fmt.Errorf("failed to scan batch recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list batch recipients: %w", err)
+	}
+
+	next := ""
+	if len(recipients) > limit {
+		recipients = recipients[:limit]
+		next = encodeCursor(recipients[limit-1].ID)
+	}
+	return recipients, next, nil
+}
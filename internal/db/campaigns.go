@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"smsc/internal/models"
+)
+
+// ErrCampaignChanged is returned when a campaign is no longer in the status
+// an update was made from
+var ErrCampaignChanged = errors.New("campaign status changed")
+
+const campaignColumns = `id, name, client_id, sender, template, status, status_reason, start_at,
+	throttle, quiet_start, quiet_end, quiet_timezone, budget_cap, priority, validity_period,
+	callback_url, created_at, updated_at, started_at, completed_at`
+
+// CreateCampaign stores a new campaign and sets its ID
+func (d *Database) CreateCampaign(ctx context.Context, c *models.Campaign) error {
+	quiet := quietColumns(c.QuietHours)
+	err := d.db.QueryRowContext(ctx, `INSERT INTO campaigns (
+			name, client_id, sender, template, status, start_at, throttle, quiet_start,
+			quiet_end, quiet_timezone, budget_cap, priority, validity_period, callback_url
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, created_at, updated_at`,
+		c.Name, c.ClientID, c.Sender, c.Template, c.Status, c.StartAt, c.Throttle, quiet.Start,
+		quiet.End, quiet.Timezone, c.BudgetCap, c.Priority, c.ValidityPeriod, c.CallbackURL,
+	).Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create campaign: %w", err)
+	}
+	return nil
+}
+
+// UpdateCampaign stores the settings and state of a campaign that is still
+// in the status from. It returns ErrCampaignChanged when another update
+// changed the status first.
+func (d *Database) UpdateCampaign(ctx context.Context, c *models.Campaign, from models.CampaignStatus) error {
+	quiet := quietColumns(c.QuietHours)
+	err := d.db.QueryRowContext(ctx, `UPDATE campaigns SET
+			name = $2, sender = $3, template = $4, status = $5, status_reason = $6, start_at = $7,
+			throttle = $8, quiet_start = $9, quiet_end = $10, quiet_timezone = $11, budget_cap = $12,
+			priority = $13, validity_period = $14, callback_url = $15, started_at = $16,
+			completed_at = $17, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $18
+		RETURNING updated_at`,
+		c.ID, c.Name, c.Sender, c.Template, c.Status, c.StatusReason, c.StartAt,
+		c.Throttle, quiet.Start, quiet.End, quiet.Timezone, c.BudgetCap,
+		c.Priority, c.ValidityPeriod, c.CallbackURL, c.StartedAt,
+		c.CompletedAt, from,
+	).Scan(&c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCampaignChanged
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update campaign: %w", err)
+	}
+	return nil
+}
+
+// GetCampaign returns a campaign by ID
+func (d *Database) GetCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	row := d.db.QueryRowContext(ctx, `SELECT `+campaignColumns+` FROM campaigns WHERE id = $1`, id)
+
+	c, err := scanCampaign(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+	return c, nil
+}
+
+// ListCampaigns returns campaigns, newest first, optionally filtered by client and status
+func (d *Database) ListCampaigns(ctx context.Context, clientID string, status models.CampaignStatus) ([]*models.Campaign, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+campaignColumns+` FROM campaigns
+		WHERE ($1 = '' OR client_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY id DESC`,
+		clientID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	campaigns := make([]*models.Campaign, 0)
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan campaign: %w", err)
+		}
+		campaigns = append(campaigns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// AddCampaignRecipients appends members to a campaign audience
+func (d *Database) AddCampaignRecipients(ctx context.Context, recipients []models.CampaignRecipient) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(recipients))
+	args := make([]interface{}, 0, len(recipients)*5)
+	for i, r := range recipients {
+		vars, err := json.Marshal(r.Variables)
+		if err != nil {
+			return fmt.Errorf("failed to encode recipient variables: %w", err)
+		}
+		if r.Variables == nil {
+			vars = []byte("{}")
+		}
+
+		n := i * 5
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, r.CampaignID, r.Recipient, string(vars), r.Status, r.Error)
+	}
+
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO campaign_recipients (campaign_id, recipient, variables, status, error) VALUES `+
+			strings.Join(values, ", "), args...)
+	if err != nil {
+		return fmt.Errorf("failed to add campaign recipients: %w", err)
+	}
+	return nil
+}
+
+// CampaignRecipientNumbers returns the valid numbers already in a campaign audience
+func (d *Database) CampaignRecipientNumbers(ctx context.Context, campaignID int64) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT recipient FROM campaign_recipients WHERE campaign_id = $1 AND status <> $2`,
+		campaignID, models.RecipientInvalid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaign recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var numbers []string
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign recipient: %w", err)
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, rows.Err()
+}
+
+// PendingCampaignRecipients returns audience members not sent yet, in input order
+func (d *Database) PendingCampaignRecipients(ctx context.Context, campaignID, afterID int64, limit int) ([]models.CampaignRecipient, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT id, campaign_id, recipient, variables, status
+		FROM campaign_recipients
+		WHERE campaign_id = $1 AND status = $2 AND id > $3
+		ORDER BY id LIMIT $4`,
+		campaignID, models.RecipientPending, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending campaign recipients: %w", err)
+	}
+	defer rows.Close()
+
+	recipients := make([]models.CampaignRecipient, 0, limit)
+	for rows.Next() {
+		var (
+			r    models.CampaignRecipient
+			vars []byte
+		)
+		if err := rows.Scan(&r.ID, &r.CampaignID, &r.Recipient, &vars, &r.Status); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign recipient: %w", err)
+		}
+		if err := json.Unmarshal(vars, &r.Variables); err != nil {
+			return nil, fmt.Errorf("failed to decode recipient variables: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list pending campaign recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+// UpdateCampaignRecipient records the outcome of sending to an audience member
+func (d *Database) UpdateCampaignRecipient(ctx context.Context, r *models.CampaignRecipient) error {
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE campaign_recipients SET status = $2, message_id = $3, error = $4 WHERE id = $1`,
+		r.ID, r.Status, r.MessageID, r.Error)
+	if err != nil {
+		return fmt.Errorf("failed to update campaign recipient: %w", err)
+	}
+	return nil
+}
+
+// CampaignSpend returns the total cost of the messages sent for a campaign
+func (d *Database) CampaignSpend(ctx context.Context, campaignID int64) (float64, error) {
+	var spent float64
+	err := d.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(cost), 0) FROM messages WHERE campaign_id = $1`,
+		strconv.FormatInt(campaignID, 10)).Scan(&spent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get campaign spend: %w", err)
+	}
+	return spent, nil
+}
+
+// CampaignStats aggregates the audience and message states of a campaign
+func (d *Database) CampaignStats(ctx context.Context, campaignID int64) (*models.CampaignStats, error) {
+	stats := &models.CampaignStats{
+		CampaignID: campaignID,
+		Audience:   make(map[models.RecipientStatus]int),
+		Messages:   make(map[models.MessageStatus]int),
+	}
+
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT status, COUNT(*) FROM campaign_recipients WHERE campaign_id = $1 GROUP BY status`,
+		campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign audience stats: %w", err)
+	}
+	for rows.Next() {
+		var (
+			status models.RecipientStatus
+			n      int
+		)
+		if err := rows.Scan(&status, &n); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan campaign audience stats: %w", err)
+		}
+		stats.Audience[status] = n
+	}
+	rows.Close()
+
+	rows, err = d.db.QueryContext(ctx,
+		`SELECT status, COUNT(*), COALESCE(SUM(cost), 0) FROM messages WHERE campaign_id = $1 GROUP BY status`,
+		strconv.FormatInt(campaignID, 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign message stats: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			status models.MessageStatus
+			n      int
+			cost   float64
+		)
+		if err := rows.Scan(&status, &n, &cost); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign message stats: %w", err)
+		}
+		stats.Messages[status] = n
+		stats.Spent += cost
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get campaign message stats: %w", err)
+	}
+	return stats, nil
+}
+
+func scanCampaign(row scanner) (*models.Campaign, error) {
+	var (
+		c     models.Campaign
+		quiet models.QuietHours
+	)
+	err := row.Scan(&c.ID, &c.Name, &c.ClientID, &c.Sender, &c.Template, &c.Status, &c.StatusReason, &c.StartAt,
+		&c.Throttle, &quiet.Start, &quiet.End, &quiet.Timezone, &c.BudgetCap, &c.Priority, &c.ValidityPeriod,
+		&c.CallbackURL, &c.CreatedAt, &c.UpdatedAt, &c.StartedAt, &c.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	if quiet.Start != "" {
+		c.QuietHours = &quiet
+	}
+	return &c, nil
+}
+
+// quietColumns flattens optional quiet hours into their columns
+func quietColumns(q *models.QuietHours) models.QuietHours {
+	if q == nil {
+		return models.QuietHours{}
+	}
+	return *q
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"smsc/internal/models"
+)
+
+const cdrColumns = `id, message_id, smpp_message_id, upstream_message_id, client_id, campaign_id,
+	sender, recipient, destination, operator_id, status, error, segments, encoding, cost, price,
+	charge, submitted_at, sent_at, delivered_at, completed_at, country`
+
+// CDRFilter selects call detail records by the time their message completed.
+// Zero fields are ignored; Limit and Cursor only apply to ListCDRs.
+type CDRFilter struct {
+	ClientID string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Cursor   string
+}
+
+// InsertCDR stores the call detail record of a message and sets its ID. CDRs
+// are never changed: it reports false, and stores nothing, when the message
+// has a record already.
+func (d *Database) InsertCDR(ctx context.Context, c *models.CDR) (bool, error) {
+	err := d.db.QueryRowContext(ctx, `INSERT INTO cdrs (
+			message_id, smpp_message_id, upstream_message_id, client_id, campaign_id, sender,
+			recipient, destination, operator_id, status, error, segments, encoding, cost, price,
+			charge, submitted_at, sent_at, delivered_at, completed_at, country
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		ON CONFLICT (message_id) DO NOTHING
+		RETURNING id`,
+		c.MessageID, c.SMPPMessageID, c.UpstreamID, c.ClientID, c.CampaignID, c.Sender,
+		c.Recipient, c.Destination, c.OperatorID, c.Status, c.Error, c.Segments, c.Encoding, c.Cost, c.Price,
+		c.Charge, c.SubmittedAt, c.SentAt, c.DeliveredAt, c.CompletedAt, c.Country,
+	).Scan(&c.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to insert CDR: %w", err)
+	}
+	return true, nil
+}
+
+// ListCDRs returns call detail records matching the filter in the order they
+// were written, and the cursor of the next page or an empty string on the
+// last page
+func (d *Database) ListCDRs(ctx context.Context, filter CDRFilter) ([]*models.CDR, string, error) {
+	where, args := cdrConditions(filter)
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, after)
+		where = append(where, fmt.Sprintf("id > $%d", len(args)))
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	query := `SELECT ` + cdrColumns + ` FROM cdrs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(` ORDER BY id LIMIT %d`, limit+1)
+
+	cdrs := make([]*models.CDR, 0, limit)
+	err := d.queryCDRs(ctx, query, args, func(c *models.CDR) error {
+		cdrs = append(cdrs, c)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(cdrs) > limit {
+		cdrs = cdrs[:limit]
+		next = encodeCursor(cdrs[limit-1].ID)
+	}
+	return cdrs, next, nil
+}
+
+// ExportCDRs passes every call detail record matching the filter to fn in the
+// order they were written, without loading them all at once. An error from
+// fn stops the export and is returned.
+func (d *Database) ExportCDRs(ctx context.Context, filter CDRFilter, fn func(*models.CDR) error) error {
+	where, args := cdrConditions(filter)
+	query := `SELECT ` + cdrColumns + ` FROM cdrs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id`
+
+	return d.queryCDRs(ctx, query, args, fn)
+}
+
+func (d *Database) queryCDRs(ctx context.Context, query string, args []interface{}, fn func(*models.CDR) error) error {
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to list CDRs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCDR(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan CDR: %w", err)
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list CDRs: %w", err)
+	}
+	return nil
+}
+
+// cdrConditions returns the WHERE conditions and arguments of a filter
+func cdrConditions(filter CDRFilter) ([]string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.ClientID != "" {
+		add("client_id = $%d", filter.ClientID)
+	}
+	if !filter.From.IsZero() {
+		add("completed_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("completed_at < $%d", filter.To)
+	}
+	return where, args
+}
+
+func scanCDR(row scanner) (*models.CDR, error) {
+	var c models.CDR
+	err := row.Scan(&c.ID, &c.MessageID, &c.SMPPMessageID, &c.UpstreamID, &c.ClientID, &c.CampaignID,
+		&c.Sender, &c.Recipient, &c.Destination, &c.OperatorID, &c.Status, &c.Error, &c.Segments, &c.Encoding,
+		&c.Cost, &c.Price, &c.Charge, &c.SubmittedAt, &c.SentAt, &c.DeliveredAt, &c.CompletedAt, &c.Country)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -2,8 +2,11 @@ package db
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
+	"os"
 
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
@@ -22,8 +25,9 @@ type Config struct {
 
 // Database represents the database connection and operations
 type Database struct {
-	db  *sql.DB
-	log *logrus.Logger
+	db       *sql.DB
+	log      *logrus.Logger
+	instance string
 }
 
 // New creates a new database connection
@@ -49,16 +53,38 @@ func New(cfg config.DatabaseConfig, log *logrus.Logger) (*Database, error) {
 	}
 
 	return &Database{
-		db:  db,
-		log: log,
+		db:       db,
+		log:      log,
+		instance: newInstanceID(),
 	}, nil
 }
 
+// newInstanceID returns an ID for this process that differs between restarts
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "smsc"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return host + "-" + hex.EncodeToString(suffix)
+}
+
+// Instance returns the ID this process holds leases and queued messages under
+func (d *Database) Instance() string {
+	return d.instance
+}
+
 // Close closes the database connection
 func (d *Database) Close() error {
 	return d.db.Close()
 }
 
+// Ping verifies the database connection is alive
+func (d *Database) Ping(ctx context.Context) error {
+	return d.db.PingContext(ctx)
+}
+
 // InitSchema initializes the database schema
 func (d *Database) InitSchema(ctx context.Context) error {
 	// Create necessary tables
@@ -72,6 +98,285 @@ func (d *Database) InitSchema(ctx context.Context) error {
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`ALTER TABLE messages
+			ADD COLUMN IF NOT EXISTS message_id VARCHAR(64) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS upstream_message_id VARCHAR(64) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS client_id VARCHAR(64) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS campaign_id VARCHAR(64),
+			ADD COLUMN IF NOT EXISTS operator_id VARCHAR(50) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS priority INTEGER NOT NULL DEFAULT 1,
+			ADD COLUMN IF NOT EXISTS validity_period INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS scheduled_time TIMESTAMP WITH TIME ZONE,
+			ADD COLUMN IF NOT EXISTS sent_at TIMESTAMP WITH TIME ZONE,
+			ADD COLUMN IF NOT EXISTS delivered_at TIMESTAMP WITH TIME ZONE,
+			ADD COLUMN IF NOT EXISTS retry_count INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS delivery_report TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS encoding VARCHAR(10) NOT NULL DEFAULT 'GSM',
+			ADD COLUMN IF NOT EXISTS protocol_id INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS esm_class INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS data_coding INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS source_ton INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS source_npi INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS destination_ton INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS destination_npi INTEGER NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS service_type VARCHAR(10) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS billing_info TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS cost NUMERIC(12, 6) NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS callback_url TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS price NUMERIC(12, 6) NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS destination VARCHAR(32) NOT NULL DEFAULT ''`,
+		// The instance whose in-memory queue holds a pending message
+		`ALTER TABLE messages ADD COLUMN IF NOT EXISTS queued_by VARCHAR(100) NOT NULL DEFAULT ''`,
+		`CREATE TABLE IF NOT EXISTS leases (
+			name VARCHAR(200) PRIMARY KEY,
+			owner VARCHAR(100) NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_message_id ON messages (message_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_upstream_message_id ON messages (upstream_message_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_client_id ON messages (client_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_recipient ON messages (recipient)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_created_at ON messages (created_at)`,
+		`DROP INDEX IF EXISTS idx_messages_unfinished`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_queued ON messages (id) WHERE status IN ('pending', 'scheduled')`,
+		`CREATE TABLE IF NOT EXISTS message_events (
+			id BIGSERIAL PRIMARY KEY,
+			message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			type VARCHAR(20) NOT NULL,
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_events_message_id ON message_events (message_id, id)`,
+		`CREATE TABLE IF NOT EXISTS idempotency_keys (
+			client_id VARCHAR(64) NOT NULL,
+			key VARCHAR(255) NOT NULL,
+			request_hash VARCHAR(64) NOT NULL,
+			message_id INTEGER REFERENCES messages(id) ON DELETE CASCADE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (client_id, key)
+		)`,
+		`CREATE TABLE IF NOT EXISTS batches (
+			id SERIAL PRIMARY KEY,
+			client_id VARCHAR(64) NOT NULL DEFAULT '',
+			sender VARCHAR(20) NOT NULL,
+			template TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			total INTEGER NOT NULL DEFAULT 0,
+			processed INTEGER NOT NULL DEFAULT 0,
+			queued INTEGER NOT NULL DEFAULT 0,
+			invalid INTEGER NOT NULL DEFAULT 0,
+			duplicates INTEGER NOT NULL DEFAULT 0,
+			failed INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			completed_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE TABLE IF NOT EXISTS batch_recipients (
+			id BIGSERIAL PRIMARY KEY,
+			batch_id INTEGER NOT NULL REFERENCES batches(id) ON DELETE CASCADE,
+			recipient VARCHAR(32) NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+			error TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_batch_recipients_batch_id ON batch_recipients (batch_id, id)`,
+		`CREATE TABLE IF NOT EXISTS campaigns (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			client_id VARCHAR(64) NOT NULL DEFAULT '',
+			sender VARCHAR(20) NOT NULL,
+			template TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			status_reason TEXT NOT NULL DEFAULT '',
+			start_at TIMESTAMP WITH TIME ZONE,
+			throttle INTEGER NOT NULL DEFAULT 0,
+			quiet_start VARCHAR(5) NOT NULL DEFAULT '',
+			quiet_end VARCHAR(5) NOT NULL DEFAULT '',
+			quiet_timezone VARCHAR(64) NOT NULL DEFAULT '',
+			budget_cap NUMERIC(14, 4) NOT NULL DEFAULT 0,
+			priority INTEGER NOT NULL DEFAULT 1,
+			validity_period INTEGER NOT NULL DEFAULT 0,
+			callback_url TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP WITH TIME ZONE,
+			completed_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE TABLE IF NOT EXISTS campaign_recipients (
+			id BIGSERIAL PRIMARY KEY,
+			campaign_id INTEGER NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+			recipient VARCHAR(32) NOT NULL,
+			variables JSONB NOT NULL DEFAULT '{}',
+			status VARCHAR(20) NOT NULL,
+			message_id INTEGER REFERENCES messages(id) ON DELETE SET NULL,
+			error TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_campaign_recipients_campaign_id ON campaign_recipients (campaign_id, status, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_campaign_id ON messages (campaign_id)`,
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			message_id INTEGER NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+			client_id VARCHAR(64) NOT NULL DEFAULT '',
+			url TEXT NOT NULL,
+			event VARCHAR(50) NOT NULL,
+			payload TEXT NOT NULL,
+			status VARCHAR(20) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_code INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending'`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_message_id ON webhook_deliveries (message_id)`,
+		`CREATE TABLE IF NOT EXISTS mo_messages (
+			id BIGSERIAL PRIMARY KEY,
+			source VARCHAR(20) NOT NULL,
+			destination VARCHAR(20) NOT NULL,
+			content TEXT NOT NULL,
+			data_coding INTEGER NOT NULL DEFAULT 0,
+			origin VARCHAR(10) NOT NULL,
+			operator_id VARCHAR(50) NOT NULL DEFAULT '',
+			upstream_message_id VARCHAR(64) NOT NULL DEFAULT '',
+			rule_id VARCHAR(64) NOT NULL DEFAULT '',
+			keyword VARCHAR(50) NOT NULL DEFAULT '',
+			system_id VARCHAR(16) NOT NULL DEFAULT '',
+			url TEXT NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_mo_messages_due ON mo_messages (next_attempt_at) WHERE status = 'queued'`,
+		`CREATE INDEX IF NOT EXISTS idx_mo_messages_system_id ON mo_messages (system_id) WHERE status = 'queued'`,
+		// MO rules added through the API
+		`CREATE TABLE IF NOT EXISTS mo_rules (
+			id BIGSERIAL PRIMARY KEY,
+			definition JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS users (
+			id BIGSERIAL PRIMARY KEY,
+			username VARCHAR(64) NOT NULL UNIQUE,
+			password_hash VARCHAR(100) NOT NULL,
+			client_id VARCHAR(64) NOT NULL DEFAULT '',
+			disabled BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			last_login_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id BIGSERIAL PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			client_id VARCHAR(64) NOT NULL DEFAULT '',
+			prefix VARCHAR(16) NOT NULL UNIQUE,
+			hash CHAR(64) NOT NULL,
+			created_by VARCHAR(64) NOT NULL DEFAULT '',
+			rotated_to BIGINT REFERENCES api_keys(id),
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP WITH TIME ZONE,
+			last_used_at TIMESTAMP WITH TIME ZONE,
+			revoked_at TIMESTAMP WITH TIME ZONE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_client_id ON api_keys (client_id)`,
+		// Accounts created before roles existed had full access; see the
+		// migrations for those bound to a client
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'admin'`,
+		`ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'admin'`,
+		`CREATE TABLE IF NOT EXISTS tenants (
+			id VARCHAR(64) PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			system_ids JSONB NOT NULL DEFAULT '[]',
+			sender_ids JSONB NOT NULL DEFAULT '[]',
+			route_plan VARCHAR(100) NOT NULL DEFAULT '',
+			prices JSONB NOT NULL DEFAULT '{}',
+			daily_quota BIGINT NOT NULL DEFAULT 0,
+			monthly_quota BIGINT NOT NULL DEFAULT 0,
+			max_tps INTEGER NOT NULL DEFAULT 0,
+			disabled BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`ALTER TABLE tenants ADD COLUMN IF NOT EXISTS price_list VARCHAR(64) NOT NULL DEFAULT ''`,
+		// Messages of a client stored in each UTC day and month
+		`CREATE TABLE IF NOT EXISTS tenant_usage (
+			client_id VARCHAR(64) NOT NULL,
+			period VARCHAR(10) NOT NULL,
+			starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			count BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (client_id, period, starts_at)
+		)`,
+		`CREATE TABLE IF NOT EXISTS price_lists (
+			id VARCHAR(64) PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			entries JSONB NOT NULL DEFAULT '[]',
+			tiers JSONB NOT NULL DEFAULT '[]',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS balances (
+			client_id VARCHAR(64) PRIMARY KEY,
+			available NUMERIC(14, 6) NOT NULL DEFAULT 0,
+			reserved NUMERIC(14, 6) NOT NULL DEFAULT 0,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS balance_transactions (
+			id BIGSERIAL PRIMARY KEY,
+			client_id VARCHAR(64) NOT NULL,
+			type VARCHAR(20) NOT NULL,
+			amount NUMERIC(14, 6) NOT NULL,
+			available NUMERIC(14, 6) NOT NULL,
+			message_id BIGINT,
+			note TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_balance_transactions_client_id ON balance_transactions (client_id, id)`,
+		`CREATE TABLE IF NOT EXISTS cdrs (
+			id BIGSERIAL PRIMARY KEY,
+			message_id BIGINT NOT NULL UNIQUE,
+			smpp_message_id VARCHAR(64) NOT NULL DEFAULT '',
+			upstream_message_id VARCHAR(64) NOT NULL DEFAULT '',
+			client_id VARCHAR(64) NOT NULL DEFAULT '',
+			campaign_id VARCHAR(64) NOT NULL DEFAULT '',
+			sender VARCHAR(20) NOT NULL,
+			recipient VARCHAR(20) NOT NULL,
+			destination VARCHAR(32) NOT NULL DEFAULT '',
+			operator_id VARCHAR(50) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			segments INTEGER NOT NULL,
+			encoding VARCHAR(20) NOT NULL,
+			cost NUMERIC(12, 6) NOT NULL DEFAULT 0,
+			price NUMERIC(12, 6) NOT NULL DEFAULT 0,
+			charge VARCHAR(20) NOT NULL DEFAULT '',
+			submitted_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			sent_at TIMESTAMP WITH TIME ZONE,
+			delivered_at TIMESTAMP WITH TIME ZONE,
+			completed_at TIMESTAMP WITH TIME ZONE NOT NULL
+		)`,
+		`ALTER TABLE cdrs ADD COLUMN IF NOT EXISTS country VARCHAR(3) NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS idx_cdrs_completed_at ON cdrs (completed_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_cdrs_client_id ON cdrs (client_id, completed_at)`,
+		`CREATE TABLE IF NOT EXISTS invoices (
+			id BIGSERIAL PRIMARY KEY,
+			number VARCHAR(32) NOT NULL UNIQUE,
+			client_id VARCHAR(64) NOT NULL,
+			period CHAR(7) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			lines JSONB NOT NULL DEFAULT '[]',
+			credits JSONB NOT NULL DEFAULT '[]',
+			subtotal NUMERIC(14, 6) NOT NULL,
+			credit_total NUMERIC(14, 6) NOT NULL,
+			tax_name VARCHAR(20) NOT NULL DEFAULT '',
+			tax_rate NUMERIC(5, 2) NOT NULL,
+			tax NUMERIC(14, 6) NOT NULL,
+			total NUMERIC(14, 6) NOT NULL,
+			issued_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (client_id, period)
+		)`,
 		`CREATE TABLE IF NOT EXISTS operators (
 			id SERIAL PRIMARY KEY,
 			name VARCHAR(50) NOT NULL UNIQUE,
@@ -88,6 +393,19 @@ func (d *Database) InitSchema(ctx context.Context) error {
 			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(pattern, operator_id)
 		)`,
+		// Rules added through the API keep their whole definition
+		`ALTER TABLE routing_rules ADD COLUMN IF NOT EXISTS definition JSONB`,
+		`CREATE TABLE IF NOT EXISTS route_plans (
+			name VARCHAR(100) PRIMARY KEY,
+			default_route VARCHAR(100) NOT NULL DEFAULT '',
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS route_plan_assignments (
+			client_id VARCHAR(64) PRIMARY KEY,
+			plan VARCHAR(100) NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		)`,
 	}
 
 	for _, query := range queries {
@@ -96,10 +414,92 @@ func (d *Database) InitSchema(ctx context.Context) error {
 		}
 	}
 
+	if err := d.migrate(ctx); err != nil {
+		return err
+	}
+
 	d.log.Info("Database schema initialized successfully")
 	return nil
 }
 
+// migration changes existing data once. Schema changes that can safely run
+// on every start belong in InitSchema instead.
+type migration struct {
+	version int
+	name    string
+	queries []string
+}
+
+// migrations run in order of version; released versions must not change
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "accounts bound to a client become tenants",
+		queries: []string{
+			`UPDATE users SET role = 'tenant' WHERE client_id <> '' AND role = 'admin'`,
+			`UPDATE api_keys SET role = 'tenant' WHERE client_id <> '' AND role = 'admin'`,
+		},
+	},
+	{
+		version: 2,
+		name:    "count the messages of the current quota periods",
+		queries: []string{
+			`INSERT INTO tenant_usage (client_id, period, starts_at, count)
+			SELECT client_id, 'day', date_trunc('day', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', COUNT(*)
+			FROM messages
+			WHERE client_id <> '' AND created_at >= date_trunc('day', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+			GROUP BY client_id
+			ON CONFLICT DO NOTHING`,
+			`INSERT INTO tenant_usage (client_id, period, starts_at, count)
+			SELECT client_id, 'month', date_trunc('month', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', COUNT(*)
+			FROM messages
+			WHERE client_id <> '' AND created_at >= date_trunc('month', CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+			GROUP BY client_id
+			ON CONFLICT DO NOTHING`,
+		},
+	},
+}
+
+// migrate applies the migrations not recorded in schema_migrations yet. Each
+// runs in a transaction together with its record, so that instances starting
+// at the same time apply it only once.
+func (d *Database) migrate(ctx context.Context) error {
+	if _, err := d.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(200) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("failed to create schema migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		err := d.Transaction(ctx, func(tx *sql.Tx) error {
+			res, err := tx.ExecContext(ctx,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING`,
+				m.version, m.name)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				// Already applied
+				return err
+			}
+
+			for _, query := range m.queries {
+				if _, err := tx.ExecContext(ctx, query); err != nil {
+					return err
+				}
+			}
+			d.log.WithField("version", m.version).Infof("Applied migration: %s", m.name)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
 // Transaction executes a function within a database transaction
 func (d *Database) Transaction(ctx context.Context, fn func(*sql.Tx) error) error {
 	tx, err := d.db.BeginTx(ctx, nil)
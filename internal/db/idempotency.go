@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IdempotencyKey records a client request so that retries return the
+// original result instead of repeating it
+type IdempotencyKey struct {
+	ClientID    string
+	Key         string
+	RequestHash string
+	MessageID   int64 // zero while the original request is still in progress
+	CreatedAt   time.Time
+}
+
+// ClaimIdempotencyKey reserves a key for a request. When the key is already
+// taken, the existing record is returned and claimed is false. Keys older than
+// ttl are expired and may be claimed again.
+func (d *Database) ClaimIdempotencyKey(ctx context.Context, clientID, key, requestHash string, ttl time.Duration) (*IdempotencyKey, bool, error) {
+	if _, err := d.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE client_id = $1 AND key = $2 AND created_at < $3`,
+		clientID, key, time.Now().Add(-ttl)); err != nil {
+		return nil, false, fmt.Errorf("failed to expire idempotency key: %w", err)
+	}
+
+	res, err := d.db.ExecContext(ctx,
+		`INSERT INTO idempotency_keys (client_id, key, request_hash) VALUES ($1, $2, $3)
+		ON CONFLICT (client_id, key) DO NOTHING`,
+		clientID, key, requestHash)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return &IdempotencyKey{ClientID: clientID, Key: key, RequestHash: requestHash, CreatedAt: time.Now()}, true, nil
+	}
+
+	var (
+		existing  = IdempotencyKey{ClientID: clientID, Key: key}
+		messageID sql.NullInt64
+	)
+	err = d.db.QueryRowContext(ctx,
+		`SELECT request_hash, message_id, created_at FROM idempotency_keys WHERE client_id = $1 AND key = $2`,
+		clientID, key).Scan(&existing.RequestHash, &messageID, &existing.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	existing.MessageID = messageID.Int64
+	return &existing, false, nil
+}
+
+// CompleteIdempotencyKey links a claimed key to the message its request created
+func (d *Database) CompleteIdempotencyKey(ctx context.Context, clientID, key string, messageID int64) error {
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET message_id = $3 WHERE client_id = $1 AND key = $2`,
+		clientID, key, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a claimed key whose request failed so it can be retried
+func (d *Database) ReleaseIdempotencyKey(ctx context.Context, clientID, key string) error {
+	_, err := d.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE client_id = $1 AND key = $2 AND message_id IS NULL`,
+		clientID, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
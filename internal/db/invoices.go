@@ -0,0 +1,179 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"smsc/internal/models"
+)
+
+// ErrInvoiceExists is returned when a tenant was invoiced for a period already
+var ErrInvoiceExists = errors.New("invoice already exists")
+
+const invoiceColumns = `id, number, client_id, period, currency, lines, credits, subtotal, credit_total,
+	tax_name, tax_rate, tax, total, issued_at`
+
+// UsageByDestination sums the CDRs of a client completed in a range per
+// destination country and network. Destinations rated on a prefix have no
+// network; refunded messages are counted but not charged.
+func (d *Database) UsageByDestination(ctx context.Context, clientID string, from, to time.Time) ([]models.UsageLine, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT country, network, COUNT(*), COALESCE(SUM(segments), 0),
+			COUNT(*) FILTER (WHERE status = $4),
+			COALESCE(SUM(price) FILTER (WHERE charge <> $5), 0)
+		FROM (
+			SELECT *, CASE WHEN destination ~ '^[0-9*]*$' THEN '' ELSE destination END AS network
+			FROM cdrs
+			WHERE client_id = $1 AND completed_at >= $2 AND completed_at < $3
+		) c
+		GROUP BY country, network
+		ORDER BY country, network`,
+		clientID, from, to, models.StatusDelivered, models.ChargeRefunded,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+	defer rows.Close()
+
+	lines := make([]models.UsageLine, 0)
+	for rows.Next() {
+		var l models.UsageLine
+		if err := rows.Scan(&l.Country, &l.Network, &l.Messages, &l.Segments, &l.Delivered, &l.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		lines = append(lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+	return lines, nil
+}
+
+// CreateInvoice stores a new invoice and sets its ID, number and issue time.
+// Numbers are the prefix followed by the zero-padded ID. ErrInvoiceExists is
+// returned when the client has an invoice for the period.
+func (d *Database) CreateInvoice(ctx context.Context, inv *models.Invoice, prefix string) error {
+	lines, err := json.Marshal(inv.Lines)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice lines: %w", err)
+	}
+	credits, err := json.Marshal(inv.Credits)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice credits: %w", err)
+	}
+
+	err = d.db.QueryRowContext(ctx, `WITH seq AS (
+			SELECT nextval(pg_get_serial_sequence('invoices', 'id')) AS id
+		)
+		INSERT INTO invoices (id, number, client_id, period, currency, lines, credits, subtotal,
+			credit_total, tax_name, tax_rate, tax, total)
+		SELECT seq.id, $1 || lpad(seq.id::text, 6, '0'), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+		FROM seq
+		ON CONFLICT (client_id, period) DO NOTHING
+		RETURNING id, number, issued_at`,
+		prefix, inv.ClientID, inv.Period, inv.Currency, lines, credits, inv.Subtotal,
+		inv.CreditTotal, inv.TaxName, inv.TaxRate, inv.Tax, inv.Total,
+	).Scan(&inv.ID, &inv.Number, &inv.IssuedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvoiceExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+	return nil
+}
+
+// GetInvoice returns an invoice by ID
+func (d *Database) GetInvoice(ctx context.Context, id int64) (*models.Invoice, error) {
+	inv, err := scanInvoice(d.db.QueryRowContext(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+	return inv, nil
+}
+
+// ListInvoices returns the invoices of a client, or of every client when
+// clientID is empty, newest first, and the cursor of the next page or an
+// empty string on the last page
+func (d *Database) ListInvoices(ctx context.Context, clientID string, limit int, cursor string) ([]*models.Invoice, string, error) {
+	var (
+		where string
+		args  []interface{}
+	)
+	if clientID != "" {
+		args = append(args, clientID)
+		where = ` WHERE client_id = $1`
+	}
+	if cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, after)
+		if where == "" {
+			where = ` WHERE`
+		} else {
+			where += ` AND`
+		}
+		where += fmt.Sprintf(` id < $%d`, len(args))
+	}
+
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+	query := `SELECT ` + invoiceColumns + ` FROM invoices` + where + fmt.Sprintf(` ORDER BY id DESC LIMIT %d`, limit+1)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list invoices: %w", err)
+	}
+	defer rows.Close()
+
+	invoices := make([]*models.Invoice, 0, limit)
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan invoice: %w", err)
+		}
+		invoices = append(invoices, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list invoices: %w", err)
+	}
+
+	next := ""
+	if len(invoices) > limit {
+		invoices = invoices[:limit]
+		next = encodeCursor(invoices[limit-1].ID)
+	}
+	return invoices, next, nil
+}
+
+func scanInvoice(row scanner) (*models.Invoice, error) {
+	var (
+		inv            models.Invoice
+		lines, credits []byte
+	)
+	err := row.Scan(&inv.ID, &inv.Number, &inv.ClientID, &inv.Period, &inv.Currency, &lines, &credits,
+		&inv.Subtotal, &inv.CreditTotal, &inv.TaxName, &inv.TaxRate, &inv.Tax, &inv.Total, &inv.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(lines, &inv.Lines); err != nil {
+		return nil, fmt.Errorf("failed to decode invoice lines: %w", err)
+	}
+	if err := json.Unmarshal(credits, &inv.Credits); err != nil {
+		return nil, fmt.Errorf("failed to decode invoice credits: %w", err)
+	}
+	return &inv, nil
+}
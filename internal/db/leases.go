@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// instanceLease is the lease name prefix instances keep alive while running
+const instanceLease = "instance:"
+
+// AcquireLease takes or renews the named lease for this instance until ttl
+// from now. It reports false while another instance holds an unexpired lease
+// of that name.
+func (d *Database) AcquireLease(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	var owner string
+	err := d.db.QueryRowContext(ctx, `INSERT INTO leases (name, owner, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + $3 * INTERVAL '1 millisecond')
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+		WHERE leases.owner = EXCLUDED.owner OR leases.expires_at < CURRENT_TIMESTAMP
+		RETURNING owner`,
+		name, d.instance, ttl.Milliseconds(),
+	).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// ReleaseLease gives up the named lease if this instance holds it
+func (d *Database) ReleaseLease(ctx context.Context, name string) error {
+	_, err := d.db.ExecContext(ctx, `DELETE FROM leases WHERE name = $1 AND owner = $2`, name, d.instance)
+	if err != nil {
+		return fmt.Errorf("failed to release lease %s: %w", name, err)
+	}
+	return nil
+}
+
+// KeepAlive marks this instance as running until ttl from now. Messages
+// queued by instances that stopped doing so can be claimed by the others.
+func (d *Database) KeepAlive(ctx context.Context, ttl time.Duration) error {
+	_, err := d.AcquireLease(ctx, instanceLease+d.instance, ttl)
+	return err
+}
+
+// Retire marks this instance as stopped, so that the others claim its
+// queued messages right away
+func (d *Database) Retire(ctx context.Context) error {
+	return d.ReleaseLease(ctx, instanceLease+d.instance)
+}
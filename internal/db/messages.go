@@ -0,0 +1,406 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"smsc/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidCursor is returned for malformed pagination cursors
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
+const messageColumns = `id, sender, recipient, content, status, priority, validity_period,
+	scheduled_time, created_at, updated_at, sent_at, delivered_at, operator_id, message_id,
+	upstream_message_id, retry_count, last_error, client_id, campaign_id, delivery_report,
+	encoding, protocol_id, esm_class, data_coding, source_ton, source_npi, destination_ton,
+	destination_npi, service_type, billing_info, cost, callback_url, price, destination`
+
+// MessageFilter selects messages for ListMessages. Zero fields are ignored.
+type MessageFilter struct {
+	ClientID   string
+	CampaignID string
+	Sender     string
+	Recipient  string
+	Status     models.MessageStatus
+	OperatorID string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Cursor     string
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryRower runs single-row queries on the database or in a transaction
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// InsertMessage stores a new message and sets its ID. Messages whose charge
+// is to be reserved have their price taken from the client's prepaid balance
+// in the same transaction; ErrInsufficientBalance is returned, and nothing
+// stored, when the balance does not cover it. Clients without a balance are
+// not charged and the charge state of their messages is cleared. Messages
+// with a quota are counted in the same transaction; ErrQuotaExceeded is
+// returned, and nothing stored, when they would exceed it.
+func (d *Database) InsertMessage(ctx context.Context, msg *models.Message) error {
+	if msg.BillingInfo != models.ChargeReserved && msg.Quota == nil {
+		return insertMessage(ctx, d.db, msg, d.instance)
+	}
+
+	return d.Transaction(ctx, func(tx *sql.Tx) error {
+		if msg.Quota != nil {
+			if err := countQuota(ctx, tx, msg.ClientID, msg.Quota); err != nil {
+				return err
+			}
+		}
+		if msg.BillingInfo != models.ChargeReserved {
+			return insertMessage(ctx, tx, msg, d.instance)
+		}
+
+		available, err := reserve(ctx, tx, msg.ClientID, msg.Price)
+		if errors.Is(err, ErrNotFound) {
+			msg.BillingInfo = ""
+			return insertMessage(ctx, tx, msg, d.instance)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := insertMessage(ctx, tx, msg, d.instance); err != nil {
+			return err
+		}
+		return addTransaction(ctx, tx, &models.BalanceTransaction{
+			ClientID:  msg.ClientID,
+			Type:      models.TransactionReserve,
+			Amount:    -msg.Price,
+			Available: available,
+			MessageID: &msg.ID,
+		})
+	})
+}
+
+// insertMessage stores a message queued by the given instance
+func insertMessage(ctx context.Context, q queryRower, msg *models.Message, queuedBy string) error {
+	err := q.QueryRowContext(ctx, `INSERT INTO messages (
+			sender, recipient, content, status, priority, validity_period, scheduled_time,
+			operator_id, message_id, upstream_message_id, client_id, campaign_id, encoding,
+			protocol_id, esm_class, data_coding, source_ton, source_npi, destination_ton,
+			destination_npi, service_type, billing_info, cost, callback_url, price, destination,
+			queued_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24,
+			$25, $26, $27)
+		RETURNING id, created_at, updated_at`,
+		msg.Sender, msg.Recipient, msg.Content, msg.Status, msg.Priority,
+		int64(msg.ValidityPeriod/time.Second), msg.ScheduledTime,
+		msg.OperatorID, msg.MessageID, msg.UpstreamID, msg.ClientID, msg.CampaignID, msg.Encoding,
+		msg.ProtocolID, msg.ESMClass, msg.DataCoding, msg.SourceTON, msg.SourceNPI, msg.DestinationTON,
+		msg.DestinationNPI, msg.ServiceType, msg.BillingInfo, msg.Cost, msg.CallbackURL, msg.Price, msg.Destination,
+		queuedBy,
+	).Scan(&msg.ID, &msg.CreatedAt, &msg.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert message: %w", err)
+	}
+	return nil
+}
+
+// UpdateMessageStatus records a status change of a message. The operator and
+// error are only updated when set; sent and delivered times are stamped on the
+// matching statuses.
+func (d *Database) UpdateMessageStatus(ctx context.Context, id int64, status models.MessageStatus, operatorID, lastError string) error {
+	res, err := d.db.ExecContext(ctx, `UPDATE messages SET
+			status = $2,
+			operator_id = COALESCE(NULLIF($3, ''), operator_id),
+			last_error = COALESCE(NULLIF($4, ''), last_error),
+			sent_at = CASE WHEN $2 = 'sent' THEN CURRENT_TIMESTAMP ELSE sent_at END,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN CURRENT_TIMESTAMP ELSE delivered_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id, status, operatorID, lastError,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update message status: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SetMessageUpstreamID records the ID an operator assigned to a submitted
+// message, which its delivery receipts refer to
+func (d *Database) SetMessageUpstreamID(ctx context.Context, id int64, upstreamID string) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE messages SET upstream_message_id = $2 WHERE id = $1`, id, upstreamID)
+	if err != nil {
+		return fmt.Errorf("failed to set upstream message ID: %w", err)
+	}
+	return nil
+}
+
+// SetMessageCost records what the operator a message was routed to charges for it
+func (d *Database) SetMessageCost(ctx context.Context, id int64, cost float64) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE messages SET cost = $2 WHERE id = $1`, id, cost)
+	if err != nil {
+		return fmt.Errorf("failed to set message cost: %w", err)
+	}
+	return nil
+}
+
+// RecordDeliveryReport stores the final status and raw receipt of a message
+func (d *Database) RecordDeliveryReport(ctx context.Context, id int64, status models.MessageStatus, report string) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE messages SET
+			status = $2,
+			delivery_report = $3,
+			delivered_at = CASE WHEN $2 = 'delivered' THEN CURRENT_TIMESTAMP ELSE delivered_at END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id, status, report)
+	if err != nil {
+		return fmt.Errorf("failed to record delivery report: %w", err)
+	}
+	return nil
+}
+
+// GetMessage returns a message by its internal ID
+func (d *Database) GetMessage(ctx context.Context, id int64) (*models.Message, error) {
+	return d.getMessage(ctx, "id", id)
+}
+
+// GetMessageBySMPPID returns a message by the message_id returned to the ESME
+func (d *Database) GetMessageBySMPPID(ctx context.Context, messageID string) (*models.Message, error) {
+	return d.getMessage(ctx, "message_id", messageID)
+}
+
+// GetMessageByUpstreamID returns a message by the message ID assigned by the operator
+func (d *Database) GetMessageByUpstreamID(ctx context.Context, upstreamID string) (*models.Message, error) {
+	return d.getMessage(ctx, "upstream_message_id", upstreamID)
+}
+
+func (d *Database) getMessage(ctx context.Context, column string, value interface{}) (*models.Message, error) {
+	row := d.db.QueryRowContext(ctx,
+		`SELECT `+messageColumns+` FROM messages WHERE `+column+` = $1 ORDER BY id DESC LIMIT 1`, value)
+
+	msg, err := scanMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return msg, nil
+}
+
+// ClaimQueuedMessages takes over up to limit pending and scheduled messages
+// with an ID above afterID that were queued by instances no longer running,
+// or by none, and returns them in ID order. Rows claimed by a concurrent
+// call are skipped.
+func (d *Database) ClaimQueuedMessages(ctx context.Context, afterID int64, limit int) ([]*models.Message, error) {
+	rows, err := d.db.QueryContext(ctx, `UPDATE messages SET queued_by = $1
+		WHERE id IN (
+			SELECT m.id FROM messages m
+			WHERE m.status IN ($2, $3) AND m.id > $4 AND m.queued_by <> $1
+				AND NOT EXISTS (
+					SELECT 1 FROM leases l
+					WHERE l.name = $5 || m.queued_by AND l.expires_at > CURRENT_TIMESTAMP
+				)
+			ORDER BY m.id
+			LIMIT $6
+			FOR UPDATE OF m SKIP LOCKED
+		)
+		RETURNING `+messageColumns,
+		d.instance, models.StatusPending, models.StatusScheduled, afterID, instanceLease, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim queued messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*models.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim queued messages: %w", err)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// ListMessages returns messages matching the filter, newest first, and the
+// cursor of the next page or an empty string on the last page
+func (d *Database) ListMessages(ctx context.Context, filter MessageFilter) ([]*models.Message, string, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.ClientID != "" {
+		add("client_id = $%d", filter.ClientID)
+	}
+	if filter.CampaignID != "" {
+		add("campaign_id = $%d", filter.CampaignID)
+	}
+	if filter.Sender != "" {
+		add("sender = $%d", filter.Sender)
+	}
+	if filter.Recipient != "" {
+		add("recipient = $%d", filter.Recipient)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if filter.OperatorID != "" {
+		add("operator_id = $%d", filter.OperatorID)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+	if filter.Cursor != "" {
+		after, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		add("id < $%d", after)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	query := `SELECT ` + messageColumns + ` FROM messages`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// Fetch one extra row to know whether another page follows
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT %d`, limit+1)
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]*models.Message, 0, limit)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	next := ""
+	if len(messages) > limit {
+		messages = messages[:limit]
+		next = encodeCursor(messages[limit-1].ID)
+	}
+	return messages, next, nil
+}
+
+// AddMessageEvent appends an event to a message's timeline
+func (d *Database) AddMessageEvent(ctx context.Context, messageID int64, event models.EventType, detail string) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO message_events (message_id, type, detail) VALUES ($1, $2, $3)`,
+		messageID, event, detail)
+	if err != nil {
+		return fmt.Errorf("failed to add message event: %w", err)
+	}
+	return nil
+}
+
+// MessageEvents returns the timeline of a message in the order it happened
+func (d *Database) MessageEvents(ctx context.Context, messageID int64) ([]models.MessageEvent, error) {
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT id, message_id, type, detail, created_at FROM message_events WHERE message_id = $1 ORDER BY id`,
+		messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]models.MessageEvent, 0)
+	for rows.Next() {
+		var e models.MessageEvent
+		if err := rows.Scan(&e.ID, &e.MessageID, &e.Type, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list message events: %w", err)
+	}
+	return events, nil
+}
+
+func scanMessage(row scanner) (*models.Message, error) {
+	var (
+		msg      models.Message
+		validity int64
+	)
+	err := row.Scan(
+		&msg.ID, &msg.Sender, &msg.Recipient, &msg.Content, &msg.Status, &msg.Priority, &validity,
+		&msg.ScheduledTime, &msg.CreatedAt, &msg.UpdatedAt, &msg.SentAt, &msg.DeliveredAt, &msg.OperatorID, &msg.MessageID,
+		&msg.UpstreamID, &msg.RetryCount, &msg.LastError, &msg.ClientID, &msg.CampaignID, &msg.DeliveryReport,
+		&msg.Encoding, &msg.ProtocolID, &msg.ESMClass, &msg.DataCoding, &msg.SourceTON, &msg.SourceNPI, &msg.DestinationTON,
+		&msg.DestinationNPI, &msg.ServiceType, &msg.BillingInfo, &msg.Cost, &msg.CallbackURL, &msg.Price, &msg.Destination,
+	)
+	if err != nil {
+		return nil, err
+	}
+	msg.ValidityPeriod = time.Duration(validity) * time.Second
+	return &msg, nil
+}
+
+// encodeCursor returns an opaque pagination cursor for the last message of a page
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	return id, nil
+}
@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"smsc/internal/models"
+)
+
+const moColumns = `id, source, destination, content, data_coding, origin, operator_id,
+	upstream_message_id, rule_id, keyword, system_id, url, status, attempts, last_error,
+	next_attempt_at, received_at, delivered_at`
+
+// MOFilter selects mobile-originated messages. Zero fields are ignored.
+type MOFilter struct {
+	Source      string
+	Destination string
+	SystemID    string
+	Status      models.MOStatus
+	Limit       int
+	Cursor      string
+}
+
+// InsertMO stores a mobile-originated message and sets its ID
+func (d *Database) InsertMO(ctx context.Context, mo *models.MOMessage) error {
+	err := d.db.QueryRowContext(ctx, `INSERT INTO mo_messages (
+			source, destination, content, data_coding, origin, operator_id, upstream_message_id,
+			rule_id, keyword, system_id, url, status, last_error, next_attempt_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, received_at`,
+		mo.Source, mo.Destination, mo.Content, mo.DataCoding, mo.Origin, mo.OperatorID, mo.UpstreamID,
+		mo.RuleID, mo.Keyword, mo.SystemID, mo.URL, mo.Status, mo.LastError, mo.NextAttemptAt,
+	).Scan(&mo.ID, &mo.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert MO message: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueMO locks up to limit queued messages whose next attempt is due by
+// pushing their next attempt out by lease, oldest first
+func (d *Database) ClaimDueMO(ctx context.Context, limit int, lease time.Duration) ([]*models.MOMessage, error) {
+	rows, err := d.db.QueryContext(ctx, `UPDATE mo_messages SET next_attempt_at = $3
+		WHERE id IN (
+			SELECT id FROM mo_messages
+			WHERE status = $1 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+moColumns,
+		models.MOQueued, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim MO messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMO(rows)
+}
+
+// UpdateMO stores the outcome of a delivery attempt
+func (d *Database) UpdateMO(ctx context.Context, mo *models.MOMessage) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE mo_messages SET
+			status = $2, attempts = $3, last_error = $4, next_attempt_at = $5, delivered_at = $6
+		WHERE id = $1`,
+		mo.ID, mo.Status, mo.Attempts, mo.LastError, mo.NextAttemptAt, mo.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to update MO message: %w", err)
+	}
+	return nil
+}
+
+// WakeMO makes the messages queued for an ESME due right away, typically
+// when one of its receivers binds
+func (d *Database) WakeMO(ctx context.Context, systemID string) (int64, error) {
+	res, err := d.db.ExecContext(ctx, `UPDATE mo_messages SET next_attempt_at = CURRENT_TIMESTAMP
+		WHERE status = $1 AND system_id = $2 AND next_attempt_at > CURRENT_TIMESTAMP`,
+		models.MOQueued, systemID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wake MO messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// ExpireMO marks messages still queued after the given time as expired
+func (d *Database) ExpireMO(ctx context.Context, receivedBefore time.Time) (int64, error) {
+	res, err := d.db.ExecContext(ctx, `UPDATE mo_messages SET status = $1, last_error = 'queued too long'
+		WHERE status = $2 AND received_at < $3`,
+		models.MOExpired, models.MOQueued, receivedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire MO messages: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// GetMO returns a mobile-originated message by ID
+func (d *Database) GetMO(ctx context.Context, id int64) (*models.MOMessage, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+moColumns+` FROM mo_messages WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MO message: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMO(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrNotFound
+	}
+	return messages[0], nil
+}
+
+// ListMO returns mobile-originated messages matching the filter, newest
+// first, and the cursor of the next page
+func (d *Database) ListMO(ctx context.Context, filter MOFilter) ([]*models.MOMessage, string, error) {
+	var before int64
+	if filter.Cursor != "" {
+		var err error
+		if before, err = decodeCursor(filter.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT `+moColumns+` FROM mo_messages
+		WHERE ($1 = '' OR source = $1) AND ($2 = '' OR destination = $2)
+			AND ($3 = '' OR system_id = $3) AND ($4 = '' OR status = $4) AND ($5 = 0 OR id < $5)
+		ORDER BY id DESC LIMIT $6`,
+		filter.Source, filter.Destination, filter.SystemID, filter.Status, before, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list MO messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMO(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(messages) > limit {
+		messages = messages[:limit]
+		next = encodeCursor(messages[limit-1].ID)
+	}
+	return messages, next, nil
+}
+
+func scanMO(rows *sql.Rows) ([]*models.MOMessage, error) {
+	messages := make([]*models.MOMessage, 0)
+	for rows.Next() {
+		var mo models.MOMessage
+		err := rows.Scan(&mo.ID, &mo.Source, &mo.Destination, &mo.Content, &mo.DataCoding, &mo.Origin, &mo.OperatorID,
+			&mo.UpstreamID, &mo.RuleID, &mo.Keyword, &mo.SystemID, &mo.URL, &mo.Status, &mo.Attempts, &mo.LastError,
+			&mo.NextAttemptAt, &mo.ReceivedAt, &mo.DeliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan MO message: %w", err)
+		}
+		messages = append(messages, &mo)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read MO messages: %w", err)
+	}
+	return messages, nil
+}
+
+// MORuleRow is an MO rule added through the API. The MO service owns the rule
+// format and stores it as a JSON definition.
+type MORuleRow struct {
+	ID         int64
+	Definition json.RawMessage
+}
+
+// ListMORules returns the stored MO rules ordered by ID
+func (d *Database) ListMORules(ctx context.Context) ([]MORuleRow, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT id, definition FROM mo_rules ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MO rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]MORuleRow, 0)
+	for rows.Next() {
+		var r MORuleRow
+		if err := rows.Scan(&r.ID, &r.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan MO rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list MO rules: %w", err)
+	}
+	return rules, nil
+}
+
+// InsertMORule stores a new MO rule and returns its ID
+func (d *Database) InsertMORule(ctx context.Context, definition json.RawMessage) (int64, error) {
+	var id int64
+	err := d.db.QueryRowContext(ctx, `INSERT INTO mo_rules (definition) VALUES ($1) RETURNING id`,
+		[]byte(definition),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert MO rule: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateMORule replaces the definition of a stored MO rule
+func (d *Database) UpdateMORule(ctx context.Context, id int64, definition json.RawMessage) error {
+	res, err := d.db.ExecContext(ctx, `UPDATE mo_rules SET definition = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		id, []byte(definition),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update MO rule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteMORule removes a stored MO rule
+func (d *Database) DeleteMORule(ctx context.Context, id int64) error {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM mo_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete MO rule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"smsc/internal/models"
+)
+
+const priceListColumns = `id, name, entries, tiers, created_at, updated_at`
+
+// marginGroups maps the groupings of a margin report to message columns
+var marginGroups = map[string]string{
+	"customer":    "client_id",
+	"destination": "destination",
+	"operator":    "operator_id",
+}
+
+// MarginFilter selects the messages of a margin report. Zero fields are ignored.
+type MarginFilter struct {
+	GroupBy  string // "customer", "destination" or "operator"
+	ClientID string
+	From     time.Time
+	To       time.Time
+}
+
+// CreatePriceList stores a new price list
+func (d *Database) CreatePriceList(ctx context.Context, l *models.PriceList) error {
+	entries, tiers, err := priceListJSON(l)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.QueryRowContext(ctx, `INSERT INTO price_lists (id, name, entries, tiers)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at, updated_at`,
+		l.ID, l.Name, entries, tiers,
+	).Scan(&l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create price list: %w", err)
+	}
+	return nil
+}
+
+// UpdatePriceList stores the name, entries and tiers of a price list
+func (d *Database) UpdatePriceList(ctx context.Context, l *models.PriceList) error {
+	entries, tiers, err := priceListJSON(l)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.QueryRowContext(ctx, `UPDATE price_lists SET
+			name = $2, entries = $3, tiers = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING created_at, updated_at`,
+		l.ID, l.Name, entries, tiers,
+	).Scan(&l.CreatedAt, &l.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update price list: %w", err)
+	}
+	return nil
+}
+
+// ListPriceLists returns every price list ordered by ID
+func (d *Database) ListPriceLists(ctx context.Context) ([]*models.PriceList, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+priceListColumns+` FROM price_lists ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list price lists: %w", err)
+	}
+	defer rows.Close()
+
+	lists := make([]*models.PriceList, 0)
+	for rows.Next() {
+		l, err := scanPriceList(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan price list: %w", err)
+		}
+		lists = append(lists, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list price lists: %w", err)
+	}
+	return lists, nil
+}
+
+// MarginReport sums the revenue and cost of the messages matching the filter
+// per customer, destination or operator. Refunded messages bring no revenue.
+func (d *Database) MarginReport(ctx context.Context, filter MarginFilter) ([]models.MarginRow, error) {
+	column, ok := marginGroups[filter.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported margin report grouping: %s", filter.GroupBy)
+	}
+
+	var (
+		where []string
+		args  []interface{}
+	)
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	// The first argument is the charge state excluded from the revenue
+	args = append(args, models.ChargeRefunded)
+	if filter.ClientID != "" {
+		add("client_id = $%d", filter.ClientID)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < $%d", filter.To)
+	}
+
+	query := `SELECT ` + column + `, COUNT(*),
+			COALESCE(SUM(price) FILTER (WHERE billing_info <> $1), 0), COALESCE(SUM(cost), 0)
+		FROM messages`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` GROUP BY ` + column + ` ORDER BY ` + column
+
+	rows, err := d.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build margin report: %w", err)
+	}
+	defer rows.Close()
+
+	report := make([]models.MarginRow, 0)
+	for rows.Next() {
+		var r models.MarginRow
+		if err := rows.Scan(&r.Key, &r.Messages, &r.Revenue, &r.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan margin report row: %w", err)
+		}
+		r.Margin = r.Revenue - r.Cost
+		report = append(report, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to build margin report: %w", err)
+	}
+	return report, nil
+}
+
+func priceListJSON(l *models.PriceList) ([]byte, []byte, error) {
+	entries := l.Entries
+	if entries == nil {
+		entries = []models.PriceEntry{}
+	}
+	tiers := l.Tiers
+	if tiers == nil {
+		tiers = []models.VolumeTier{}
+	}
+
+	e, err := json.Marshal(entries)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode price list entries: %w", err)
+	}
+	t, err := json.Marshal(tiers)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode price list tiers: %w", err)
+	}
+	return e, t, nil
+}
+
+func scanPriceList(row scanner) (*models.PriceList, error) {
+	var (
+		l              models.PriceList
+		entries, tiers []byte
+	)
+	if err := row.Scan(&l.ID, &l.Name, &entries, &tiers, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(entries, &l.Entries); err != nil {
+		return nil, fmt.Errorf("failed to decode price list entries: %w", err)
+	}
+	if err := json.Unmarshal(tiers, &l.Tiers); err != nil {
+		return nil, fmt.Errorf("failed to decode price list tiers: %w", err)
+	}
+	return &l, nil
+}
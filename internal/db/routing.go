@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// RoutingRuleRow is a routing rule added through the API. The routing
+// service owns the rule format and stores it as a JSON definition.
+type RoutingRuleRow struct {
+	ID         int64
+	Definition json.RawMessage
+}
+
+// ListRoutingRules returns the stored routing rules ordered by ID
+func (d *Database) ListRoutingRules(ctx context.Context) ([]RoutingRuleRow, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT id, definition FROM routing_rules WHERE definition IS NOT NULL ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routing rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]RoutingRuleRow, 0)
+	for rows.Next() {
+		var r RoutingRuleRow
+		if err := rows.Scan(&r.ID, &r.Definition); err != nil {
+			return nil, fmt.Errorf("failed to scan routing rule: %w", err)
+		}
+		rules = append(rules, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list routing rules: %w", err)
+	}
+	return rules, nil
+}
+
+// InsertRoutingRule stores a new routing rule and returns its ID
+func (d *Database) InsertRoutingRule(ctx context.Context, pattern string, priority int, definition json.RawMessage) (int64, error) {
+	var id int64
+	err := d.db.QueryRowContext(ctx, `INSERT INTO routing_rules (pattern, priority, definition)
+		VALUES ($1, $2, $3)
+		RETURNING id`,
+		pattern, priority, []byte(definition),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert routing rule: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateRoutingRule replaces the definition of a stored routing rule
+func (d *Database) UpdateRoutingRule(ctx context.Context, id int64, pattern string, priority int, definition json.RawMessage) error {
+	res, err := d.db.ExecContext(ctx, `UPDATE routing_rules SET pattern = $2, priority = $3, definition = $4
+		WHERE id = $1 AND definition IS NOT NULL`,
+		id, pattern, priority, []byte(definition),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update routing rule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteRoutingRule removes a stored routing rule
+func (d *Database) DeleteRoutingRule(ctx context.Context, id int64) error {
+	res, err := d.db.ExecContext(ctx, `DELETE FROM routing_rules WHERE id = $1 AND definition IS NOT NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete routing rule: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RoutePlanRow is a route plan created through the API
+type RoutePlanRow struct {
+	Name         string
+	DefaultRoute string
+}
+
+// ListRoutePlans returns the stored route plans ordered by name
+func (d *Database) ListRoutePlans(ctx context.Context) ([]RoutePlanRow, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT name, default_route FROM route_plans ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list route plans: %w", err)
+	}
+	defer rows.Close()
+
+	plans := make([]RoutePlanRow, 0)
+	for rows.Next() {
+		var p RoutePlanRow
+		if err := rows.Scan(&p.Name, &p.DefaultRoute); err != nil {
+			return nil, fmt.Errorf("failed to scan route plan: %w", err)
+		}
+		plans = append(plans, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list route plans: %w", err)
+	}
+	return plans, nil
+}
+
+// SaveRoutePlan creates a route plan or updates its default route
+func (d *Database) SaveRoutePlan(ctx context.Context, name, defaultRoute string) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO route_plans (name, default_route) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET default_route = EXCLUDED.default_route, updated_at = CURRENT_TIMESTAMP`,
+		name, defaultRoute,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save route plan: %w", err)
+	}
+	return nil
+}
+
+// DeleteRoutePlan removes a stored route plan together with its stored rules
+// and client assignments
+func (d *Database) DeleteRoutePlan(ctx context.Context, name string) error {
+	return d.Transaction(ctx, func(tx *sql.Tx) error {
+		queries := []string{
+			`DELETE FROM routing_rules WHERE definition->>'plan' = $1`,
+			`DELETE FROM route_plan_assignments WHERE plan = $1`,
+			`DELETE FROM route_plans WHERE name = $1`,
+		}
+		for _, query := range queries {
+			if _, err := tx.ExecContext(ctx, query, name); err != nil {
+				return fmt.Errorf("failed to delete route plan: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// ListRoutePlanAssignments returns the stored route plan of each client
+func (d *Database) ListRoutePlanAssignments(ctx context.Context) (map[string]string, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT client_id, plan FROM route_plan_assignments`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list route plan assignments: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := make(map[string]string)
+	for rows.Next() {
+		var client, plan string
+		if err := rows.Scan(&client, &plan); err != nil {
+			return nil, fmt.Errorf("failed to scan route plan assignment: %w", err)
+		}
+		assignments[client] = plan
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list route plan assignments: %w", err)
+	}
+	return assignments, nil
+}
+
+// AssignRoutePlan stores the route plan of a client
+func (d *Database) AssignRoutePlan(ctx context.Context, clientID, plan string) error {
+	_, err := d.db.ExecContext(ctx, `INSERT INTO route_plan_assignments (client_id, plan) VALUES ($1, $2)
+		ON CONFLICT (client_id) DO UPDATE SET plan = EXCLUDED.plan, updated_at = CURRENT_TIMESTAMP`,
+		clientID, plan,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to assign route plan: %w", err)
+	}
+	return nil
+}
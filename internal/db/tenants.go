@@ -0,0 +1,205 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"smsc/internal/models"
+)
+
+// ErrQuotaExceeded is returned when a message would exceed the quota of its client
+var ErrQuotaExceeded = errors.New("tenant message quota exceeded")
+
+const tenantColumns = `id, name, system_ids, sender_ids, route_plan, prices, daily_quota, monthly_quota,
+	max_tps, disabled, created_at, updated_at, price_list`
+
+// CreateTenant stores a new tenant
+func (d *Database) CreateTenant(ctx context.Context, t *models.Tenant) error {
+	cols, err := tenantJSON(t)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.QueryRowContext(ctx, `INSERT INTO tenants
+			(id, name, system_ids, sender_ids, route_plan, prices, daily_quota, monthly_quota, max_tps, disabled,
+			price_list)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING created_at, updated_at`,
+		t.ID, t.Name, cols.systemIDs, cols.senderIDs, t.RoutePlan, cols.prices, t.DailyQuota, t.MonthlyQuota,
+		t.MaxTPS, t.Disabled, t.PriceList,
+	).Scan(&t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create tenant: %w", err)
+	}
+	return nil
+}
+
+// UpdateTenant stores the settings of a tenant
+func (d *Database) UpdateTenant(ctx context.Context, t *models.Tenant) error {
+	cols, err := tenantJSON(t)
+	if err != nil {
+		return err
+	}
+
+	err = d.db.QueryRowContext(ctx, `UPDATE tenants SET
+			name = $2, system_ids = $3, sender_ids = $4, route_plan = $5, prices = $6, daily_quota = $7,
+			monthly_quota = $8, max_tps = $9, disabled = $10, price_list = $11, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`,
+		t.ID, t.Name, cols.systemIDs, cols.senderIDs, t.RoutePlan, cols.prices, t.DailyQuota,
+		t.MonthlyQuota, t.MaxTPS, t.Disabled, t.PriceList,
+	).Scan(&t.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update tenant: %w", err)
+	}
+	return nil
+}
+
+// ListTenants returns every tenant ordered by ID
+func (d *Database) ListTenants(ctx context.Context) ([]*models.Tenant, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+tenantColumns+` FROM tenants ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	tenants := make([]*models.Tenant, 0)
+	for rows.Next() {
+		t, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %w", err)
+		}
+		tenants = append(tenants, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	return tenants, nil
+}
+
+// ClientUsage returns the number of messages of a client stored since day
+// and since month, the starts of the current quota periods
+func (d *Database) ClientUsage(ctx context.Context, clientID string, day, month time.Time) (models.TenantUsage, error) {
+	usage := models.TenantUsage{TenantID: clientID}
+	rows, err := d.db.QueryContext(ctx, `SELECT period, count FROM tenant_usage
+		WHERE client_id = $1 AND ((period = 'day' AND starts_at = $2) OR (period = 'month' AND starts_at = $3))`,
+		clientID, day, month)
+	if err != nil {
+		return usage, fmt.Errorf("failed to get client usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			period string
+			count  int64
+		)
+		if err := rows.Scan(&period, &count); err != nil {
+			return usage, fmt.Errorf("failed to scan client usage: %w", err)
+		}
+		if period == "day" {
+			usage.Day = count
+		} else {
+			usage.Month = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return usage, fmt.Errorf("failed to get client usage: %w", err)
+	}
+	return usage, nil
+}
+
+// countQuota counts a message against the quota periods of its client and
+// returns ErrQuotaExceeded when either is used up. The counters stay locked
+// until the transaction ends, so concurrent messages of the client, on any
+// instance, are counted one after the other.
+func countQuota(ctx context.Context, tx *sql.Tx, clientID string, q *models.Quota) error {
+	periods := []struct {
+		name, label string
+		start       time.Time
+		limit       int64
+	}{
+		{"day", "daily", q.Day, q.DailyLimit},
+		{"month", "monthly", q.Month, q.MonthlyLimit},
+	}
+	for _, p := range periods {
+		var count int64
+		err := tx.QueryRowContext(ctx, `INSERT INTO tenant_usage (client_id, period, starts_at, count)
+			VALUES ($1, $2, $3, 1)
+			ON CONFLICT (client_id, period, starts_at) DO UPDATE SET count = tenant_usage.count + 1
+			WHERE $4 <= 0 OR tenant_usage.count < $4
+			RETURNING count`,
+			clientID, p.name, p.start, p.limit,
+		).Scan(&count)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s quota of %d messages", ErrQuotaExceeded, p.label, p.limit)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to count message quota: %w", err)
+		}
+	}
+	return nil
+}
+
+// tenantColumnValues holds the JSONB encoded columns of a tenant
+type tenantColumnValues struct {
+	systemIDs, senderIDs, prices []byte
+}
+
+func tenantJSON(t *models.Tenant) (tenantColumnValues, error) {
+	var (
+		cols tenantColumnValues
+		err  error
+	)
+	if cols.systemIDs, err = json.Marshal(nonNil(t.SystemIDs)); err != nil {
+		return cols, fmt.Errorf("failed to encode tenant system IDs: %w", err)
+	}
+	if cols.senderIDs, err = json.Marshal(nonNil(t.SenderIDs)); err != nil {
+		return cols, fmt.Errorf("failed to encode tenant sender IDs: %w", err)
+	}
+	prices := t.Prices
+	if prices == nil {
+		prices = map[string]float64{}
+	}
+	if cols.prices, err = json.Marshal(prices); err != nil {
+		return cols, fmt.Errorf("failed to encode tenant prices: %w", err)
+	}
+	return cols, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func scanTenant(row scanner) (*models.Tenant, error) {
+	var (
+		t                            models.Tenant
+		systemIDs, senderIDs, prices []byte
+	)
+	err := row.Scan(&t.ID, &t.Name, &systemIDs, &senderIDs, &t.RoutePlan, &prices, &t.DailyQuota, &t.MonthlyQuota,
+		&t.MaxTPS, &t.Disabled, &t.CreatedAt, &t.UpdatedAt, &t.PriceList)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(systemIDs, &t.SystemIDs); err != nil {
+		return nil, fmt.Errorf("failed to decode tenant system IDs: %w", err)
+	}
+	if err := json.Unmarshal(senderIDs, &t.SenderIDs); err != nil {
+		return nil, fmt.Errorf("failed to decode tenant sender IDs: %w", err)
+	}
+	if err := json.Unmarshal(prices, &t.Prices); err != nil {
+		return nil, fmt.Errorf("failed to decode tenant prices: %w", err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"smsc/internal/models"
+)
+
+const deliveryColumns = `id, message_id, client_id, url, event, payload, status, attempts,
+	last_code, last_error, next_attempt_at, created_at, delivered_at`
+
+// DeliveryFilter selects webhook deliveries. Zero fields are ignored.
+type DeliveryFilter struct {
+	MessageID int64
+	ClientID  string
+	Status    models.DeliveryStatus
+	Limit     int
+	Cursor    string
+}
+
+// CreateDelivery stores a pending webhook delivery and sets its ID
+func (d *Database) CreateDelivery(ctx context.Context, w *models.WebhookDelivery) error {
+	err := d.db.QueryRowContext(ctx, `INSERT INTO webhook_deliveries
+			(message_id, client_id, url, event, payload, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		w.MessageID, w.ClientID, w.URL, w.Event, w.Payload, w.Status, w.NextAttemptAt,
+	).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries locks up to limit pending deliveries whose next attempt
+// is due by pushing their next attempt out by lease, so that concurrent
+// workers and instances never send the same delivery twice
+func (d *Database) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]*models.WebhookDelivery, error) {
+	rows, err := d.db.QueryContext(ctx, `UPDATE webhook_deliveries SET next_attempt_at = $3
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = $1 AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		models.DeliveryPending, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDeliveries(rows)
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt
+func (d *Database) UpdateDelivery(ctx context.Context, w *models.WebhookDelivery) error {
+	_, err := d.db.ExecContext(ctx, `UPDATE webhook_deliveries SET
+			status = $2, attempts = $3, last_code = $4, last_error = $5,
+			next_attempt_at = $6, delivered_at = $7
+		WHERE id = $1`,
+		w.ID, w.Status, w.Attempts, w.LastCode, w.LastError, w.NextAttemptAt, w.DeliveredAt)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetDelivery returns a webhook delivery by ID
+func (d *Database) GetDelivery(ctx context.Context, id int64) (*models.WebhookDelivery, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return nil, ErrNotFound
+	}
+	return deliveries[0], nil
+}
+
+// ListDeliveries returns webhook deliveries matching the filter, newest
+// first, and the cursor of the next page
+func (d *Database) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]*models.WebhookDelivery, string, error) {
+	var before int64
+	if filter.Cursor != "" {
+		var err error
+		if before, err = decodeCursor(filter.Cursor); err != nil {
+			return nil, "", err
+		}
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE ($1 = 0 OR message_id = $1) AND ($2 = '' OR client_id = $2)
+			AND ($3 = '' OR status = $3) AND ($4 = 0 OR id < $4)
+		ORDER BY id DESC LIMIT $5`,
+		filter.MessageID, filter.ClientID, filter.Status, before, limit+1)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries, err := scanDeliveries(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next = encodeCursor(deliveries[limit-1].ID)
+	}
+	return deliveries, next, nil
+}
+
+// ReplayDeliveries resets failed deliveries, or a single delivery when id is
+// set, to be sent again right away. It returns the number of deliveries reset.
+func (d *Database) ReplayDeliveries(ctx context.Context, id int64, clientID string) (int64, error) {
+	res, err := d.db.ExecContext(ctx, `UPDATE webhook_deliveries SET
+			status = $1, attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE status = $2 AND ($3 = 0 OR id = $3) AND ($4 = '' OR client_id = $4)`,
+		models.DeliveryPending, models.DeliveryFailed, id, clientID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay webhook deliveries: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]*models.WebhookDelivery, error) {
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for rows.Next() {
+		var w models.WebhookDelivery
+		err := rows.Scan(&w.ID, &w.MessageID, &w.ClientID, &w.URL, &w.Event, &w.Payload, &w.Status, &w.Attempts,
+			&w.LastCode, &w.LastError, &w.NextAttemptAt, &w.CreatedAt, &w.DeliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, &w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
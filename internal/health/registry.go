@@ -0,0 +1,155 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Status is the health state of a component
+type Status string
+
+const (
+	StatusUp      Status = "up"
+	StatusDown    Status = "down"
+	StatusUnknown Status = "unknown"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// CheckFunc reports whether a component is healthy
+type CheckFunc func(ctx context.Context) error
+
+// ComponentStatus is the result of the latest check of a component
+type ComponentStatus struct {
+	Name        string     `json:"name"`
+	Status      Status     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LatencyMS   float64    `json:"latencyMs"`
+	CheckedAt   time.Time  `json:"checkedAt"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// Report is the aggregated health of all registered components. The overall
+// status is down as soon as one critical component is down.
+type Report struct {
+	Status     Status            `json:"status"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+	Components []ComponentStatus `json:"components"`
+}
+
+type component struct {
+	check  CheckFunc
+	status ComponentStatus
+}
+
+// Registry holds the health checks of the gateway components
+type Registry struct {
+	mu         sync.Mutex
+	timeout    time.Duration
+	components []*component
+}
+
+// NewRegistry creates an empty registry running each check with the given timeout
+func NewRegistry(timeout time.Duration) *Registry {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a component check. Critical components decide readiness;
+// the others are only reported.
+func (r *Registry) Register(name string, critical bool, check CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.components = append(r.components, &component{
+		check: check,
+		status: ComponentStatus{
+			Name:     name,
+			Status:   StatusUnknown,
+			Critical: critical,
+		},
+	})
+}
+
+// Check runs all component checks concurrently and returns the report
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.Lock()
+	components := make([]*component, len(r.components))
+	copy(components, r.components)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	results := make([]ComponentStatus, len(components))
+	for i, c := range components {
+		wg.Add(1)
+		go func(i int, c *component) {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:     StatusUp,
+		CheckedAt:  time.Now(),
+		Components: results,
+	}
+	for _, c := range results {
+		if c.Critical && c.Status != StatusUp {
+			report.Status = StatusDown
+			break
+		}
+	}
+
+	return report
+}
+
+// run executes a single check, recording its latency and last error
+func (r *Registry) run(ctx context.Context, c *component) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := safeCheck(ctx, c.check)
+	latency := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c.status.CheckedAt = start
+	c.status.LatencyMS = float64(latency.Microseconds()) / 1000
+	if err != nil {
+		c.status.Status = StatusDown
+		c.status.LastError = err.Error()
+		c.status.LastErrorAt = &start
+	} else {
+		c.status.Status = StatusUp
+	}
+
+	return c.status
+}
+
+// safeCheck runs a check, turning panics and timeouts into errors
+func safeCheck(ctx context.Context, check CheckFunc) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- fmt.Errorf("health check panicked: %v", p)
+			}
+		}()
+		done <- check(ctx)
+	}()
+
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check timed out: %w", ctx.Err())
+	}
+}
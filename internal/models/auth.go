@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+)
+
+// Role is the set of permissions granted to a user or API key
+type Role string
+
+const (
+	RoleAdmin   Role = "admin"   // full access, including users and keys
+	RoleNOC     Role = "noc"     // network operations: operators, routes and traffic
+	RoleSupport Role = "support" // read-only access to everything
+	RoleTenant  Role = "tenant"  // a customer, scoped to its own client ID
+)
+
+// Valid reports whether the role is known
+func (r Role) Valid() bool {
+	switch r {
+	case RoleAdmin, RoleNOC, RoleSupport, RoleTenant:
+		return true
+	}
+	return false
+}
+
+// User is an operator or customer account that logs in to the REST API
+type User struct {
+	ID           int64      `json:"id" db:"id"`
+	Username     string     `json:"username" db:"username"`
+	PasswordHash string     `json:"-" db:"password_hash"`
+	Role         Role       `json:"role" db:"role"`
+	ClientID     string     `json:"client_id,omitempty" db:"client_id"`
+	Disabled     bool       `json:"disabled" db:"disabled"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
+
+// APIKey is a long-lived credential of a machine client. Only a hash of the
+// key is stored; Prefix identifies the key in listings and lookups.
+type APIKey struct {
+	ID         int64      `json:"id" db:"id"`
+	Name       string     `json:"name" db:"name"`
+	Role       Role       `json:"role" db:"role"`
+	ClientID   string     `json:"client_id,omitempty" db:"client_id"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Hash       string     `json:"-" db:"hash"`
+	CreatedBy  string     `json:"created_by,omitempty" db:"created_by"`
+	RotatedTo  *int64     `json:"rotated_to,omitempty" db:"rotated_to"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// Active reports whether the key can still be used at the given time
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
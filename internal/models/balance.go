@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// Charge states of a message kept in its billing info. Messages without a
+// charge state are not charged to a prepaid balance.
+const (
+	ChargeReserved = "reserved" // price held from the balance until the outcome is known
+	ChargeCharged  = "charged"
+	ChargeRefunded = "refunded"
+)
+
+// Balance is the prepaid account of a client. Messages of clients with a
+// balance are charged as they are submitted.
+type Balance struct {
+	ClientID  string    `json:"client_id" db:"client_id"`
+	Available float64   `json:"available" db:"available"` // funds left for new messages
+	Reserved  float64   `json:"reserved" db:"reserved"`   // held for messages not settled yet
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TransactionType is the kind of a balance change
+type TransactionType string
+
+const (
+	TransactionTopUp      TransactionType = "topup"
+	TransactionAdjustment TransactionType = "adjustment"
+	TransactionReserve    TransactionType = "reserve"
+	TransactionCharge     TransactionType = "charge"
+	TransactionRefund     TransactionType = "refund"
+)
+
+// BalanceTransaction is an entry in the ledger of a prepaid account
+type BalanceTransaction struct {
+	ID        int64           `json:"id" db:"id"`
+	ClientID  string          `json:"client_id" db:"client_id"`
+	Type      TransactionType `json:"type" db:"type"`
+	Amount    float64         `json:"amount" db:"amount"`       // negative when taken from the account
+	Available float64         `json:"available" db:"available"` // available balance after the change
+	MessageID *int64          `json:"message_id,omitempty" db:"message_id"`
+	Note      string          `json:"note,omitempty" db:"note"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// BatchStatus represents the processing state of a batch
+type BatchStatus string
+
+const (
+	BatchProcessing  BatchStatus = "processing"
+	BatchCompleted   BatchStatus = "completed"
+	BatchInterrupted BatchStatus = "interrupted"
+)
+
+// RecipientStatus is the outcome of a single batch recipient
+type RecipientStatus string
+
+const (
+	RecipientPending   RecipientStatus = "pending"
+	RecipientQueued    RecipientStatus = "queued"
+	RecipientInvalid   RecipientStatus = "invalid"
+	RecipientDuplicate RecipientStatus = "duplicate"
+	RecipientFailed    RecipientStatus = "failed"
+)
+
+// Batch is a bulk send of one template to many recipients
+type Batch struct {
+	ID          int64       `json:"id" db:"id"`
+	ClientID    string      `json:"client_id" db:"client_id"`
+	Sender      string      `json:"sender" db:"sender"`
+	Template    string      `json:"template" db:"template"`
+	Status      BatchStatus `json:"status" db:"status"`
+	Total       int         `json:"total" db:"total"`
+	Processed   int         `json:"processed" db:"processed"`
+	Queued      int         `json:"queued" db:"queued"`
+	Invalid     int         `json:"invalid" db:"invalid"`
+	Duplicates  int         `json:"duplicates" db:"duplicates"`
+	Failed      int         `json:"failed" db:"failed"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// BatchRecipient records the outcome of one recipient of a batch
+type BatchRecipient struct {
+	ID        int64           `json:"id" db:"id"`
+	BatchID   int64           `json:"batch_id" db:"batch_id"`
+	Recipient string          `json:"recipient" db:"recipient"`
+	Status    RecipientStatus `json:"status" db:"status"`
+	MessageID *int64          `json:"message_id,omitempty" db:"message_id"`
+	Error     string          `json:"error,omitempty" db:"error"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+)
+
+// CampaignStatus represents the lifecycle state of a campaign
+type CampaignStatus string
+
+const (
+	CampaignDraft     CampaignStatus = "draft"
+	CampaignScheduled CampaignStatus = "scheduled"
+	CampaignRunning   CampaignStatus = "running"
+	CampaignPaused    CampaignStatus = "paused"
+	CampaignCompleted CampaignStatus = "completed"
+	CampaignCancelled CampaignStatus = "cancelled"
+)
+
+// QuietHours is a daily period in which a campaign sends nothing. End may be
+// before Start for periods spanning midnight.
+type QuietHours struct {
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM
+	Timezone string `json:"timezone,omitempty"` // IANA zone, UTC when empty
+}
+
+// Campaign sends a message template to an audience under a schedule, a
+// throttle rate, quiet hours and a budget cap
+type Campaign struct {
+	ID             int64          `json:"id" db:"id"`
+	Name           string         `json:"name" db:"name"`
+	ClientID       string         `json:"client_id" db:"client_id"`
+	Sender         string         `json:"sender" db:"sender"`
+	Template       string         `json:"template" db:"template"`
+	Status         CampaignStatus `json:"status" db:"status"`
+	StatusReason   string         `json:"status_reason,omitempty" db:"status_reason"`
+	StartAt        *time.Time     `json:"start_at,omitempty" db:"start_at"`
+	Throttle       int            `json:"throttle" db:"throttle"` // messages per second, 0 for unlimited
+	QuietHours     *QuietHours    `json:"quiet_hours,omitempty"`
+	BudgetCap      float64        `json:"budget_cap" db:"budget_cap"` // 0 for no cap
+	Priority       int            `json:"priority" db:"priority"`
+	ValidityPeriod int            `json:"validity_period" db:"validity_period"` // seconds
+	CallbackURL    string         `json:"callback_url,omitempty" db:"callback_url"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" db:"updated_at"`
+	StartedAt      *time.Time     `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt    *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// CampaignRecipient is a member of a campaign audience
+type CampaignRecipient struct {
+	ID         int64             `json:"id" db:"id"`
+	CampaignID int64             `json:"campaign_id" db:"campaign_id"`
+	Recipient  string            `json:"recipient" db:"recipient"`
+	Variables  map[string]string `json:"variables,omitempty" db:"variables"`
+	Status     RecipientStatus   `json:"status" db:"status"`
+	MessageID  *int64            `json:"message_id,omitempty" db:"message_id"`
+	Error      string            `json:"error,omitempty" db:"error"`
+}
+
+// CampaignStats aggregates the audience and delivery state of a campaign
+type CampaignStats struct {
+	CampaignID int64                   `json:"campaign_id"`
+	Audience   map[RecipientStatus]int `json:"audience"`
+	Messages   map[MessageStatus]int   `json:"messages"`
+	Spent      float64                 `json:"spent"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+)
+
+// CDR is the call detail record of a message, written once when it reaches a
+// final status and never changed afterwards
+type CDR struct {
+	ID            int64         `json:"id" db:"id"`
+	MessageID     int64         `json:"message_id" db:"message_id"`
+	SMPPMessageID string        `json:"smpp_message_id" db:"smpp_message_id"`
+	UpstreamID    string        `json:"upstream_message_id" db:"upstream_message_id"`
+	ClientID      string        `json:"client_id" db:"client_id"`
+	CampaignID    string        `json:"campaign_id,omitempty" db:"campaign_id"`
+	Sender        string        `json:"sender" db:"sender"`
+	Recipient     string        `json:"recipient" db:"recipient"`
+	Country       string        `json:"country" db:"country"` // calling code of the recipient
+	Destination   string        `json:"destination" db:"destination"`
+	OperatorID    string        `json:"operator_id" db:"operator_id"`
+	Status        MessageStatus `json:"status" db:"status"`
+	Error         string        `json:"error,omitempty" db:"error"`
+	Segments      int           `json:"segments" db:"segments"`
+	Encoding      string        `json:"encoding" db:"encoding"`
+	Cost          float64       `json:"cost" db:"cost"`   // paid to the operator
+	Price         float64       `json:"price" db:"price"` // charged to the client
+	Charge        string        `json:"charge,omitempty" db:"charge"`
+	SubmittedAt   time.Time     `json:"submitted_at" db:"submitted_at"`
+	SentAt        *time.Time    `json:"sent_at,omitempty" db:"sent_at"`
+	DeliveredAt   *time.Time    `json:"delivered_at,omitempty" db:"delivered_at"`
+	CompletedAt   time.Time     `json:"completed_at" db:"completed_at"` // when the final status was reached
+}
+
+// TenantCDR is a CDR as shown to tenants, without the operator the message
+// was sent through and what it cost
+type TenantCDR struct {
+	ID            int64         `json:"id"`
+	MessageID     int64         `json:"message_id"`
+	SMPPMessageID string        `json:"smpp_message_id"`
+	ClientID      string        `json:"client_id"`
+	CampaignID    string        `json:"campaign_id,omitempty"`
+	Sender        string        `json:"sender"`
+	Recipient     string        `json:"recipient"`
+	Country       string        `json:"country"`
+	Destination   string        `json:"destination"`
+	Status        MessageStatus `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	Segments      int           `json:"segments"`
+	Encoding      string        `json:"encoding"`
+	Price         float64       `json:"price"`
+	Charge        string        `json:"charge,omitempty"`
+	SubmittedAt   time.Time     `json:"submitted_at"`
+	SentAt        *time.Time    `json:"sent_at,omitempty"`
+	DeliveredAt   *time.Time    `json:"delivered_at,omitempty"`
+	CompletedAt   time.Time     `json:"completed_at"`
+}
+
+// TenantView returns the CDR as shown to tenants
+func (c *CDR) TenantView() *TenantCDR {
+	return &TenantCDR{
+		ID:            c.ID,
+		MessageID:     c.MessageID,
+		SMPPMessageID: c.SMPPMessageID,
+		ClientID:      c.ClientID,
+		CampaignID:    c.CampaignID,
+		Sender:        c.Sender,
+		Recipient:     c.Recipient,
+		Country:       c.Country,
+		Destination:   c.Destination,
+		Status:        c.Status,
+		Error:         c.Error,
+		Segments:      c.Segments,
+		Encoding:      c.Encoding,
+		Price:         c.Price,
+		Charge:        c.Charge,
+		SubmittedAt:   c.SubmittedAt,
+		SentAt:        c.SentAt,
+		DeliveredAt:   c.DeliveredAt,
+		CompletedAt:   c.CompletedAt,
+	}
+}
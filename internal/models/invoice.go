@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+// UsageLine is the traffic of a tenant to one destination country and
+// network in a statement period
+type UsageLine struct {
+	Country   string  `json:"country"`           // calling code of the recipients
+	Network   string  `json:"network,omitempty"` // set when the price list rates the network
+	Messages  int64   `json:"messages"`
+	Segments  int64   `json:"segments"`
+	Delivered int64   `json:"delivered"`
+	Amount    float64 `json:"amount"` // charged, without refunded messages
+}
+
+// UsageStatement is the monthly usage of a tenant aggregated from its CDRs
+type UsageStatement struct {
+	ClientID string      `json:"client_id"`
+	Period   string      `json:"period"` // YYYY-MM
+	From     time.Time   `json:"from"`
+	To       time.Time   `json:"to"`
+	Lines    []UsageLine `json:"lines"`
+	Messages int64       `json:"messages"`
+	Segments int64       `json:"segments"`
+	Amount   float64     `json:"amount"`
+}
+
+// InvoiceLine is a charged item of an invoice
+type InvoiceLine struct {
+	Description string  `json:"description"`
+	Country     string  `json:"country"`
+	Network     string  `json:"network,omitempty"`
+	Quantity    int64   `json:"quantity"` // messages
+	UnitPrice   float64 `json:"unit_price"`
+	Amount      float64 `json:"amount"`
+}
+
+// InvoiceCredit is an amount taken off an invoice before tax
+type InvoiceCredit struct {
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+}
+
+// Invoice bills the usage of a tenant in one month. Invoices are issued once
+// per tenant and month and not changed afterwards.
+type Invoice struct {
+	ID          int64           `json:"id" db:"id"`
+	Number      string          `json:"number" db:"number"`
+	ClientID    string          `json:"client_id" db:"client_id"`
+	Period      string          `json:"period" db:"period"` // YYYY-MM
+	Currency    string          `json:"currency" db:"currency"`
+	Lines       []InvoiceLine   `json:"lines" db:"lines"`
+	Credits     []InvoiceCredit `json:"credits" db:"credits"`
+	Subtotal    float64         `json:"subtotal" db:"subtotal"`
+	CreditTotal float64         `json:"credit_total" db:"credit_total"`
+	TaxName     string          `json:"tax_name" db:"tax_name"`
+	TaxRate     float64         `json:"tax_rate" db:"tax_rate"` // percent
+	Tax         float64         `json:"tax" db:"tax"`
+	Total       float64         `json:"total" db:"total"`
+	IssuedAt    time.Time       `json:"issued_at" db:"issued_at"`
+}
@@ -9,6 +9,7 @@ type MessageStatus string
 
 const (
 	StatusPending    MessageStatus = "pending"
+	StatusRouted     MessageStatus = "routed" // assigned an operator that cannot be submitted to; final
 	StatusSent       MessageStatus = "sent"
 	StatusDelivered  MessageStatus = "delivered"
 	StatusFailed     MessageStatus = "failed"
@@ -33,6 +34,7 @@ type Message struct {
 	DeliveredAt     *time.Time    `json:"delivered_at,omitempty" db:"delivered_at"`
 	OperatorID      string        `json:"operator_id" db:"operator_id"`
 	MessageID       string        `json:"message_id" db:"message_id"`
+	UpstreamID      string        `json:"upstream_message_id" db:"upstream_message_id"`
 	RetryCount      int           `json:"retry_count" db:"retry_count"`
 	LastError       string        `json:"last_error" db:"last_error"`
 	ClientID        string        `json:"client_id" db:"client_id"`
@@ -48,7 +50,11 @@ type Message struct {
 	DestinationNPI  int           `json:"destination_npi" db:"destination_npi"`
 	ServiceType     string        `json:"service_type" db:"service_type"`
 	BillingInfo     string        `json:"billing_info" db:"billing_info"`
-	Cost            float64       `json:"cost" db:"cost"`
+	Cost            float64       `json:"cost" db:"cost"`   // paid to the operator
+	Price           float64       `json:"price" db:"price"` // charged to the client
+	Destination     string        `json:"destination,omitempty" db:"destination"`
+	CallbackURL     string        `json:"callback_url,omitempty" db:"callback_url"`
+	Quota           *Quota        `json:"-" db:"-"` // counted when the message is stored
 }
 
 // NewMessage creates a new Message with default values
@@ -96,4 +102,85 @@ func (m *Message) UpdateStatus(status MessageStatus) {
 		now := time.Now()
 		m.DeliveredAt = &now
 	}
-} 
\ No newline at end of file
+}
+
+// EventType identifies a step in a message's lifecycle
+type EventType string
+
+const (
+	EventReceived  EventType = "received"
+	EventQueued    EventType = "queued"
+	EventRouted    EventType = "routed"
+	EventHeld      EventType = "held"
+	EventSubmitted EventType = "submitted"
+	EventRetried   EventType = "retried"
+	EventFailed    EventType = "failed"
+	EventDropped   EventType = "dropped"
+	EventDLR       EventType = "dlr"
+)
+
+// MessageEvent records a step in a message's lifecycle for tracing and support
+type MessageEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	MessageID int64     `json:"message_id" db:"message_id"`
+	Type      EventType `json:"type" db:"type"`
+	Detail    string    `json:"detail,omitempty" db:"detail"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// TenantMessage is a message as shown to tenants, without the operator it
+// was sent through and what it cost
+type TenantMessage struct {
+	ID             int64         `json:"id"`
+	Sender         string        `json:"sender"`
+	Recipient      string        `json:"recipient"`
+	Content        string        `json:"content"`
+	Status         MessageStatus `json:"status"`
+	Priority       int           `json:"priority"`
+	ValidityPeriod time.Duration `json:"validity_period"`
+	ScheduledTime  *time.Time    `json:"scheduled_time,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	SentAt         *time.Time    `json:"sent_at,omitempty"`
+	DeliveredAt    *time.Time    `json:"delivered_at,omitempty"`
+	MessageID      string        `json:"message_id"`
+	RetryCount     int           `json:"retry_count"`
+	LastError      string        `json:"last_error"`
+	ClientID       string        `json:"client_id"`
+	CampaignID     *string       `json:"campaign_id,omitempty"`
+	DeliveryReport string        `json:"delivery_report"`
+	Encoding       string        `json:"encoding"`
+	DataCoding     int           `json:"data_coding"`
+	Price          float64       `json:"price"`
+	Destination    string        `json:"destination,omitempty"`
+	CallbackURL    string        `json:"callback_url,omitempty"`
+}
+
+// TenantView returns the message as shown to tenants
+func (m *Message) TenantView() *TenantMessage {
+	return &TenantMessage{
+		ID:             m.ID,
+		Sender:         m.Sender,
+		Recipient:      m.Recipient,
+		Content:        m.Content,
+		Status:         m.Status,
+		Priority:       m.Priority,
+		ValidityPeriod: m.ValidityPeriod,
+		ScheduledTime:  m.ScheduledTime,
+		CreatedAt:      m.CreatedAt,
+		UpdatedAt:      m.UpdatedAt,
+		SentAt:         m.SentAt,
+		DeliveredAt:    m.DeliveredAt,
+		MessageID:      m.MessageID,
+		RetryCount:     m.RetryCount,
+		LastError:      m.LastError,
+		ClientID:       m.ClientID,
+		CampaignID:     m.CampaignID,
+		DeliveryReport: m.DeliveryReport,
+		Encoding:       m.Encoding,
+		DataCoding:     m.DataCoding,
+		Price:          m.Price,
+		Destination:    m.Destination,
+		CallbackURL:    m.CallbackURL,
+	}
+}
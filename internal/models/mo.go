@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// MOStatus is the delivery state of a mobile-originated message
+type MOStatus string
+
+const (
+	MOQueued     MOStatus = "queued"
+	MODelivered  MOStatus = "delivered"
+	MOFailed     MOStatus = "failed"
+	MOExpired    MOStatus = "expired"
+	MOUnroutable MOStatus = "unroutable"
+)
+
+// Networks a mobile-originated message can arrive from
+const (
+	MOOriginSMPP = "smpp" // deliver_sm on an upstream bind
+	MOOriginMAP  = "map"  // MAP MO-ForwardSM
+	MOOriginHTTP = "http" // posted to the inbound API
+)
+
+// MOMessage is a mobile-originated message and its delivery to a consumer,
+// either a bound ESME receiver (SystemID) or an HTTP endpoint (URL)
+type MOMessage struct {
+	ID            int64      `json:"id" db:"id"`
+	Source        string     `json:"source" db:"source"`
+	Destination   string     `json:"destination" db:"destination"`
+	Content       string     `json:"content" db:"content"`
+	DataCoding    int        `json:"data_coding" db:"data_coding"`
+	Origin        string     `json:"origin" db:"origin"`
+	OperatorID    string     `json:"operator_id,omitempty" db:"operator_id"`
+	UpstreamID    string     `json:"upstream_message_id,omitempty" db:"upstream_message_id"`
+	RuleID        string     `json:"rule_id,omitempty" db:"rule_id"`
+	Keyword       string     `json:"keyword,omitempty" db:"keyword"`
+	SystemID      string     `json:"system_id,omitempty" db:"system_id"`
+	URL           string     `json:"url,omitempty" db:"url"`
+	Status        MOStatus   `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	ReceivedAt    time.Time  `json:"received_at" db:"received_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty" db:"delivered_at"`
+}
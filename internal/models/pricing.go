@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+// PriceList is a customer pricing plan: the sell prices per segment of the
+// destinations a tenant sends to, and the discounts of its volume tiers
+type PriceList struct {
+	ID        string       `json:"id" db:"id"`
+	Name      string       `json:"name" db:"name"`
+	Entries   []PriceEntry `json:"entries" db:"entries"`
+	Tiers     []VolumeTier `json:"tiers,omitempty" db:"tiers"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// PriceEntry is the price per segment of a destination, given by serving
+// network or recipient prefix, while it is effective. An entry with neither
+// network nor prefix prices every destination.
+type PriceEntry struct {
+	Network       string     `json:"network,omitempty"`
+	Prefix        string     `json:"prefix,omitempty"`
+	Price         float64    `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to,omitempty"`
+}
+
+// VolumeTier discounts the prices of a list once a tenant sent a number of
+// messages in the current UTC month
+type VolumeTier struct {
+	MinMessages int64   `json:"min_messages"`
+	Discount    float64 `json:"discount"` // percent taken off the price
+}
+
+// Rating is the sell price computed for a message
+type Rating struct {
+	Destination string  `json:"destination"` // network or prefix of the entry that priced it
+	UnitPrice   float64 `json:"unit_price"`  // price per segment after discounts
+	Discount    float64 `json:"discount"`
+	Segments    int     `json:"segments"`
+	Price       float64 `json:"price"`
+}
+
+// MarginRow is the revenue, cost and margin of a group of messages
+type MarginRow struct {
+	Key      string  `json:"key"`
+	Messages int64   `json:"messages"`
+	Revenue  float64 `json:"revenue"`
+	Cost     float64 `json:"cost"`
+	Margin   float64 `json:"margin"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// Tenant is a customer of the SMSC. Its ID is the client ID that messages,
+// API keys, users, campaigns and webhooks of the customer carry.
+type Tenant struct {
+	ID           string             `json:"id" db:"id"`
+	Name         string             `json:"name" db:"name"`
+	SystemIDs    []string           `json:"system_ids,omitempty" db:"system_ids"` // SMPP accounts of the tenant
+	SenderIDs    []string           `json:"sender_ids,omitempty" db:"sender_ids"` // allowed senders, any when empty
+	RoutePlan    string             `json:"route_plan,omitempty" db:"route_plan"`
+	PriceList    string             `json:"price_list,omitempty" db:"price_list"`
+	Prices       map[string]float64 `json:"prices,omitempty" db:"prices"`     // price per segment by recipient prefix, without a price list
+	DailyQuota   int64              `json:"daily_quota" db:"daily_quota"`     // messages per UTC day, 0 for no quota
+	MonthlyQuota int64              `json:"monthly_quota" db:"monthly_quota"` // messages per UTC month, 0 for no quota
+	MaxTPS       int                `json:"max_tps" db:"max_tps"`             // 0 for no limit
+	Disabled     bool               `json:"disabled" db:"disabled"`
+	CreatedAt    time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// Quota is the message quota a new message is counted against when it is
+// stored. Limits of 0 leave a period unlimited.
+type Quota struct {
+	Day          time.Time // start of the current UTC day
+	Month        time.Time // start of the current UTC month
+	DailyLimit   int64
+	MonthlyLimit int64
+}
+
+// TenantUsage is the message volume of a tenant in the current quota periods
+type TenantUsage struct {
+	TenantID     string `json:"tenant_id"`
+	Day          int64  `json:"day"`
+	Month        int64  `json:"month"`
+	DailyQuota   int64  `json:"daily_quota"`
+	MonthlyQuota int64  `json:"monthly_quota"`
+	MaxTPS       int    `json:"max_tps"`
+}
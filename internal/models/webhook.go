@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliveryDelivered DeliveryStatus = "delivered"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a status callback to a client and its delivery attempts
+type WebhookDelivery struct {
+	ID            int64          `json:"id" db:"id"`
+	MessageID     int64          `json:"message_id" db:"message_id"`
+	ClientID      string         `json:"client_id" db:"client_id"`
+	URL           string         `json:"url" db:"url"`
+	Event         string         `json:"event" db:"event"`
+	Payload       string         `json:"payload" db:"payload"`
+	Status        DeliveryStatus `json:"status" db:"status"`
+	Attempts      int            `json:"attempts" db:"attempts"`
+	LastCode      int            `json:"last_code,omitempty" db:"last_code"`
+	LastError     string         `json:"last_error,omitempty" db:"last_error"`
+	NextAttemptAt time.Time      `json:"next_attempt_at" db:"next_attempt_at"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time     `json:"delivered_at,omitempty" db:"delivered_at"`
+}
@@ -1,11 +1,13 @@
 package sigtran
 
 import (
+	"context"
 	"fmt"
 	"sync"
 
 	"github.com/sirupsen/logrus"
 	"smsc/internal/config"
+	"smsc/internal/models"
 )
 
 // Config holds Sigtran configuration
@@ -27,12 +29,16 @@ type Config struct {
 	}
 }
 
+// MOHandler receives the mobile-originated messages of MAP MO-ForwardSM operations
+type MOHandler func(ctx context.Context, mo *models.MOMessage) error
+
 // Stack represents the Sigtran protocol stack
 type Stack struct {
 	cfg    config.SigtranConfig
 	log    *logrus.Logger
 	mu     sync.Mutex
 	active bool
+	onMO   MOHandler
 }
 
 // New creates a new Sigtran stack
@@ -44,6 +50,14 @@ func New(cfg config.SigtranConfig, log *logrus.Logger) *Stack {
 	}
 }
 
+// SetMOHandler registers the handler of inbound MO-ForwardSM messages
+func (s *Stack) SetMOHandler(handler MOHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onMO = handler
+}
+
 // Start initializes and starts the Sigtran stack
 func (s *Stack) Start() error {
 	s.mu.Lock()
@@ -108,11 +122,28 @@ func (s *Stack) handleMessage(msg []byte) error {
 	// 1. Decode SCCP message
 	// 2. Extract MAP/SMS-specific data
 	// 3. Process message based on type
-	// 4. Route message to appropriate handler
+	// 4. Route message to appropriate handler; MO-ForwardSM is decoded into
+	//    a models.MOMessage with Origin models.MOOriginMAP and passed to s.onMO
 	// 5. Generate and send response
 	return nil
 }
 
+// Active reports whether the Sigtran stack has been started
+func (s *Stack) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+// Check reports an error when the Sigtran stack is not running
+func (s *Stack) Check(ctx context.Context) error {
+	if !s.Active() {
+		return fmt.Errorf("Sigtran stack is not running")
+	}
+	return nil
+}
+
 // Status returns the current status of the Sigtran stack
 func (s *Stack) Status() string {
 	// TODO: Implement status logic
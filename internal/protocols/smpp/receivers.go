@@ -0,0 +1,105 @@
+package smpp
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"smsc/internal/models"
+)
+
+// ErrNotBound is returned when no receiver session of an ESME is bound
+var ErrNotBound = errors.New("no receiver session bound")
+
+// Receiver is a bound receiver or transceiver session that mobile-originated
+// messages are delivered to as deliver_sm
+type Receiver interface {
+	DeliverSM(ctx context.Context, mo *models.MOMessage) error
+}
+
+// BindHandler is called when a receiver session of an ESME binds
+type BindHandler func(systemID string)
+
+// receivers tracks the bound receiver sessions of each ESME
+type receivers struct {
+	mu       sync.RWMutex
+	sessions map[string][]Receiver
+	next     map[string]int
+	onBind   BindHandler
+}
+
+func newReceivers() *receivers {
+	return &receivers{
+		sessions: make(map[string][]Receiver),
+		next:     make(map[string]int),
+	}
+}
+
+// SetBindHandler registers a function called whenever a receiver binds
+func (s *Server) SetBindHandler(handler BindHandler) {
+	s.receivers.mu.Lock()
+	defer s.receivers.mu.Unlock()
+
+	s.receivers.onBind = handler
+}
+
+// AddReceiver registers a bound receiver session of an ESME and returns the
+// function that unregisters it on unbind
+func (s *Server) AddReceiver(systemID string, r Receiver) func() {
+	rs := s.receivers
+
+	rs.mu.Lock()
+	rs.sessions[systemID] = append(rs.sessions[systemID], r)
+	onBind := rs.onBind
+	rs.mu.Unlock()
+
+	s.log.WithField("system_id", systemID).Info("SMPP receiver bound")
+	if onBind != nil {
+		onBind(systemID)
+	}
+
+	return func() {
+		rs.mu.Lock()
+		defer rs.mu.Unlock()
+
+		sessions := rs.sessions[systemID]
+		for i := range sessions {
+			if sessions[i] == r {
+				sessions = append(sessions[:i], sessions[i+1:]...)
+				break
+			}
+		}
+		if len(sessions) == 0 {
+			delete(rs.sessions, systemID)
+			delete(rs.next, systemID)
+			return
+		}
+		rs.sessions[systemID] = sessions
+	}
+}
+
+// Bound reports whether an ESME has a receiver session bound
+func (s *Server) Bound(systemID string) bool {
+	s.receivers.mu.RLock()
+	defer s.receivers.mu.RUnlock()
+
+	return len(s.receivers.sessions[systemID]) > 0
+}
+
+// DeliverMO sends a mobile-originated message to one of the bound receiver
+// sessions of an ESME, round robin, and returns ErrNotBound when there is none
+func (s *Server) DeliverMO(ctx context.Context, systemID string, mo *models.MOMessage) error {
+	rs := s.receivers
+
+	rs.mu.Lock()
+	sessions := rs.sessions[systemID]
+	if len(sessions) == 0 {
+		rs.mu.Unlock()
+		return ErrNotBound
+	}
+	r := sessions[rs.next[systemID]%len(sessions)]
+	rs.next[systemID]++
+	rs.mu.Unlock()
+
+	return r.DeliverSM(ctx, mo)
+}
@@ -1,28 +1,36 @@
 package smpp
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"smsc/internal/config"
+	"smsc/internal/tracing"
 )
 
 type Server struct {
-	cfg    config.SMPPConfig
-	log    *logrus.Logger
-	ln     net.Listener
-	tlsLn  net.Listener
-	mu     sync.Mutex
-	active bool
+	cfg       config.SMPPConfig
+	log       *logrus.Logger
+	ln        net.Listener
+	tlsLn     net.Listener
+	mu        sync.Mutex
+	active    bool
+	sessions  int64
+	receivers *receivers
+	throttler throttler
 }
 
 func New(cfg config.SMPPConfig, log *logrus.Logger) *Server {
 	return &Server{
-		cfg:    cfg,
-		log:    log,
-		active: false,
+		cfg:       cfg,
+		log:       log,
+		active:    false,
+		receivers: newReceivers(),
 	}
 }
 
@@ -100,16 +108,47 @@ func (s *Server) acceptConnections() {
 	}
 }
 
+// Active reports whether the SMPP listeners are running
+func (s *Server) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+// Check reports an error when the SMPP listeners are not running
+func (s *Server) Check(ctx context.Context) error {
+	if !s.Active() {
+		return fmt.Errorf("SMPP server is not running")
+	}
+	return nil
+}
+
+// Sessions returns the number of open client sessions
+func (s *Server) Sessions() int {
+	return int(atomic.LoadInt64(&s.sessions))
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
+	atomic.AddInt64(&s.sessions, 1)
+	defer atomic.AddInt64(&s.sessions, -1)
 	defer conn.Close()
 
+	// Session span; submit_sm handling will start message spans under it
+	_, span := tracing.Start(context.Background(), "smpp.session",
+		attribute.String("net.peer.addr", conn.RemoteAddr().String()),
+	)
+	defer span.End()
+
 	// TODO: Implement SMPP protocol handling
 	// 1. Read PDU
 	// 2. Parse PDU
 	// 3. Handle different PDU types (bind, submit_sm, etc.)
 	// 4. Send response PDUs
-	// 5. Implement session management
+	// 5. Implement session management; receiver and transceiver binds
+	//    register with s.AddReceiver to get MO messages as deliver_sm
 	// 6. Handle authentication
-	// 7. Implement rate limiting
-	// 8. Handle message routing
+	// 7. Answer submit_sm with StatusThrottled when s.throttled refuses it
+	// 8. Handle message routing; answer submits the pipeline refuses with
+	//    db.ErrInsufficientBalance with StatusInvalidBalance
 } 
\ No newline at end of file
@@ -0,0 +1,12 @@
+package smpp
+
+// Command status codes of submit_sm_resp PDUs refused by the SMSC
+const (
+	// StatusThrottled is the command_status of a submit_sm_resp refused
+	// because the ESME exceeded its message rate (ESME_RTHROTTLED)
+	StatusThrottled uint32 = 0x00000058
+	// StatusInvalidBalance is the command_status of a submit_sm_resp refused
+	// because the prepaid balance of the ESME does not cover the message
+	// (ESME_RINVBALANCE, from the vendor specific range)
+	StatusInvalidBalance uint32 = 0x00000400
+)
@@ -0,0 +1,41 @@
+package smpp
+
+import (
+	"context"
+	"sync"
+)
+
+// Throttle decides whether an ESME may submit another message now. Submits it
+// refuses are answered with ESME_RTHROTTLED.
+type Throttle func(ctx context.Context, systemID string) error
+
+// throttler holds the throttle applied to the submits of bound ESMEs
+type throttler struct {
+	mu       sync.RWMutex
+	throttle Throttle
+}
+
+// SetThrottle registers the throttle applied to every submit_sm
+func (s *Server) SetThrottle(throttle Throttle) {
+	s.throttler.mu.Lock()
+	defer s.throttler.mu.Unlock()
+
+	s.throttler.throttle = throttle
+}
+
+// throttled reports whether a submit_sm of an ESME must be answered with
+// StatusThrottled
+func (s *Server) throttled(ctx context.Context, systemID string) bool {
+	s.throttler.mu.RLock()
+	throttle := s.throttler.throttle
+	s.throttler.mu.RUnlock()
+
+	if throttle == nil {
+		return false
+	}
+	if err := throttle(ctx, systemID); err != nil {
+		s.log.WithError(err).WithField("system_id", systemID).Debug("SMPP submit throttled")
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+)
+
+// Limit is the refill rate and capacity of a token bucket
+type Limit struct {
+	Rate  float64 // tokens per second
+	Burst int
+}
+
+// NewLimit returns the limit of a rate in requests per second. A zero burst
+// defaults to one second's worth of requests.
+func NewLimit(rps, burst int) Limit {
+	if burst <= 0 {
+		burst = rps
+	}
+	return Limit{Rate: float64(rps), Burst: burst}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int           // capacity of the bucket
+	Remaining  int           // tokens left after this request
+	RetryAfter time.Duration // until the next token when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// Limiter takes tokens from named token buckets
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+	Close() error
+}
+
+// New returns the limiter of the configured driver
+func New(cfg config.RateLimitConfig, redisCfg config.RedisConfig, log *logrus.Logger) (Limiter, error) {
+	switch cfg.Driver {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(redisCfg, log), nil
+	default:
+		return nil, fmt.Errorf("unsupported rate limit driver: %s", cfg.Driver)
+	}
+}
+
+// result describes a bucket holding tokens after a request was decided
+func result(allowed bool, tokens float64, limit Limit) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+	if !allowed {
+		r.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	return r
+}
+
+// refill adds the tokens accrued over elapsed to a bucket
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * limit.Rate
+	}
+	return math.Min(tokens, float64(limit.Burst))
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that refilled completely are dropped
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will be full again
+}
+
+// Memory keeps token buckets in process memory. Each instance enforces its
+// own budget.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of a key
+func (m *Memory) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	return m.take(key, limit, time.Now()), nil
+}
+
+func (m *Memory) take(key string, limit Limit, now time.Time) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.swept) >= sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(b.tokens, now.Sub(b.last), limit)
+	b.last = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	r := result(allowed, b.tokens, limit)
+	b.full = now.Add(r.Reset)
+	return r
+}
+
+// sweep drops the buckets that are full again; they are recreated full on
+// their next use. The caller must hold the lock.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+	m.swept = now
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+)
+
+const (
+	keyPrefix = "smsc:ratelimit:"
+	// retryInterval is how long local limits are used after Redis failed
+	retryInterval = 5 * time.Second
+	// fallbackWarnInterval limits how often a Redis outage is logged
+	fallbackWarnInterval = time.Minute
+)
+
+// takeScript refills and takes up to ARGV[3] tokens from a token bucket
+// atomically, using the Redis clock so that the instances sharing the bucket
+// need not agree on time. It returns the tokens taken and the tokens left.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local want = tonumber(ARGV[3])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) + tonumber(clock[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local taken = math.min(want, math.floor(tokens))
+tokens = tokens - taken
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {taken, tostring(tokens)}
+`)
+
+// Redis keeps token buckets in Redis so that several instances share one
+// budget. While Redis is unreachable, each instance falls back to its own
+// in-memory buckets.
+type Redis struct {
+	client   *redis.Client
+	fallback *Memory
+	log      *logrus.Logger
+	mu       sync.Mutex
+	failed   time.Time
+	warned   time.Time
+}
+
+func NewRedis(cfg config.RedisConfig, log *logrus.Logger) *Redis {
+	return &Redis{
+		client: redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}),
+		fallback: NewMemory(),
+		log:      log,
+	}
+}
+
+// Allow takes a token from the shared bucket of a key
+func (r *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if r.down() {
+		return r.fallback.Allow(ctx, key, limit)
+	}
+
+	taken, tokens, err := r.take(ctx, key, limit, 1)
+	if err == nil {
+		return result(taken == 1, tokens, limit), nil
+	}
+
+	if ctx.Err() != nil {
+		return Result{}, ctx.Err()
+	}
+	r.fail(err)
+	return r.fallback.Allow(ctx, key, limit)
+}
+
+// take takes up to n tokens from the shared bucket of a key and returns the
+// tokens taken and the tokens left
+func (r *Redis) take(ctx context.Context, key string, limit Limit, n int) (int, float64, error) {
+	res, err := takeScript.Run(ctx, r.client, []string{keyPrefix + key}, limit.Rate, limit.Burst, n).Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseTake(res)
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+// down reports whether Redis failed within the last retryInterval
+func (r *Redis) down() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return time.Since(r.failed) < retryInterval
+}
+
+// fail records a failed Redis call and logs it, at most once per
+// fallbackWarnInterval
+func (r *Redis) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed = time.Now()
+	if time.Since(r.warned) < fallbackWarnInterval {
+		return
+	}
+	r.warned = r.failed
+	r.log.WithError(err).Warn("Redis rate limiter unavailable, using local limits")
+}
+
+func parseTake(res []interface{}) (int, float64, error) {
+	if len(res) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+	taken, ok := res[0].(int64)
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+	s, ok := res[1].(string)
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+	tokens, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse rate limit tokens: %w", err)
+	}
+	return int(taken), tokens, nil
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+)
+
+const (
+	tpsPrefix    = "tps:"
+	defaultLease = 100 * time.Millisecond
+)
+
+// lease holds tokens taken from a shared bucket ahead of use
+type lease struct {
+	tokens  int
+	expires time.Time
+}
+
+// TPS enforces transactions-per-second limits, such as the max TPS of an
+// operator or a tenant, across the instances of the SMSC. Tokens are taken
+// from the shared Redis bucket in leases covering a short period, so most
+// submits are decided locally. Leased tokens that expire unused are lost,
+// which keeps the instances together within the limit. Without Redis, each
+// instance enforces its share of the limit in memory.
+type TPS struct {
+	shared    *Redis // nil with the memory driver
+	local     *Memory
+	instances int
+	lease     time.Duration
+	mu        sync.Mutex
+	leases    map[string]*lease
+}
+
+// NewTPS returns the TPS limiter of the configured driver
+func NewTPS(cfg config.TPSConfig, redisCfg config.RedisConfig, log *logrus.Logger) (*TPS, error) {
+	t := &TPS{
+		local:     NewMemory(),
+		instances: cfg.Instances,
+		lease:     cfg.Lease,
+		leases:    make(map[string]*lease),
+	}
+	if t.instances <= 0 {
+		t.instances = 1
+	}
+	if t.lease <= 0 {
+		t.lease = defaultLease
+	}
+
+	switch cfg.Driver {
+	case "", "memory":
+	case "redis":
+		t.shared = NewRedis(redisCfg, log)
+	default:
+		return nil, fmt.Errorf("unsupported TPS limit driver: %s", cfg.Driver)
+	}
+	return t, nil
+}
+
+// Acquire takes one transaction from the TPS budget of a key. A tps of zero
+// or less is unlimited.
+func (t *TPS) Acquire(ctx context.Context, key string, tps int) Result {
+	if tps <= 0 {
+		return Result{Allowed: true}
+	}
+	key = tpsPrefix + key
+
+	if t.shared == nil || t.shared.down() {
+		return t.fallback(key, tps)
+	}
+
+	now := time.Now()
+	if t.fromLease(key, now) {
+		return Result{Allowed: true, Limit: tps}
+	}
+
+	limit := t.limit(float64(tps))
+	taken, tokens, err := t.shared.take(ctx, key, limit, limit.Burst)
+	if err != nil {
+		if ctx.Err() == nil {
+			t.shared.fail(err)
+		}
+		return t.fallback(key, tps)
+	}
+	if taken == 0 {
+		return result(false, tokens, limit)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if l, ok := t.leases[key]; ok && now.Before(l.expires) {
+		l.tokens += taken - 1
+	} else {
+		t.leases[key] = &lease{tokens: taken - 1, expires: now.Add(t.lease)}
+	}
+	return Result{Allowed: true, Limit: tps}
+}
+
+// Share returns the part of a TPS limit each instance enforces on its own,
+// rounded up so that small limits are never blocked entirely
+func (t *TPS) Share(tps int) int {
+	if tps <= 0 {
+		return tps
+	}
+	return int(math.Ceil(float64(tps) / float64(t.instances)))
+}
+
+func (t *TPS) Close() error {
+	if t.shared == nil {
+		return nil
+	}
+	return t.shared.Close()
+}
+
+// fromLease takes a token from the unexpired lease of a key
+func (t *TPS) fromLease(key string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.leases[key]
+	if !ok || l.tokens <= 0 || !now.Before(l.expires) {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// fallback takes a token from the local bucket of a key, limited to this
+// instance's share of the limit
+func (t *TPS) fallback(key string, tps int) Result {
+	return t.local.take(key, t.limit(float64(tps)/float64(t.instances)), time.Now())
+}
+
+// limit returns the bucket of a rate. Its capacity is one lease, so that
+// transactions are spread over each second rather than sent in bursts.
+func (t *TPS) limit(rate float64) Limit {
+	burst := int(math.Ceil(rate * t.lease.Seconds()))
+	if burst < 1 {
+		burst = 1
+	}
+	return Limit{Rate: rate, Burst: burst}
+}
@@ -0,0 +1,324 @@
+package batch
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/core"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/queue"
+	"smsc/pkg/utils"
+)
+
+const (
+	defaultMaxRecipients = 500000
+	// flushSize is the number of outcomes written to the database at once
+	flushSize = 500
+)
+
+// recipientColumns are the CSV header names accepted for the recipient column
+var recipientColumns = []string{"recipient", "msisdn", "phone", "number"}
+
+// Recipient is a batch recipient with its template variables
+type Recipient struct {
+	Recipient string            `json:"recipient"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
+
+// Service sends one message template to many recipients in the background
+type Service struct {
+	cfg      config.BatchConfig
+	db       *db.Database
+	pipeline *core.Pipeline
+	queue    *queue.Service
+	log      *logrus.Logger
+	mu       sync.Mutex
+	active   bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func New(cfg config.BatchConfig, database *db.Database, pipeline *core.Pipeline, queueService *queue.Service, log *logrus.Logger) *Service {
+	return &Service{
+		cfg:      cfg,
+		db:       database,
+		pipeline: pipeline,
+		queue:    queueService,
+		log:      log,
+	}
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("batch service is already running")
+	}
+
+	// Batches are processed in memory; those cut short by a restart cannot resume
+	n, err := s.db.InterruptBatches(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.log.WithField("batches", n).Warn("Marked unfinished batches as interrupted")
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.active = true
+	s.log.Info("Batch service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return nil
+	}
+	s.active = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop batch workers: %w", ctx.Err())
+	}
+
+	s.log.Info("Batch service stopped")
+	return nil
+}
+
+// MaxRecipients returns the largest number of recipients a batch may have
+func (s *Service) MaxRecipients() int {
+	if s.cfg.MaxRecipients <= 0 {
+		return defaultMaxRecipients
+	}
+	return s.cfg.MaxRecipients
+}
+
+// Create stores a batch and starts sending it. The message is used as the
+// prototype of every batch message, with its content as the template.
+func (s *Service) Create(ctx context.Context, proto *models.Message, recipients []Recipient) (*models.Batch, error) {
+	maxRecipients := s.MaxRecipients()
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("batch has no recipients")
+	}
+	if len(recipients) > maxRecipients {
+		return nil, fmt.Errorf("batch has %d recipients, at most %d are allowed", len(recipients), maxRecipients)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return nil, fmt.Errorf("batch service is not running")
+	}
+
+	batch := &models.Batch{
+		ClientID: proto.ClientID,
+		Sender:   proto.Sender,
+		Template: proto.Content,
+		Status:   models.BatchProcessing,
+		Total:    len(recipients),
+	}
+	if err := s.db.CreateBatch(ctx, batch); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.run(s.ctx, *batch, proto, recipients)
+
+	return batch, nil
+}
+
+// run sends the batch messages, waiting for queue capacity before each one
+func (s *Service) run(ctx context.Context, batch models.Batch, proto *models.Message, recipients []Recipient) {
+	defer s.wg.Done()
+
+	log := s.log.WithField("batch_id", batch.ID)
+	log.WithField("recipients", len(recipients)).Info("Batch started")
+
+	seen := make(map[string]struct{}, len(recipients))
+	outcomes := make([]models.BatchRecipient, 0, flushSize)
+
+	flush := func() {
+		// Progress is written with a fresh context so it survives shutdown
+		flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := s.db.AddBatchRecipients(flushCtx, outcomes); err != nil {
+			log.WithError(err).Error("Failed to store batch outcomes")
+		}
+		outcomes = outcomes[:0]
+		if err := s.db.UpdateBatch(flushCtx, &batch); err != nil {
+			log.WithError(err).Error("Failed to update batch progress")
+		}
+	}
+
+	for _, r := range recipients {
+		var outcome models.BatchRecipient
+		if ctx.Err() == nil {
+			outcome = s.send(ctx, batch.ID, proto, r, seen)
+		}
+		// Recipients not sent because of shutdown stay unprocessed
+		if ctx.Err() != nil && outcome.Status != models.RecipientQueued {
+			batch.Status = models.BatchInterrupted
+			flush()
+			log.Warn("Batch interrupted")
+			return
+		}
+
+		switch outcome.Status {
+		case models.RecipientQueued:
+			batch.Queued++
+		case models.RecipientInvalid:
+			batch.Invalid++
+		case models.RecipientDuplicate:
+			batch.Duplicates++
+		case models.RecipientFailed:
+			batch.Failed++
+		}
+		batch.Processed++
+
+		outcomes = append(outcomes, outcome)
+		if len(outcomes) >= flushSize {
+			flush()
+		}
+	}
+
+	now := time.Now()
+	batch.Status = models.BatchCompleted
+	batch.CompletedAt = &now
+	flush()
+
+	log.WithFields(logrus.Fields{
+		"queued":     batch.Queued,
+		"invalid":    batch.Invalid,
+		"duplicates": batch.Duplicates,
+		"failed":     batch.Failed,
+	}).Info("Batch completed")
+}
+
+// send validates, personalizes and queues the message of one recipient
+func (s *Service) send(ctx context.Context, batchID int64, proto *models.Message, r Recipient, seen map[string]struct{}) models.BatchRecipient {
+	number := strings.TrimSpace(r.Recipient)
+	outcome := models.BatchRecipient{BatchID: batchID, Recipient: number}
+
+	if err := utils.ValidateMSISDN(number); err != nil {
+		outcome.Status, outcome.Error = models.RecipientInvalid, err.Error()
+		return outcome
+	}
+
+	key := strings.TrimPrefix(number, "+")
+	if _, dup := seen[key]; dup {
+		outcome.Status = models.RecipientDuplicate
+		return outcome
+	}
+	seen[key] = struct{}{}
+
+	content, err := utils.RenderTemplate(proto.Content, r.Variables)
+	if err != nil {
+		outcome.Status, outcome.Error = models.RecipientInvalid, err.Error()
+		return outcome
+	}
+	encoding, segments := utils.Segments(content)
+	if segments > utils.MaxSegments {
+		outcome.Status, outcome.Error = models.RecipientInvalid, fmt.Sprintf("content needs %d segments", segments)
+		return outcome
+	}
+
+	if err := s.queue.WaitCapacity(ctx); err != nil {
+		outcome.Status, outcome.Error = models.RecipientFailed, err.Error()
+		return outcome
+	}
+
+	msg := *proto
+	msg.Recipient = number
+	msg.Content = content
+	msg.Encoding = encoding
+	msg.DataCoding = utils.DataCoding(encoding)
+	msg.CreatedAt = time.Now()
+
+	if err := s.pipeline.Submit(ctx, &msg); err != nil {
+		outcome.Status, outcome.Error = models.RecipientFailed, err.Error()
+		return outcome
+	}
+
+	outcome.Status = models.RecipientQueued
+	outcome.MessageID = &msg.ID
+	return outcome
+}
+
+// ParseCSV reads recipients from CSV with a header row. The recipient column
+// is named recipient, msisdn, phone or number; every other column becomes a
+// template variable named after its header. Reading stops with an error at
+// the first record beyond limit.
+func ParseCSV(r io.Reader, limit int) ([]Recipient, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	column := -1
+	for i, name := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		for _, accepted := range recipientColumns {
+			if column < 0 && strings.EqualFold(header[i], accepted) {
+				column = i
+			}
+		}
+	}
+	if column < 0 {
+		return nil, fmt.Errorf("CSV has no recipient column, expected one of: %s", strings.Join(recipientColumns, ", "))
+	}
+
+	var recipients []Recipient
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV record: %w", err)
+		}
+		if column >= len(record) {
+			continue
+		}
+
+		vars := make(map[string]string, len(header)-1)
+		for i, value := range record {
+			if i != column && i < len(header) {
+				vars[header[i]] = value
+			}
+		}
+		recipients = append(recipients, Recipient{Recipient: record[column], Variables: vars})
+		if len(recipients) > limit {
+			return nil, fmt.Errorf("CSV has more than %d recipients", limit)
+		}
+	}
+
+	return recipients, nil
+}
@@ -0,0 +1,197 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+)
+
+const (
+	ChargeOnSubmit   = "submit"
+	ChargeOnDelivery = "delivery"
+)
+
+// ErrInvalidAmount is returned for balance adjustments without an amount
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// finalStatuses are the statuses a charge may be refunded on
+var finalStatuses = map[models.MessageStatus]bool{
+	models.StatusDelivered: true,
+	models.StatusRouted:    true,
+	models.StatusFailed:    true,
+	models.StatusExpired:   true,
+	models.StatusRejected:  true,
+}
+
+// Service charges messages of clients with a prepaid balance. The price of a
+// message is reserved from the balance as it is stored; the charge is
+// committed once the message was submitted, routed to an operator it cannot
+// be submitted to, or delivered, and refunded when
+// it ends in one of the configured statuses.
+type Service struct {
+	cfg    config.BillingConfig
+	db     *db.Database
+	log    *logrus.Logger
+	mu     sync.Mutex
+	active bool
+	refund map[models.MessageStatus]bool
+}
+
+func New(cfg config.BillingConfig, database *db.Database, log *logrus.Logger) *Service {
+	if cfg.ChargeOn == "" {
+		cfg.ChargeOn = ChargeOnSubmit
+	}
+
+	return &Service{
+		cfg:    cfg,
+		db:     database,
+		log:    log,
+		refund: make(map[models.MessageStatus]bool),
+	}
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("billing service is already running")
+	}
+	if !s.cfg.Enabled {
+		s.log.Info("Prepaid billing is disabled")
+		return nil
+	}
+
+	if s.cfg.ChargeOn != ChargeOnSubmit && s.cfg.ChargeOn != ChargeOnDelivery {
+		return fmt.Errorf("invalid billing charge_on: %q", s.cfg.ChargeOn)
+	}
+	for _, status := range s.cfg.RefundOn {
+		st := models.MessageStatus(status)
+		if !finalStatuses[st] {
+			return fmt.Errorf("invalid billing refund_on status: %q", status)
+		}
+		s.refund[st] = true
+	}
+
+	s.active = true
+	s.log.Info("Billing service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	s.active = false
+	s.log.Info("Billing service stopped")
+	return nil
+}
+
+func (s *Service) running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+// Admit marks priced messages for a charge. It is an admission step of the
+// message pipeline and must run after the step that sets the price; the
+// charge is reserved as the message is stored, which fails with
+// db.ErrInsufficientBalance when the client's balance does not cover it.
+func (s *Service) Admit(ctx context.Context, msg *models.Message) error {
+	if !s.running() || msg.Price <= 0 || msg.ClientID == "" {
+		return nil
+	}
+
+	msg.BillingInfo = models.ChargeReserved
+	return nil
+}
+
+// Settle commits or refunds the charge of a message whose status changed.
+// It is a status listener of the message pipeline; settling is idempotent,
+// so repeated statuses have no effect. Failures are logged and leave the
+// charge reserved.
+func (s *Service) Settle(ctx context.Context, messageID int64, status models.MessageStatus) {
+	if !s.running() {
+		return
+	}
+
+	var (
+		settle func(context.Context, int64) (bool, error)
+		action string
+	)
+	switch {
+	case s.refund[status]:
+		settle, action = s.db.RefundMessage, "refund"
+	case finalStatuses[status], status == models.StatusSent && s.cfg.ChargeOn == ChargeOnSubmit:
+		settle, action = s.db.ChargeMessage, "charge"
+	default:
+		return
+	}
+
+	settled, err := settle(ctx, messageID)
+	if err != nil {
+		s.log.WithError(err).WithField("message_id", messageID).Errorf("Failed to %s message", action)
+		return
+	}
+	if settled {
+		s.log.WithFields(logrus.Fields{
+			"message_id": messageID,
+			"status":     status,
+			"action":     action,
+		}).Debug("Message charge settled")
+	}
+}
+
+// Balance returns the prepaid balance of a client
+func (s *Service) Balance(ctx context.Context, clientID string) (*models.Balance, error) {
+	return s.db.GetBalance(ctx, clientID)
+}
+
+// Balances returns every prepaid balance
+func (s *Service) Balances(ctx context.Context) ([]*models.Balance, error) {
+	return s.db.ListBalances(ctx)
+}
+
+// Adjust tops up a prepaid balance, or takes from it with a negative amount,
+// opening the account of a client that has none. Taking more than the
+// available balance fails with db.ErrInsufficientBalance.
+func (s *Service) Adjust(ctx context.Context, clientID string, amount float64, note string) (*models.Balance, error) {
+	// A zero amount only opens an account
+	if amount == 0 {
+		_, err := s.db.GetBalance(ctx, clientID)
+		if err == nil {
+			return nil, fmt.Errorf("%w: amount must not be zero", ErrInvalidAmount)
+		}
+		if !errors.Is(err, db.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	b, err := s.db.AdjustBalance(ctx, clientID, amount, note)
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"client_id": clientID,
+		"amount":    amount,
+		"available": b.Available,
+	}).Info("Balance adjusted")
+	return b, nil
+}
+
+// Transactions returns a page of the ledger of a prepaid account
+func (s *Service) Transactions(ctx context.Context, clientID string, limit int, cursor string) ([]*models.BalanceTransaction, string, error) {
+	return s.db.BalanceTransactions(ctx, clientID, limit, cursor)
+}
@@ -0,0 +1,81 @@
+package campaign
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"smsc/internal/models"
+)
+
+// validateQuietHours checks the bounds and timezone of quiet hours
+func validateQuietHours(q models.QuietHours) error {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("empty quiet hours %s-%s", q.Start, q.End)
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid quiet hours timezone: %w", err)
+	}
+	return nil
+}
+
+// quietUntil returns when the quiet hours containing now end, or the zero
+// time when now is outside them
+func quietUntil(q *models.QuietHours, now time.Time) time.Time {
+	if q == nil {
+		return time.Time{}
+	}
+
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	switch {
+	case start < end && minute >= start && minute < end:
+		return day.Add(time.Duration(end) * time.Minute)
+	case start > end && minute >= start:
+		return day.AddDate(0, 0, 1).Add(time.Duration(end) * time.Minute)
+	case start > end && minute < end:
+		return day.Add(time.Duration(end) * time.Minute)
+	}
+	return time.Time{}
+}
+
+// parseClock converts HH:MM to minutes after midnight
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time: %q", clock)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %q", clock)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 || h < 0 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time: %q", clock)
+	}
+	return h*60 + m, nil
+}
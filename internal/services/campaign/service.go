@@ -0,0 +1,772 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/core"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/batch"
+	"smsc/internal/services/queue"
+	"smsc/internal/services/routing"
+	"smsc/internal/services/tenant"
+	"smsc/internal/services/webhook"
+	"smsc/pkg/utils"
+)
+
+const (
+	// pageSize is the number of pending recipients loaded at once
+	pageSize = 500
+	// scheduleInterval is how often scheduled campaigns are checked for their start time
+	scheduleInterval = 5 * time.Second
+	// maxValidityPeriod is the longest message validity in seconds
+	maxValidityPeriod = 7 * 24 * 3600
+	// runnerLease prefixes the database lease that makes one instance the
+	// runner of a campaign
+	runnerLease = "campaign:"
+	// leaseTTL is how long a runner lease lasts without being renewed
+	leaseTTL = 30 * time.Second
+	// watchInterval is how often a runner renews its lease and re-reads the campaign
+	watchInterval = 10 * time.Second
+)
+
+var (
+	// ErrInvalidCampaign is returned for campaigns with invalid settings
+	ErrInvalidCampaign = errors.New("invalid campaign")
+	// ErrInvalidState is returned for operations not allowed in the campaign's current status
+	ErrInvalidState = errors.New("invalid campaign state")
+)
+
+// AudienceResult summarizes an audience upload
+type AudienceResult struct {
+	Added      int `json:"added"`
+	Invalid    int `json:"invalid"`
+	Duplicates int `json:"duplicates"`
+}
+
+// Service runs campaigns: it starts scheduled campaigns when they are due and
+// feeds the audience of running campaigns into the queue at their throttle
+// rate. Every instance tries to run each running campaign; a database lease
+// lets only one of them send, and another takes over when it stops.
+type Service struct {
+	db       *db.Database
+	pipeline *core.Pipeline
+	queue    *queue.Service
+	routing  *routing.Service
+	log      *logrus.Logger
+	mu       sync.Mutex
+	active   bool
+	ctx      context.Context
+	cancel   context.CancelFunc
+	runners  map[int64]*runner
+	wg       sync.WaitGroup
+}
+
+// runner is the sending loop of a running campaign. Its settings can change
+// while it runs.
+type runner struct {
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	campaign models.Campaign
+}
+
+func (r *runner) settings() models.Campaign {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.campaign
+}
+
+func (r *runner) update(c models.Campaign) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.campaign = c
+}
+
+func New(database *db.Database, pipeline *core.Pipeline, queueService *queue.Service, routingService *routing.Service, log *logrus.Logger) *Service {
+	return &Service{
+		db:       database,
+		pipeline: pipeline,
+		queue:    queueService,
+		routing:  routingService,
+		log:      log,
+		runners:  make(map[int64]*runner),
+	}
+}
+
+// Start resumes the running campaigns no other instance runs and starts the
+// scheduler
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("campaign service is already running")
+	}
+
+	running, err := s.db.ListCampaigns(ctx, "", models.CampaignRunning)
+	if err != nil {
+		return err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.active = true
+
+	for _, c := range running {
+		s.launch(*c)
+	}
+
+	s.wg.Add(1)
+	go s.schedule(s.ctx)
+
+	s.log.WithField("resumed", len(running)).Info("Campaign service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return nil
+	}
+	s.active = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop campaign runners: %w", ctx.Err())
+	}
+
+	s.log.Info("Campaign service stopped")
+	return nil
+}
+
+// Create validates and stores a draft campaign with its initial audience
+func (s *Service) Create(ctx context.Context, c *models.Campaign, audience []batch.Recipient) (AudienceResult, error) {
+	if err := validate(c); err != nil {
+		return AudienceResult{}, fmt.Errorf("%w: %v", ErrInvalidCampaign, err)
+	}
+
+	c.Status = models.CampaignDraft
+	if err := s.db.CreateCampaign(ctx, c); err != nil {
+		return AudienceResult{}, err
+	}
+
+	return s.addAudience(ctx, c.ID, audience, nil)
+}
+
+// Update replaces the settings of a campaign. Sender and template can only
+// change before the campaign starts; a running campaign picks up the new
+// throttle, quiet hours and budget immediately.
+func (s *Service) Update(ctx context.Context, update *models.Campaign) (*models.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.db.GetCampaign(ctx, update.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Status {
+	case models.CampaignCompleted, models.CampaignCancelled:
+		return nil, fmt.Errorf("%w: campaign is %s", ErrInvalidState, c.Status)
+	case models.CampaignDraft:
+		c.Sender = update.Sender
+		c.Template = update.Template
+	default:
+		if update.Sender != c.Sender || update.Template != c.Template {
+			return nil, fmt.Errorf("%w: sender and template cannot change once the campaign started", ErrInvalidState)
+		}
+	}
+
+	c.Name = update.Name
+	c.StartAt = update.StartAt
+	c.Throttle = update.Throttle
+	c.QuietHours = update.QuietHours
+	c.BudgetCap = update.BudgetCap
+	c.Priority = update.Priority
+	c.ValidityPeriod = update.ValidityPeriod
+	c.CallbackURL = update.CallbackURL
+	if err := validate(c); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCampaign, err)
+	}
+
+	if err := s.db.UpdateCampaign(ctx, c, c.Status); err != nil {
+		return nil, stateError(err)
+	}
+
+	if r, ok := s.runners[c.ID]; ok {
+		r.update(*c)
+	}
+	return c, nil
+}
+
+// AddAudience appends recipients to a campaign that has not completed
+func (s *Service) AddAudience(ctx context.Context, id int64, audience []batch.Recipient) (AudienceResult, error) {
+	c, err := s.db.GetCampaign(ctx, id)
+	if err != nil {
+		return AudienceResult{}, err
+	}
+	if c.Status == models.CampaignCompleted || c.Status == models.CampaignCancelled {
+		return AudienceResult{}, fmt.Errorf("%w: campaign is %s", ErrInvalidState, c.Status)
+	}
+
+	existing, err := s.db.CampaignRecipientNumbers(ctx, id)
+	if err != nil {
+		return AudienceResult{}, err
+	}
+	return s.addAudience(ctx, id, audience, existing)
+}
+
+// addAudience validates and de-duplicates recipients against each other and
+// the existing audience, and stores them as pending
+func (s *Service) addAudience(ctx context.Context, id int64, audience []batch.Recipient, existing []string) (AudienceResult, error) {
+	seen := make(map[string]struct{}, len(existing)+len(audience))
+	for _, number := range existing {
+		seen[strings.TrimPrefix(number, "+")] = struct{}{}
+	}
+
+	var result AudienceResult
+	rows := make([]models.CampaignRecipient, 0, pageSize)
+	for _, r := range audience {
+		row := models.CampaignRecipient{
+			CampaignID: id,
+			Recipient:  strings.TrimSpace(r.Recipient),
+			Variables:  r.Variables,
+			Status:     models.RecipientPending,
+		}
+
+		key := strings.TrimPrefix(row.Recipient, "+")
+		if err := utils.ValidateMSISDN(row.Recipient); err != nil {
+			row.Status, row.Error = models.RecipientInvalid, err.Error()
+			result.Invalid++
+		} else if _, dup := seen[key]; dup {
+			result.Duplicates++
+			continue
+		} else {
+			seen[key] = struct{}{}
+			result.Added++
+		}
+
+		rows = append(rows, row)
+		if len(rows) >= pageSize {
+			if err := s.db.AddCampaignRecipients(ctx, rows); err != nil {
+				return result, err
+			}
+			rows = rows[:0]
+		}
+	}
+
+	if err := s.db.AddCampaignRecipients(ctx, rows); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// StartCampaign starts a draft campaign, or schedules it when its start time
+// is in the future
+func (s *Service) StartCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return s.transition(ctx, id, []models.CampaignStatus{models.CampaignDraft}, func(c *models.Campaign) {
+		c.Status = models.CampaignScheduled
+		if c.StartAt == nil || !c.StartAt.After(time.Now()) {
+			c.Status = models.CampaignRunning
+		}
+	})
+}
+
+// PauseCampaign stops sending until the campaign is resumed
+func (s *Service) PauseCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return s.transition(ctx, id, []models.CampaignStatus{models.CampaignRunning, models.CampaignScheduled}, func(c *models.Campaign) {
+		c.Status = models.CampaignPaused
+		c.StatusReason = "paused by user"
+	})
+}
+
+// ResumeCampaign continues a paused campaign
+func (s *Service) ResumeCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return s.transition(ctx, id, []models.CampaignStatus{models.CampaignPaused}, func(c *models.Campaign) {
+		c.Status = models.CampaignScheduled
+		if c.StartAt == nil || !c.StartAt.After(time.Now()) {
+			c.Status = models.CampaignRunning
+		}
+	})
+}
+
+// CancelCampaign stops a campaign for good; its pending recipients are not sent
+func (s *Service) CancelCampaign(ctx context.Context, id int64) (*models.Campaign, error) {
+	return s.transition(ctx, id, []models.CampaignStatus{
+		models.CampaignDraft, models.CampaignScheduled, models.CampaignRunning, models.CampaignPaused,
+	}, func(c *models.Campaign) {
+		now := time.Now()
+		c.Status = models.CampaignCancelled
+		c.StatusReason = "cancelled by user"
+		c.CompletedAt = &now
+	})
+}
+
+// Stats returns the aggregate audience and delivery stats of a campaign
+func (s *Service) Stats(ctx context.Context, id int64) (*models.CampaignStats, error) {
+	if _, err := s.db.GetCampaign(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.db.CampaignStats(ctx, id)
+}
+
+// transition applies a status change allowed from the given statuses and
+// starts or stops the campaign runner accordingly
+func (s *Service) transition(ctx context.Context, id int64, from []models.CampaignStatus, apply func(*models.Campaign)) (*models.Campaign, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.db.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	for _, status := range from {
+		if c.Status == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, fmt.Errorf("%w: campaign is %s", ErrInvalidState, c.Status)
+	}
+
+	previous := c.Status
+	c.StatusReason = ""
+	apply(c)
+	if c.Status == models.CampaignRunning && c.StartedAt == nil {
+		now := time.Now()
+		c.StartedAt = &now
+	}
+	if err := s.db.UpdateCampaign(ctx, c, previous); err != nil {
+		return nil, stateError(err)
+	}
+
+	if r, ok := s.runners[c.ID]; ok && c.Status != models.CampaignRunning {
+		r.cancel()
+		delete(s.runners, c.ID)
+	}
+	if c.Status == models.CampaignRunning && s.active {
+		s.launch(*c)
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"campaign_id": c.ID,
+		"status":      c.Status,
+	}).Info("Campaign status changed")
+	return c, nil
+}
+
+// stateError reports a campaign changed by a concurrent update as being in
+// the wrong state for the operation
+func stateError(err error) error {
+	if errors.Is(err, db.ErrCampaignChanged) {
+		return fmt.Errorf("%w: campaign status changed concurrently", ErrInvalidState)
+	}
+	return err
+}
+
+// launch starts the runner of a campaign. Callers must hold s.mu.
+func (s *Service) launch(c models.Campaign) {
+	if _, ok := s.runners[c.ID]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	r := &runner{cancel: cancel, campaign: c}
+	s.runners[c.ID] = r
+
+	s.wg.Add(1)
+	go s.run(ctx, r)
+}
+
+// finish records the final state of a campaign whose runner stopped on its own
+func (s *Service) finish(ctx context.Context, r *runner, status models.CampaignStatus, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// A user action may have changed the campaign while the runner was stopping
+	if ctx.Err() != nil {
+		return
+	}
+	delete(s.runners, r.campaign.ID)
+
+	c := r.settings()
+	c.Status = status
+	c.StatusReason = reason
+	if status == models.CampaignCompleted {
+		now := time.Now()
+		c.CompletedAt = &now
+	}
+	err := s.db.UpdateCampaign(context.Background(), &c, models.CampaignRunning)
+	if errors.Is(err, db.ErrCampaignChanged) {
+		// Changed on another instance since the runner last re-read it
+		return
+	}
+	if err != nil {
+		s.log.WithError(err).WithField("campaign_id", c.ID).Error("Failed to update campaign")
+		return
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"campaign_id": c.ID,
+		"status":      status,
+		"reason":      reason,
+	}).Info("Campaign stopped")
+}
+
+// run sends the pending audience of a campaign while this instance holds its
+// lease. It stops when the campaign leaves the running status, on this
+// instance or another.
+func (s *Service) run(ctx context.Context, rn *runner) {
+	defer s.wg.Done()
+
+	id := rn.settings().ID
+	log := s.log.WithField("campaign_id", id)
+	lease := runnerLease + strconv.FormatInt(id, 10)
+	defer s.release(log, id, rn, lease)
+
+	owner, err := s.db.AcquireLease(ctx, lease, leaseTTL)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithError(err).Error("Failed to acquire campaign lease")
+		}
+		return
+	}
+	if !owner {
+		log.Debug("Campaign runs on another instance")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		s.watch(ctx, cancel, log, rn, lease)
+	}()
+	defer func() {
+		cancel()
+		<-watched
+	}()
+
+	spent, err := s.db.CampaignSpend(ctx, id)
+	if err != nil {
+		log.WithError(err).Error("Failed to load campaign spend")
+		return
+	}
+
+	next := time.Now()
+	var after int64
+	for {
+		if !s.follow(ctx, log, rn, lease) {
+			return
+		}
+
+		page, err := s.db.PendingCampaignRecipients(ctx, id, after, pageSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).Error("Failed to load campaign recipients")
+			}
+			return
+		}
+		if len(page) == 0 {
+			s.finish(ctx, rn, models.CampaignCompleted, "")
+			return
+		}
+
+		for i := range page {
+			r := &page[i]
+			after = r.ID
+			c := rn.settings()
+
+			if until := quietUntil(c.QuietHours, time.Now()); !until.IsZero() {
+				log.WithField("until", until).Debug("Campaign in quiet hours")
+				if !sleepUntil(ctx, until) {
+					return
+				}
+				next = time.Now()
+			}
+			if !sleepUntil(ctx, next) {
+				return
+			}
+			if c.Throttle > 0 {
+				next = maxTime(next, time.Now()).Add(time.Second / time.Duration(c.Throttle))
+			}
+			if err := s.queue.WaitCapacity(ctx); err != nil {
+				return
+			}
+
+			msg, err := s.message(ctx, c, r)
+			if err != nil {
+				r.Status, r.Error = models.RecipientInvalid, err.Error()
+				s.updateRecipient(log, r)
+				continue
+			}
+
+			if c.BudgetCap > 0 && spent+msg.Cost > c.BudgetCap {
+				s.finish(ctx, rn, models.CampaignPaused, "budget cap reached")
+				return
+			}
+
+			if err := s.pipeline.Submit(ctx, msg); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, tenant.ErrQuotaExceeded) || errors.Is(err, tenant.ErrTenantDisabled) ||
+					errors.Is(err, db.ErrInsufficientBalance) {
+					s.finish(ctx, rn, models.CampaignPaused, err.Error())
+					return
+				}
+				r.Status, r.Error = models.RecipientFailed, err.Error()
+				s.updateRecipient(log, r)
+				continue
+			}
+
+			spent += msg.Cost
+			r.Status, r.MessageID = models.RecipientQueued, &msg.ID
+			s.updateRecipient(log, r)
+		}
+	}
+}
+
+// watch keeps the lease of a runner and follows its campaign until ctx ends,
+// and stops the runner once following fails
+func (s *Service) watch(ctx context.Context, stop context.CancelFunc, log *logrus.Entry, rn *runner, lease string) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.follow(ctx, log, rn, lease) {
+				stop()
+				return
+			}
+		}
+	}
+}
+
+// follow renews the lease of a runner and re-reads its campaign, picking up
+// settings changed on other instances. It reports false when the runner must
+// stop: the lease is lost or the campaign is no longer running.
+func (s *Service) follow(ctx context.Context, log *logrus.Entry, rn *runner, lease string) bool {
+	owner, err := s.db.AcquireLease(ctx, lease, leaseTTL)
+	if err != nil || !owner {
+		if ctx.Err() == nil {
+			log.WithError(err).Warn("Lost campaign lease")
+		}
+		return false
+	}
+
+	c, err := s.db.GetCampaign(ctx, rn.settings().ID)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithError(err).Error("Failed to reload campaign")
+		}
+		return false
+	}
+	if c.Status != models.CampaignRunning {
+		log.WithField("status", c.Status).Info("Campaign no longer running")
+		return false
+	}
+
+	rn.update(*c)
+	return true
+}
+
+// release removes a stopped runner and gives up its lease, so that the
+// campaign can be resumed here or on another instance
+func (s *Service) release(log *logrus.Entry, id int64, rn *runner, lease string) {
+	s.mu.Lock()
+	if s.runners[id] == rn {
+		delete(s.runners, id)
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.db.ReleaseLease(ctx, lease); err != nil {
+		log.WithError(err).Warn("Failed to release campaign lease")
+	}
+}
+
+// message builds the personalized message of an audience member and estimates its cost
+func (s *Service) message(ctx context.Context, c models.Campaign, r *models.CampaignRecipient) (*models.Message, error) {
+	content, err := utils.RenderTemplate(c.Template, r.Variables)
+	if err != nil {
+		return nil, err
+	}
+	encoding, segments := utils.Segments(content)
+	if segments > utils.MaxSegments {
+		return nil, fmt.Errorf("content needs %d segments", segments)
+	}
+
+	campaignID := strconv.FormatInt(c.ID, 10)
+	msg := models.NewMessage(c.Sender, r.Recipient, content)
+	msg.ClientID = c.ClientID
+	msg.CampaignID = &campaignID
+	msg.Priority = c.Priority
+	msg.Encoding = encoding
+	msg.DataCoding = utils.DataCoding(encoding)
+	msg.CallbackURL = c.CallbackURL
+	if c.ValidityPeriod > 0 {
+		msg.ValidityPeriod = time.Duration(c.ValidityPeriod) * time.Second
+	}
+
+	// Simulating routes does no number lookups, so estimates stay cheap
+	if decision, err := s.routing.Simulate(ctx, msg); err == nil && decision.Price != nil {
+		msg.Cost = *decision.Price * float64(segments)
+	}
+	return msg, nil
+}
+
+func (s *Service) updateRecipient(log *logrus.Entry, r *models.CampaignRecipient) {
+	// Outcomes are written with a fresh context so they survive a pause
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s.db.UpdateCampaignRecipient(ctx, r); err != nil {
+		log.WithError(err).WithField("recipient", r.Recipient).Error("Failed to update campaign recipient")
+	}
+}
+
+// schedule starts scheduled campaigns once their start time has passed and
+// takes over running campaigns whose runner stopped
+func (s *Service) schedule(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			scheduled, err := s.db.ListCampaigns(ctx, "", models.CampaignScheduled)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.log.WithError(err).Error("Failed to list scheduled campaigns")
+				}
+				continue
+			}
+
+			for _, c := range scheduled {
+				if c.StartAt != nil && c.StartAt.After(now) {
+					continue
+				}
+				_, err := s.transition(ctx, c.ID, []models.CampaignStatus{models.CampaignScheduled}, func(c *models.Campaign) {
+					c.Status = models.CampaignRunning
+				})
+				if err != nil && !errors.Is(err, ErrInvalidState) {
+					s.log.WithError(err).WithField("campaign_id", c.ID).Error("Failed to start scheduled campaign")
+				}
+			}
+
+			s.resume(ctx)
+		}
+	}
+}
+
+// resume launches runners for the running campaigns without one here. Those
+// running on another instance stop again once they find its lease.
+func (s *Service) resume(ctx context.Context) {
+	running, err := s.db.ListCampaigns(ctx, "", models.CampaignRunning)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.WithError(err).Error("Failed to list running campaigns")
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return
+	}
+	for _, c := range running {
+		s.launch(*c)
+	}
+}
+
+// validate checks the campaign settings
+func validate(c *models.Campaign) error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("campaign name is required")
+	}
+	if err := utils.ValidateSender(c.Sender); err != nil {
+		return err
+	}
+	if strings.TrimSpace(c.Template) == "" {
+		return fmt.Errorf("campaign template is required")
+	}
+	if c.Throttle < 0 {
+		return fmt.Errorf("throttle must not be negative")
+	}
+	if c.BudgetCap < 0 {
+		return fmt.Errorf("budget cap must not be negative")
+	}
+	if c.Priority < 0 || c.Priority > queue.MaxPriority {
+		return fmt.Errorf("priority must be between 0 and %d", queue.MaxPriority)
+	}
+	if c.ValidityPeriod < 0 || c.ValidityPeriod > maxValidityPeriod {
+		return fmt.Errorf("validity period must be between 0 and %d seconds", maxValidityPeriod)
+	}
+	if c.CallbackURL != "" {
+		if err := webhook.CheckURL(c.CallbackURL); err != nil {
+			return err
+		}
+	}
+	if c.QuietHours != nil {
+		if err := validateQuietHours(*c.QuietHours); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	wait := time.Until(t)
+	if wait <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,154 @@
+package cdr
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"smsc/internal/models"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// column is a column of CSV CDR files and exports
+type column struct {
+	name  string
+	value func(c *models.CDR) string
+	// internal columns are left out of tenant exports
+	internal bool
+}
+
+// columns are the columns of CSV CDR files and exports, in order
+var columns = []column{
+	{name: "id", value: func(c *models.CDR) string { return strconv.FormatInt(c.ID, 10) }},
+	{name: "message_id", value: func(c *models.CDR) string { return strconv.FormatInt(c.MessageID, 10) }},
+	{name: "smpp_message_id", value: func(c *models.CDR) string { return c.SMPPMessageID }},
+	{name: "upstream_message_id", value: func(c *models.CDR) string { return c.UpstreamID }, internal: true},
+	{name: "client_id", value: func(c *models.CDR) string { return c.ClientID }},
+	{name: "campaign_id", value: func(c *models.CDR) string { return c.CampaignID }},
+	{name: "sender", value: func(c *models.CDR) string { return c.Sender }},
+	{name: "recipient", value: func(c *models.CDR) string { return c.Recipient }},
+	{name: "destination", value: func(c *models.CDR) string { return c.Destination }},
+	{name: "operator_id", value: func(c *models.CDR) string { return c.OperatorID }, internal: true},
+	{name: "status", value: func(c *models.CDR) string { return string(c.Status) }},
+	{name: "error", value: func(c *models.CDR) string { return c.Error }},
+	{name: "segments", value: func(c *models.CDR) string { return strconv.Itoa(c.Segments) }},
+	{name: "encoding", value: func(c *models.CDR) string { return c.Encoding }},
+	{name: "cost", value: func(c *models.CDR) string { return strconv.FormatFloat(c.Cost, 'f', 6, 64) }, internal: true},
+	{name: "price", value: func(c *models.CDR) string { return strconv.FormatFloat(c.Price, 'f', 6, 64) }},
+	{name: "charge", value: func(c *models.CDR) string { return c.Charge }},
+	{name: "submitted_at", value: func(c *models.CDR) string { return formatTime(&c.SubmittedAt) }},
+	{name: "sent_at", value: func(c *models.CDR) string { return formatTime(c.SentAt) }},
+	{name: "delivered_at", value: func(c *models.CDR) string { return formatTime(c.DeliveredAt) }},
+	{name: "completed_at", value: func(c *models.CDR) string { return formatTime(&c.CompletedAt) }},
+	{name: "country", value: func(c *models.CDR) string { return c.Country }},
+}
+
+// Encoder writes call detail records in one of the export formats
+type Encoder interface {
+	Encode(c *models.CDR) error
+	// Flush writes buffered records to the underlying writer
+	Flush() error
+}
+
+// NewEncoder returns an encoder for a format. CSV output starts with a header
+// row when header is set; JSON output has one record per line. Tenant
+// output leaves out the operator and what it was paid.
+func NewEncoder(w io.Writer, format string, header, tenant bool) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		cols := columns
+		if tenant {
+			cols = make([]column, 0, len(columns))
+			for _, col := range columns {
+				if !col.internal {
+					cols = append(cols, col)
+				}
+			}
+		}
+		return &csvEncoder{w: csv.NewWriter(w), columns: cols, header: header}, nil
+	case FormatJSON:
+		return &jsonEncoder{enc: json.NewEncoder(w), tenant: tenant}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+	}
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []column
+	header  bool
+}
+
+func (e *csvEncoder) Encode(c *models.CDR) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		record[i] = col.value(c)
+	}
+	return e.w.Write(record)
+}
+
+func (e *csvEncoder) Flush() error {
+	// A CSV export without records still has its header
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// writeHeader writes the header row once, before the first record
+func (e *csvEncoder) writeHeader() error {
+	if !e.header {
+		return nil
+	}
+	e.header = false
+
+	names := make([]string, len(e.columns))
+	for i, col := range e.columns {
+		names[i] = col.name
+	}
+	return e.w.Write(names)
+}
+
+type jsonEncoder struct {
+	enc    *json.Encoder
+	tenant bool
+}
+
+func (e *jsonEncoder) Encode(c *models.CDR) error {
+	if e.tenant {
+		return e.enc.Encode(c.TenantView())
+	}
+	return e.enc.Encode(c)
+}
+
+func (e *jsonEncoder) Flush() error {
+	return nil
+}
+
+// formatTime formats a timestamp as RFC 3339 in UTC, or an empty string
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
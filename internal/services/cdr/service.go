@@ -0,0 +1,277 @@
+package cdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/pkg/utils"
+)
+
+var (
+	// ErrInvalidFormat is returned for CDR formats other than CSV and JSON
+	ErrInvalidFormat = errors.New("invalid CDR format")
+	// ErrInvalidRange is returned for export ranges that end before they start
+	ErrInvalidRange = errors.New("invalid CDR range")
+)
+
+// finalStatuses are the statuses a CDR is written on
+var finalStatuses = map[models.MessageStatus]bool{
+	models.StatusDelivered: true,
+	models.StatusRouted:    true,
+	models.StatusFailed:    true,
+	models.StatusExpired:   true,
+	models.StatusRejected:  true,
+}
+
+// dailyFile is the CDR file of one format for the current day
+type dailyFile struct {
+	day  string
+	file *os.File
+	enc  Encoder
+}
+
+// Service writes a call detail record for every message reaching a final
+// status. Records are stored in the database, which holds them all, and
+// appended to daily files of the configured formats; each instance writes
+// the files of the messages it finished.
+type Service struct {
+	cfg    config.CDRConfig
+	db     *db.Database
+	log    *logrus.Logger
+	mu     sync.Mutex
+	active bool
+	files  map[string]*dailyFile // by format
+}
+
+func New(cfg config.CDRConfig, database *db.Database, log *logrus.Logger) *Service {
+	return &Service{
+		cfg:   cfg,
+		db:    database,
+		log:   log,
+		files: make(map[string]*dailyFile),
+	}
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("CDR service is already running")
+	}
+	if !s.cfg.Enabled {
+		s.log.Info("CDR generation is disabled")
+		return nil
+	}
+
+	for _, format := range s.cfg.Formats {
+		if format != FormatCSV && format != FormatJSON {
+			return fmt.Errorf("invalid CDR format: %q", format)
+		}
+	}
+	if s.cfg.Directory != "" {
+		if err := os.MkdirAll(s.cfg.Directory, 0o755); err != nil {
+			return fmt.Errorf("failed to create CDR directory: %w", err)
+		}
+	}
+
+	s.active = true
+	s.log.WithField("directory", s.cfg.Directory).Info("CDR service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	for format, f := range s.files {
+		if err := f.file.Close(); err != nil {
+			s.log.WithError(err).WithField("file", f.file.Name()).Warn("Failed to close CDR file")
+		}
+		delete(s.files, format)
+	}
+
+	s.active = false
+	s.log.Info("CDR service stopped")
+	return nil
+}
+
+func (s *Service) running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+// Record writes the CDR of a message that reached a final status. It is a
+// status listener of the message pipeline and runs after billing, so the
+// record carries the settled charge. A message only gets one record; later
+// statuses, such as a late delivery receipt, are ignored. Failures are
+// logged.
+func (s *Service) Record(ctx context.Context, messageID int64, status models.MessageStatus) {
+	if !finalStatuses[status] || !s.running() {
+		return
+	}
+
+	msg, err := s.db.GetMessage(ctx, messageID)
+	if err != nil {
+		s.log.WithError(err).WithField("message_id", messageID).Error("Failed to load message for CDR")
+		return
+	}
+
+	c := fromMessage(msg, status, time.Now())
+	written, err := s.db.InsertCDR(ctx, c)
+	if err != nil {
+		s.log.WithError(err).WithField("message_id", messageID).Error("Failed to store CDR")
+		return
+	}
+	if written {
+		s.write(c)
+	}
+}
+
+// List returns a page of CDRs completed in a range
+func (s *Service) List(ctx context.Context, filter db.CDRFilter) ([]*models.CDR, string, error) {
+	if err := checkRange(filter); err != nil {
+		return nil, "", err
+	}
+	return s.db.ListCDRs(ctx, filter)
+}
+
+// Export writes every CDR completed in a range to w in a format, in the
+// tenant view when tenant is set. It does not need the service to be
+// running, so it serves offline exports as well.
+func (s *Service) Export(ctx context.Context, w io.Writer, format string, filter db.CDRFilter, tenant bool) error {
+	if err := checkRange(filter); err != nil {
+		return err
+	}
+	enc, err := NewEncoder(w, format, true, tenant)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.ExportCDRs(ctx, filter, enc.Encode); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// write appends a CDR to the daily file of every configured format. Records
+// go to the file of the day they completed, in UTC.
+func (s *Service) write(c *models.CDR) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active || s.cfg.Directory == "" {
+		return
+	}
+
+	day := c.CompletedAt.UTC().Format("2006-01-02")
+	for _, format := range s.cfg.Formats {
+		f, err := s.file(format, day)
+		if err == nil {
+			if err = f.enc.Encode(c); err == nil {
+				err = f.enc.Flush()
+			}
+		}
+		if err != nil {
+			s.log.WithError(err).WithFields(logrus.Fields{
+				"message_id": c.MessageID,
+				"format":     format,
+			}).Error("Failed to write CDR file")
+		}
+	}
+}
+
+// file returns the file of a format for a day, closing the previous day's
+// file. The caller must hold the lock.
+func (s *Service) file(format, day string) (*dailyFile, error) {
+	if f, ok := s.files[format]; ok {
+		if f.day == day {
+			return f, nil
+		}
+		if err := f.file.Close(); err != nil {
+			s.log.WithError(err).WithField("file", f.file.Name()).Warn("Failed to close CDR file")
+		}
+		delete(s.files, format)
+	}
+
+	path := filepath.Join(s.cfg.Directory, "cdr-"+day+"."+format)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CDR file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open CDR file: %w", err)
+	}
+
+	// New files start with a CSV header
+	enc, err := NewEncoder(file, format, info.Size() == 0, false)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	f := &dailyFile{day: day, file: file, enc: enc}
+	s.files[format] = f
+	return f, nil
+}
+
+// fromMessage builds the CDR of a message that reached a final status
+func fromMessage(msg *models.Message, status models.MessageStatus, completed time.Time) *models.CDR {
+	encoding, segments := utils.Segments(msg.Content)
+	if msg.Encoding != "" {
+		encoding = msg.Encoding
+	}
+
+	c := &models.CDR{
+		MessageID:     msg.ID,
+		SMPPMessageID: msg.MessageID,
+		UpstreamID:    msg.UpstreamID,
+		ClientID:      msg.ClientID,
+		Sender:        msg.Sender,
+		Recipient:     msg.Recipient,
+		Country:       utils.CallingCode(msg.Recipient),
+		Destination:   msg.Destination,
+		OperatorID:    msg.OperatorID,
+		Status:        status,
+		Error:         msg.LastError,
+		Segments:      segments,
+		Encoding:      encoding,
+		Cost:          msg.Cost,
+		Price:         msg.Price,
+		Charge:        msg.BillingInfo,
+		SubmittedAt:   msg.CreatedAt,
+		SentAt:        msg.SentAt,
+		DeliveredAt:   msg.DeliveredAt,
+		CompletedAt:   completed,
+	}
+	if msg.CampaignID != nil {
+		c.CampaignID = *msg.CampaignID
+	}
+	return c
+}
+
+// checkRange rejects ranges that end before they start
+func checkRange(filter db.CDRFilter) error {
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"smsc/internal/models"
+)
+
+// pageTemplate renders an invoice as a standalone HTML page that prints on
+// A4 paper
+var pageTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": func(v float64) string { return fmt.Sprintf("%.2f", v) },
+	"unit":  func(v float64) string { return fmt.Sprintf("%.6f", v) },
+	"neg":   func(v float64) string { return fmt.Sprintf("-%.2f", v) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Invoice.Number}}</title>
+<style>
+@page { size: A4; margin: 20mm; }
+body { font-family: Helvetica, Arial, sans-serif; font-size: 10pt; color: #222; }
+h1 { font-size: 18pt; margin: 0 0 4mm; }
+table { width: 100%; border-collapse: collapse; margin-top: 6mm; }
+th, td { padding: 1.5mm 2mm; border-bottom: 1px solid #ddd; text-align: left; }
+th.num, td.num { text-align: right; }
+tfoot td { border: none; }
+tfoot tr.total td { font-weight: bold; border-top: 2px solid #222; }
+.meta td { border: none; padding: 0.5mm 2mm 0.5mm 0; }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Invoice.Number}}</h1>
+<table class="meta">
+{{if .Issuer}}<tr><td>Issuer</td><td>{{.Issuer}}</td></tr>{{end}}
+<tr><td>Customer</td><td>{{.Invoice.ClientID}}</td></tr>
+<tr><td>Period</td><td>{{.Invoice.Period}}</td></tr>
+<tr><td>Issued</td><td>{{.Invoice.IssuedAt.Format "2006-01-02"}}</td></tr>
+<tr><td>Currency</td><td>{{.Invoice.Currency}}</td></tr>
+</table>
+<table>
+<thead>
+<tr><th>Description</th><th class="num">Messages</th><th class="num">Unit price</th><th class="num">Amount</th></tr>
+</thead>
+<tbody>
+{{range .Invoice.Lines}}<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{unit .UnitPrice}}</td><td class="num">{{money .Amount}}</td></tr>
+{{else}}<tr><td colspan="4">No usage in this period</td></tr>
+{{end}}</tbody>
+<tfoot>
+<tr><td colspan="3" class="num">Subtotal</td><td class="num">{{money .Invoice.Subtotal}}</td></tr>
+{{range .Invoice.Credits}}<tr><td colspan="3" class="num">Credit: {{.Description}}</td><td class="num">{{neg .Amount}}</td></tr>
+{{end}}<tr><td colspan="3" class="num">{{.TaxLabel}}</td><td class="num">{{money .Invoice.Tax}}</td></tr>
+<tr class="total"><td colspan="3" class="num">Total {{.Invoice.Currency}}</td><td class="num">{{money .Invoice.Total}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+// RenderHTML writes an invoice as an HTML page
+func (s *Service) RenderHTML(w io.Writer, inv *models.Invoice) error {
+	return pageTemplate.Execute(w, struct {
+		Invoice  *models.Invoice
+		Issuer   string
+		TaxLabel string
+	}{inv, s.cfg.Issuer, taxLabel(inv)})
+}
+
+// RenderPDF writes an invoice as a PDF document
+func (s *Service) RenderPDF(w io.Writer, inv *models.Invoice) error {
+	_, err := w.Write(writePDF(invoiceText(inv, s.cfg.Issuer)))
+	return err
+}
+
+// invoiceText lays an invoice out as lines of fixed-width text
+func invoiceText(inv *models.Invoice, issuer string) []string {
+	const width = 86
+	amount := func(label, value string) string {
+		return fmt.Sprintf("%*s %14s", width-15, label, value)
+	}
+
+	lines := []string{"INVOICE " + inv.Number, ""}
+	if issuer != "" {
+		lines = append(lines, "Issuer:    "+issuer)
+	}
+	lines = append(lines,
+		"Customer:  "+inv.ClientID,
+		"Period:    "+inv.Period,
+		"Issued:    "+inv.IssuedAt.Format("2006-01-02"),
+		"Currency:  "+inv.Currency,
+		"",
+		fmt.Sprintf("%-44s %12s %13s %14s", "Description", "Messages", "Unit price", "Amount"),
+		strings.Repeat("-", width),
+	)
+	for _, l := range inv.Lines {
+		lines = append(lines, fmt.Sprintf("%-44.44s %12d %13.6f %14.2f", l.Description, l.Quantity, l.UnitPrice, l.Amount))
+	}
+	if len(inv.Lines) == 0 {
+		lines = append(lines, "No usage in this period")
+	}
+	lines = append(lines, strings.Repeat("-", width), amount("Subtotal", fmt.Sprintf("%.2f", inv.Subtotal)))
+	for _, c := range inv.Credits {
+		lines = append(lines, amount(truncate("Credit: "+c.Description, width-16), fmt.Sprintf("-%.2f", c.Amount)))
+	}
+	lines = append(lines,
+		amount(taxLabel(inv), fmt.Sprintf("%.2f", inv.Tax)),
+		amount("Total "+inv.Currency, fmt.Sprintf("%.2f", inv.Total)),
+	)
+	return lines
+}
+
+func taxLabel(inv *models.Invoice) string {
+	name := inv.TaxName
+	if name == "" {
+		name = "Tax"
+	}
+	return fmt.Sprintf("%s (%g%%)", name, inv.TaxRate)
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// PDF page layout in points: A4 with Courier text
+const (
+	pdfWidth    = 595
+	pdfHeight   = 842
+	pdfMargin   = 50
+	pdfFontSize = 8
+	pdfLeading  = 11
+)
+
+// writePDF lays out lines of text on as many A4 pages as they need, in the
+// standard Courier font so columns line up
+func writePDF(lines []string) []byte {
+	perPage := (pdfHeight - 2*pdfMargin) / pdfLeading
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	// Objects 1 and 2 are the catalog and page tree, 3 the font; each page
+	// then takes a page and a content object
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pdfWidth, pdfHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape escapes a line for a PDF string. Characters outside Latin-1 are
+// replaced, since the standard fonts cannot show them.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
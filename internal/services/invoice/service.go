@@ -0,0 +1,225 @@
+package invoice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+)
+
+const periodLayout = "2006-01"
+
+var (
+	// ErrInvalidPeriod is returned for periods that are malformed or not over yet
+	ErrInvalidPeriod = errors.New("invalid invoice period")
+	// ErrInvalidCredit is returned for credits that cannot be applied
+	ErrInvalidCredit = errors.New("invalid invoice credit")
+)
+
+// Service builds monthly usage statements of tenants from their CDRs and
+// issues invoices for them. Usage is charged at the price each message was
+// rated at; credits are taken off before tax.
+type Service struct {
+	cfg    config.InvoiceConfig
+	db     *db.Database
+	log    *logrus.Logger
+	mu     sync.Mutex
+	active bool
+}
+
+func New(cfg config.InvoiceConfig, database *db.Database, log *logrus.Logger) *Service {
+	if cfg.Currency == "" {
+		cfg.Currency = "EUR"
+	}
+	if cfg.NumberPrefix == "" {
+		cfg.NumberPrefix = "INV-"
+	}
+
+	return &Service{
+		cfg: cfg,
+		db:  database,
+		log: log,
+	}
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("invoice service is already running")
+	}
+	if len(s.cfg.Currency) != 3 {
+		return fmt.Errorf("invalid invoice currency: %q", s.cfg.Currency)
+	}
+	if s.cfg.TaxRate < 0 || s.cfg.TaxRate > 100 {
+		return fmt.Errorf("invalid invoice tax rate: %v", s.cfg.TaxRate)
+	}
+
+	s.active = true
+	s.log.Info("Invoice service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	s.active = false
+	s.log.Info("Invoice service stopped")
+	return nil
+}
+
+// Usage returns the usage of a client in a YYYY-MM period per destination
+// country and network
+func (s *Service) Usage(ctx context.Context, clientID, period string) (*models.UsageStatement, error) {
+	from, to, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := s.db.UsageByDestination(ctx, clientID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &models.UsageStatement{
+		ClientID: clientID,
+		Period:   period,
+		From:     from,
+		To:       to,
+		Lines:    lines,
+	}
+	for _, l := range lines {
+		statement.Messages += l.Messages
+		statement.Segments += l.Segments
+		statement.Amount += l.Amount
+	}
+	return statement, nil
+}
+
+// Generate issues the invoice of a client for a YYYY-MM period that is over.
+// Each destination of the usage statement becomes a line; the credits are
+// taken off the subtotal and tax is added to the rest. A client is invoiced
+// once per period; db.ErrInvoiceExists is returned after that.
+func (s *Service) Generate(ctx context.Context, clientID, period string, credits []models.InvoiceCredit) (*models.Invoice, error) {
+	usage, err := s.Usage(ctx, clientID, period)
+	if err != nil {
+		return nil, err
+	}
+	if usage.To.After(time.Now()) {
+		return nil, fmt.Errorf("%w: %s is not over yet", ErrInvalidPeriod, period)
+	}
+
+	inv, err := s.draft(usage, credits)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.CreateInvoice(ctx, inv, s.cfg.NumberPrefix); err != nil {
+		return nil, err
+	}
+
+	s.log.WithFields(logrus.Fields{
+		"invoice":   inv.Number,
+		"client_id": clientID,
+		"period":    period,
+		"total":     inv.Total,
+	}).Info("Invoice issued")
+	return inv, nil
+}
+
+// draft builds the lines and totals of the invoice of a usage statement
+func (s *Service) draft(usage *models.UsageStatement, credits []models.InvoiceCredit) (*models.Invoice, error) {
+	inv := &models.Invoice{
+		ClientID: usage.ClientID,
+		Period:   usage.Period,
+		Currency: s.cfg.Currency,
+		Lines:    make([]models.InvoiceLine, 0, len(usage.Lines)),
+		Credits:  make([]models.InvoiceCredit, 0, len(credits)),
+		TaxName:  s.cfg.TaxName,
+		TaxRate:  s.cfg.TaxRate,
+	}
+	for _, l := range usage.Lines {
+		line := models.InvoiceLine{
+			Description: describe(l),
+			Country:     l.Country,
+			Network:     l.Network,
+			Quantity:    l.Messages,
+			Amount:      round(l.Amount, 2),
+		}
+		if l.Messages > 0 {
+			line.UnitPrice = round(l.Amount/float64(l.Messages), 6)
+		}
+		inv.Lines = append(inv.Lines, line)
+		inv.Subtotal += line.Amount
+	}
+
+	for i, c := range credits {
+		c.Description = strings.TrimSpace(c.Description)
+		c.Amount = round(c.Amount, 2)
+		if c.Description == "" || c.Amount <= 0 {
+			return nil, fmt.Errorf("%w: credit %d needs a description and a positive amount", ErrInvalidCredit, i+1)
+		}
+		inv.Credits = append(inv.Credits, c)
+		inv.CreditTotal += c.Amount
+	}
+
+	inv.Subtotal = round(inv.Subtotal, 2)
+	inv.CreditTotal = round(inv.CreditTotal, 2)
+	if inv.CreditTotal > inv.Subtotal {
+		return nil, fmt.Errorf("%w: credits of %.2f exceed the subtotal of %.2f", ErrInvalidCredit, inv.CreditTotal, inv.Subtotal)
+	}
+	taxable := inv.Subtotal - inv.CreditTotal
+	inv.Tax = round(taxable*inv.TaxRate/100, 2)
+	inv.Total = round(taxable+inv.Tax, 2)
+	return inv, nil
+}
+
+// Invoice returns an invoice by ID
+func (s *Service) Invoice(ctx context.Context, id int64) (*models.Invoice, error) {
+	return s.db.GetInvoice(ctx, id)
+}
+
+// Invoices returns a page of the invoices of a client, or of every client
+// when clientID is empty
+func (s *Service) Invoices(ctx context.Context, clientID string, limit int, cursor string) ([]*models.Invoice, string, error) {
+	return s.db.ListInvoices(ctx, clientID, limit, cursor)
+}
+
+// parsePeriod returns the UTC range of a YYYY-MM period
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	from, err := time.Parse(periodLayout, period)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: expected YYYY-MM: %q", ErrInvalidPeriod, period)
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// describe names the destination of a usage line
+func describe(l models.UsageLine) string {
+	country := "+" + l.Country
+	if l.Country == "" {
+		country = "unknown country"
+	}
+	if l.Network != "" {
+		return fmt.Sprintf("SMS to %s (%s)", country, l.Network)
+	}
+	return "SMS to " + country
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
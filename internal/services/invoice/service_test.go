@@ -0,0 +1,146 @@
+package invoice
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/models"
+)
+
+func newTestService(taxRate float64) *Service {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return New(config.InvoiceConfig{TaxName: "VAT", TaxRate: taxRate}, nil, log)
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		v      float64
+		places int
+		want   float64
+	}{
+		{10.004, 2, 10},
+		{2.126, 2, 2.13},
+		{-2.126, 2, -2.13},
+		{0.1 + 0.2, 2, 0.3},
+		{1.0 / 3, 6, 0.333333},
+		{2.5, 0, 3},
+	}
+	for _, tt := range tests {
+		if got := round(tt.v, tt.places); got != tt.want {
+			t.Errorf("round(%v, %d) = %v, want %v", tt.v, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestDraftTotals(t *testing.T) {
+	usage := &models.UsageStatement{
+		ClientID: "acme",
+		Period:   "2026-05",
+		Lines: []models.UsageLine{
+			{Country: "44", Messages: 3, Amount: 10.004},
+			{Country: "90", Network: "turkcell", Messages: 7, Amount: 2.126},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		taxRate     float64
+		credits     []models.InvoiceCredit
+		creditTotal float64
+		tax         float64
+		total       float64
+	}{
+		{"no credits or tax", 0, nil, 0, 0, 12.13},
+		{"tax on the subtotal", 20, nil, 0, 2.43, 14.56},
+		{"credit rounded before it is taken off", 20, []models.InvoiceCredit{{Description: "goodwill", Amount: 2.134}}, 2.13, 2, 12},
+		{"credits summed after rounding", 0, []models.InvoiceCredit{
+			{Description: "a", Amount: 0.333},
+			{Description: "b", Amount: 0.333},
+			{Description: "c", Amount: 0.333},
+		}, 0.99, 0, 11.14},
+		{"tax rounded", 18, []models.InvoiceCredit{{Description: "outage", Amount: 2.14}}, 2.14, 1.8, 11.79},
+		{"credit of the whole subtotal", 20, []models.InvoiceCredit{{Description: "waived", Amount: 12.13}}, 12.13, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := newTestService(tt.taxRate).draft(usage, tt.credits)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inv.Subtotal != 12.13 {
+				t.Errorf("subtotal %v, want 12.13", inv.Subtotal)
+			}
+			if inv.CreditTotal != tt.creditTotal {
+				t.Errorf("credit total %v, want %v", inv.CreditTotal, tt.creditTotal)
+			}
+			if inv.Tax != tt.tax {
+				t.Errorf("tax %v, want %v", inv.Tax, tt.tax)
+			}
+			if inv.Total != tt.total {
+				t.Errorf("total %v, want %v", inv.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestDraftLines(t *testing.T) {
+	usage := &models.UsageStatement{
+		ClientID: "acme",
+		Period:   "2026-05",
+		Lines: []models.UsageLine{
+			{Country: "44", Messages: 3, Amount: 1},
+			{Country: "90", Network: "turkcell", Messages: 0, Amount: 0},
+		},
+	}
+
+	inv, err := newTestService(0).draft(usage, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.ClientID != "acme" || inv.Period != "2026-05" || inv.Currency != "EUR" || inv.TaxName != "VAT" {
+		t.Errorf("invoice header %q %q %q %q", inv.ClientID, inv.Period, inv.Currency, inv.TaxName)
+	}
+	if len(inv.Lines) != 2 {
+		t.Fatalf("%d lines, want 2", len(inv.Lines))
+	}
+	if l := inv.Lines[0]; l.Description != "SMS to +44" || l.Quantity != 3 || l.UnitPrice != 0.333333 || l.Amount != 1 {
+		t.Errorf("first line %+v", l)
+	}
+	if l := inv.Lines[1]; l.Description != "SMS to +90 (turkcell)" || l.UnitPrice != 0 {
+		t.Errorf("second line %+v", l)
+	}
+}
+
+func TestDraftRejectsCredits(t *testing.T) {
+	usage := &models.UsageStatement{
+		ClientID: "acme",
+		Period:   "2026-05",
+		Lines:    []models.UsageLine{{Country: "44", Messages: 10, Amount: 5}},
+	}
+
+	tests := []struct {
+		name    string
+		credits []models.InvoiceCredit
+	}{
+		{"exceeding the subtotal", []models.InvoiceCredit{{Description: "refund", Amount: 5.01}}},
+		{"together exceeding the subtotal", []models.InvoiceCredit{
+			{Description: "a", Amount: 3},
+			{Description: "b", Amount: 2.006},
+		}},
+		{"without a description", []models.InvoiceCredit{{Description: " ", Amount: 1}}},
+		{"negative", []models.InvoiceCredit{{Description: "refund", Amount: -1}}},
+		{"rounding to nothing", []models.InvoiceCredit{{Description: "refund", Amount: 0.004}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := newTestService(20).draft(usage, tt.credits)
+			if !errors.Is(err, ErrInvalidCredit) {
+				t.Errorf("got invoice %+v and error %v, want %v", inv, err, ErrInvalidCredit)
+			}
+		})
+	}
+}
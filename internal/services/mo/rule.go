@@ -0,0 +1,128 @@
+package mo
+
+import (
+	"fmt"
+	"strings"
+
+	"smsc/internal/config"
+	"smsc/internal/services/webhook"
+)
+
+// Rule routes inbound messages to a consumer. A rule matches on the short
+// code or number the message was sent to and, when Keyword is set, on the
+// first word of its content. Exactly one of SystemID and URL names the
+// consumer.
+type Rule struct {
+	ID        string `json:"id"`
+	Name      string `json:"name,omitempty"`
+	ShortCode string `json:"shortCode,omitempty"`
+	Number    string `json:"number,omitempty"` // destination prefix pattern, e.g. "+4470*"
+	Keyword   string `json:"keyword,omitempty"`
+	Priority  int    `json:"priority"`
+	SystemID  string `json:"systemId,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// ruleFromConfig converts a configured MO rule
+func ruleFromConfig(cfg config.MORuleConfig) Rule {
+	return Rule{
+		Name:      cfg.Name,
+		ShortCode: cfg.ShortCode,
+		Number:    cfg.Number,
+		Keyword:   cfg.Keyword,
+		Priority:  cfg.Priority,
+		SystemID:  cfg.SystemID,
+		URL:       cfg.URL,
+	}
+}
+
+// compile validates the rule and normalizes its keyword
+func (r *Rule) compile() error {
+	if (r.SystemID == "") == (r.URL == "") {
+		return fmt.Errorf("rule needs exactly one of system ID and URL")
+	}
+	if r.URL != "" {
+		if err := webhook.CheckURL(r.URL); err != nil {
+			return fmt.Errorf("invalid rule URL: %w", err)
+		}
+	}
+
+	if r.ShortCode == "" && r.Number == "" && r.Keyword == "" {
+		return fmt.Errorf("rule needs a short code, number or keyword")
+	}
+	if r.ShortCode != "" && r.Number != "" {
+		return fmt.Errorf("rule can match a short code or a number, not both")
+	}
+	if r.ShortCode != "" && (!isDigits(r.ShortCode) || len(r.ShortCode) < 3 || len(r.ShortCode) > 8) {
+		return fmt.Errorf("invalid short code: %s", r.ShortCode)
+	}
+	if r.Number != "" && !isDigits(r.prefix()) {
+		return fmt.Errorf("invalid number pattern: %s", r.Number)
+	}
+
+	r.Keyword = strings.ToUpper(strings.TrimSpace(r.Keyword))
+	if strings.ContainsAny(r.Keyword, " \t\r\n") {
+		return fmt.Errorf("keyword must be a single word: %s", r.Keyword)
+	}
+
+	return nil
+}
+
+// prefix returns the destination prefix a number pattern matches on
+func (r Rule) prefix() string {
+	return strings.TrimSuffix(strings.TrimPrefix(r.Number, "+"), "*")
+}
+
+// matches reports whether the rule matches a destination and keyword
+func (r Rule) matches(destination, keyword string) bool {
+	if r.Keyword != "" && r.Keyword != keyword {
+		return false
+	}
+	if r.ShortCode != "" && destination != r.ShortCode {
+		return false
+	}
+	if r.Number != "" {
+		if strings.HasSuffix(r.Number, "*") {
+			return strings.HasPrefix(destination, r.prefix())
+		}
+		return destination == r.prefix()
+	}
+	return true
+}
+
+// specificity ranks rules so that keyword rules win over plain destination
+// rules, short codes win over numbers and longer number prefixes win over
+// shorter ones
+func (r Rule) specificity() int {
+	n := len(r.prefix())
+	if r.ShortCode != "" {
+		n += 100
+	}
+	if r.Keyword != "" {
+		n += 1000
+	}
+	return n
+}
+
+// firstWord returns the keyword of a message: its first word, upper case
+func firstWord(content string) string {
+	fields := strings.Fields(content)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// normalizeNumber strips the formatting of a destination address
+func normalizeNumber(number string) string {
+	return strings.TrimPrefix(strings.TrimSpace(number), "+")
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
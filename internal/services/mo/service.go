@@ -0,0 +1,611 @@
+package mo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/protocols/smpp"
+	"smsc/internal/services/webhook"
+)
+
+// EventInbound is the event type of MO messages posted to HTTP consumers
+const EventInbound = "message.inbound"
+
+const (
+	defaultTimeout       = 10 * time.Second
+	defaultWorkers       = 4
+	defaultRetryInterval = 30 * time.Second
+	defaultMaxBackoff    = 30 * time.Minute
+	defaultMaxAttempts   = 10
+	pollInterval         = time.Second
+	expireInterval       = time.Minute
+	// claimFactor is the number of messages claimed per worker at a time
+	claimFactor = 4
+	// maxResponseBody bounds how much of a failed response is kept
+	maxResponseBody = 512
+	// configRulePrefix starts the IDs of rules defined in the configuration,
+	// which are not stored and cannot be changed through the API
+	configRulePrefix = "config-"
+)
+
+var (
+	// ErrDisabled is returned when inbound messages arrive while MO routing is off
+	ErrDisabled = errors.New("MO routing is disabled")
+	// ErrInvalidMessage is returned for inbound messages missing their addresses
+	ErrInvalidMessage = errors.New("invalid MO message")
+)
+
+// Payload is the JSON body posted to HTTP consumers
+type Payload struct {
+	Event       string    `json:"event"`
+	ID          int64     `json:"id"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Content     string    `json:"content"`
+	Keyword     string    `json:"keyword,omitempty"`
+	DataCoding  int       `json:"dataCoding"`
+	Origin      string    `json:"origin"`
+	OperatorID  string    `json:"operatorId,omitempty"`
+	ReceivedAt  time.Time `json:"receivedAt"`
+}
+
+// Service routes mobile-originated messages to their consumers. Messages are
+// stored as soon as they arrive and stay queued while the consumer is
+// offline: until a receiver of the ESME binds, or the HTTP endpoint accepts
+// them.
+type Service struct {
+	cfg      config.MOConfig
+	db       *db.Database
+	smpp     *smpp.Server
+	client   *http.Client
+	log      *logrus.Logger
+	mu       sync.RWMutex
+	active   bool
+	rules    []Rule
+	nextRule int
+	wake     chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func New(cfg config.MOConfig, database *db.Database, smppServer *smpp.Server, log *logrus.Logger) *Service {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+
+	return &Service{
+		cfg:    cfg,
+		db:     database,
+		smpp:   smppServer,
+		client: webhook.NewClient(cfg.Timeout),
+		log:    log,
+		rules:  make([]Rule, 0),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// SetHTTPClient replaces the client HTTP consumers are called with. The client
+// is used as is, without the address checks of webhook.NewClient. It must be
+// called before Start.
+func (s *Service) SetHTTPClient(client *http.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("MO service is already running")
+	}
+	if !s.cfg.Enabled {
+		s.log.Info("MO routing is disabled")
+		return nil
+	}
+
+	for _, cfg := range s.cfg.Rules {
+		if _, err := s.addRule(ruleFromConfig(cfg)); err != nil {
+			return fmt.Errorf("invalid MO rule %q: %w", cfg.Name, err)
+		}
+	}
+	if err := s.loadRules(ctx); err != nil {
+		return err
+	}
+
+	if s.smpp != nil {
+		s.smpp.SetBindHandler(s.receiverBound)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	jobs := make(chan *models.MOMessage, s.cfg.Workers)
+	s.wg.Add(1)
+	go s.dispatch(ctx, jobs)
+	for i := 0; i < s.cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.work(ctx, jobs)
+	}
+
+	s.active = true
+	s.log.WithField("rules", len(s.rules)).Info("MO service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return nil
+	}
+	s.active = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop MO workers: %w", ctx.Err())
+	}
+
+	s.log.Info("MO service stopped")
+	return nil
+}
+
+// Receive matches an inbound message against the MO rules and stores it for
+// delivery to the consumer of the matching rule. Messages no rule matches are
+// stored as unroutable.
+func (s *Service) Receive(ctx context.Context, mo *models.MOMessage) error {
+	if !s.cfg.Enabled {
+		return ErrDisabled
+	}
+	if mo.Source == "" || mo.Destination == "" {
+		return fmt.Errorf("%w: source and destination are required", ErrInvalidMessage)
+	}
+
+	mo.ID = 0
+	mo.Keyword = firstWord(mo.Content)
+	mo.Attempts = 0
+	mo.LastError = ""
+	mo.NextAttemptAt = time.Now()
+	mo.DeliveredAt = nil
+
+	if rule, ok := s.match(normalizeNumber(mo.Destination), mo.Keyword); ok {
+		mo.RuleID = rule.ID
+		mo.SystemID = rule.SystemID
+		mo.URL = rule.URL
+		mo.Status = models.MOQueued
+		if rule.Keyword == "" {
+			mo.Keyword = ""
+		}
+	} else {
+		mo.Status = models.MOUnroutable
+		mo.Keyword = ""
+		mo.LastError = "no MO rule matched"
+	}
+
+	if err := s.db.InsertMO(ctx, mo); err != nil {
+		return err
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"mo_id":       mo.ID,
+		"source":      mo.Source,
+		"destination": mo.Destination,
+		"origin":      mo.Origin,
+	})
+	if mo.Status == models.MOUnroutable {
+		log.Warn("Unroutable MO message")
+		return nil
+	}
+	log.WithField("rule_id", mo.RuleID).Debug("MO message queued")
+
+	s.signal()
+	return nil
+}
+
+// Rules returns the MO rules ordered by specificity and priority
+func (s *Service) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]Rule, len(s.rules))
+	copy(rules, s.rules)
+	return rules
+}
+
+// AddRule validates and stores an MO rule, returning it with its assigned ID
+func (s *Service) AddRule(ctx context.Context, rule Rule) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule.ID = ""
+	if err := rule.compile(); err != nil {
+		return Rule{}, err
+	}
+
+	definition, err := json.Marshal(rule)
+	if err != nil {
+		return Rule{}, fmt.Errorf("failed to encode MO rule: %w", err)
+	}
+	id, err := s.db.InsertMORule(ctx, definition)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.ID = strconv.FormatInt(id, 10)
+
+	s.rules = append(s.rules, rule)
+	s.sortRules()
+	return rule, nil
+}
+
+// UpdateRule replaces the MO rule with the given ID
+func (s *Service) UpdateRule(ctx context.Context, id string, rule Rule) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, storedID, err := s.findRule(id)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.ID = ""
+	if err := rule.compile(); err != nil {
+		return Rule{}, err
+	}
+
+	definition, err := json.Marshal(rule)
+	if err != nil {
+		return Rule{}, fmt.Errorf("failed to encode MO rule: %w", err)
+	}
+	if err := s.db.UpdateMORule(ctx, storedID, definition); err != nil {
+		return Rule{}, err
+	}
+
+	rule.ID = id
+	s.rules[i] = rule
+	s.sortRules()
+	return rule, nil
+}
+
+// RemoveRule removes the MO rule with the given ID. Messages already queued
+// for its consumer are still delivered.
+func (s *Service) RemoveRule(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, storedID, err := s.findRule(id)
+	if err != nil {
+		return err
+	}
+	if err := s.db.DeleteMORule(ctx, storedID); err != nil && !errors.Is(err, db.ErrNotFound) {
+		return err
+	}
+
+	s.rules = append(s.rules[:i], s.rules[i+1:]...)
+	return nil
+}
+
+// findRule returns the index and stored ID of a rule the API may change. The
+// caller must hold the lock.
+func (s *Service) findRule(id string) (int, int64, error) {
+	if strings.HasPrefix(id, configRulePrefix) {
+		return 0, 0, fmt.Errorf("MO rule %s is defined in the configuration", id)
+	}
+	storedID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("MO rule not found: %s", id)
+	}
+	for i := range s.rules {
+		if s.rules[i].ID == id {
+			return i, storedID, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("MO rule not found: %s", id)
+}
+
+// addRule validates a rule from the configuration, assigns its ID and
+// inserts it in order. The caller must hold the write lock.
+func (s *Service) addRule(rule Rule) (Rule, error) {
+	if err := rule.compile(); err != nil {
+		return Rule{}, err
+	}
+
+	s.nextRule++
+	rule.ID = configRulePrefix + strconv.Itoa(s.nextRule)
+	s.rules = append(s.rules, rule)
+	s.sortRules()
+	return rule, nil
+}
+
+// loadRules adds the rules stored through the API. Rules that no longer
+// validate are skipped. The caller must hold the write lock.
+func (s *Service) loadRules(ctx context.Context) error {
+	rows, err := s.db.ListMORules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var rule Rule
+		err := json.Unmarshal(row.Definition, &rule)
+		if err == nil {
+			err = rule.compile()
+		}
+		if err != nil {
+			s.log.WithError(err).WithField("rule_id", row.ID).Warn("Skipping invalid stored MO rule")
+			continue
+		}
+		rule.ID = strconv.FormatInt(row.ID, 10)
+		s.rules = append(s.rules, rule)
+	}
+	s.sortRules()
+	return nil
+}
+
+// sortRules orders the rules so that the first match is the most specific,
+// then the one with the lowest priority value
+func (s *Service) sortRules() {
+	sort.SliceStable(s.rules, func(i, j int) bool {
+		a, b := s.rules[i], s.rules[j]
+		if a.specificity() != b.specificity() {
+			return a.specificity() > b.specificity()
+		}
+		return a.Priority < b.Priority
+	})
+}
+
+// match returns the rule an inbound message is routed by
+func (s *Service) match(destination, keyword string) (Rule, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rule := range s.rules {
+		if rule.matches(destination, keyword) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// receiverBound delivers the messages queued for an ESME once it binds
+func (s *Service) receiverBound(systemID string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		n, err := s.db.WakeMO(ctx, systemID)
+		if err != nil {
+			s.log.WithError(err).WithField("system_id", systemID).Error("Failed to release queued MO messages")
+			return
+		}
+		if n > 0 {
+			s.log.WithFields(logrus.Fields{"system_id": systemID, "messages": n}).Info("Delivering queued MO messages")
+			s.signal()
+		}
+	}()
+}
+
+// dispatch claims due messages and hands them to the workers
+func (s *Service) dispatch(ctx context.Context, jobs chan<- *models.MOMessage) {
+	defer s.wg.Done()
+	defer close(jobs)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	// A claimed message may wait behind a full batch per worker before it is
+	// sent, so the lease covers that plus its own attempt
+	batch := s.cfg.Workers * claimFactor
+	lease := s.cfg.Timeout * time.Duration(claimFactor+1)
+	var lastExpiry time.Time
+
+	for {
+		if s.cfg.MaxAge > 0 && time.Since(lastExpiry) >= expireInterval {
+			lastExpiry = time.Now()
+			if n, err := s.db.ExpireMO(ctx, time.Now().Add(-s.cfg.MaxAge)); err != nil && ctx.Err() == nil {
+				s.log.WithError(err).Error("Failed to expire MO messages")
+			} else if n > 0 {
+				s.log.WithField("messages", n).Warn("Expired undelivered MO messages")
+			}
+		}
+
+		messages, err := s.db.ClaimDueMO(ctx, batch, lease)
+		if err != nil && ctx.Err() == nil {
+			s.log.WithError(err).Error("Failed to claim MO messages")
+		}
+
+		for _, mo := range messages {
+			select {
+			case jobs <- mo:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// Keep draining while there is a backlog
+		if len(messages) == batch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Service) work(ctx context.Context, jobs <-chan *models.MOMessage) {
+	defer s.wg.Done()
+
+	for mo := range jobs {
+		s.attempt(ctx, mo)
+	}
+}
+
+// attempt delivers a message and records the outcome. Messages for an ESME
+// without a bound receiver wait without using up their attempts; failed
+// deliveries are retried with exponential backoff until the attempts run out.
+func (s *Service) attempt(ctx context.Context, mo *models.MOMessage) {
+	var err error
+	if mo.SystemID != "" {
+		err = s.deliverSMPP(ctx, mo)
+	} else {
+		err = s.deliverHTTP(ctx, mo)
+	}
+	if err != nil && ctx.Err() != nil {
+		// Shutting down: the lease expires and the message is picked up again
+		return
+	}
+
+	log := s.log.WithFields(logrus.Fields{
+		"mo_id":     mo.ID,
+		"system_id": mo.SystemID,
+		"url":       mo.URL,
+	})
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		mo.Attempts++
+		mo.Status = models.MODelivered
+		mo.LastError = ""
+		mo.DeliveredAt = &now
+		log.Debug("MO message delivered")
+	case errors.Is(err, smpp.ErrNotBound):
+		mo.LastError = err.Error()
+		mo.NextAttemptAt = time.Now().Add(s.cfg.RetryInterval)
+	default:
+		mo.Attempts++
+		mo.LastError = err.Error()
+		if mo.Attempts >= s.cfg.MaxAttempts {
+			mo.Status = models.MOFailed
+			log.WithError(err).Warn("MO delivery failed permanently")
+		} else {
+			mo.NextAttemptAt = time.Now().Add(s.backoff(mo.Attempts))
+			log.WithError(err).WithField("retry_at", mo.NextAttemptAt).Info("MO delivery failed, retrying")
+		}
+	}
+
+	updateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.db.UpdateMO(updateCtx, mo); err != nil {
+		log.WithError(err).Error("Failed to update MO message")
+	}
+}
+
+func (s *Service) deliverSMPP(ctx context.Context, mo *models.MOMessage) error {
+	if s.smpp == nil {
+		return smpp.ErrNotBound
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	return s.smpp.DeliverMO(ctx, mo.SystemID, mo)
+}
+
+// deliverHTTP posts a message to its HTTP consumer, signed like webhooks.
+// Consumers are called over https only.
+func (s *Service) deliverHTTP(ctx context.Context, mo *models.MOMessage) error {
+	if err := webhook.CheckURL(mo.URL); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(Payload{
+		Event:       EventInbound,
+		ID:          mo.ID,
+		Source:      mo.Source,
+		Destination: mo.Destination,
+		Content:     mo.Content,
+		Keyword:     mo.Keyword,
+		DataCoding:  mo.DataCoding,
+		Origin:      mo.Origin,
+		OperatorID:  mo.OperatorID,
+		ReceivedAt:  mo.ReceivedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode MO payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, mo.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create MO request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smsc-mo/1.0")
+	req.Header.Set("X-SMSC-Event", EventInbound)
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(s.cfg.Secret, time.Now(), body))
+
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("MO request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return fmt.Errorf("MO consumer returned %s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (s *Service) backoff(attempts int) time.Duration {
+	wait := s.cfg.RetryInterval
+	for i := 1; i < attempts && wait < s.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > s.cfg.MaxBackoff {
+		wait = s.cfg.MaxBackoff
+	}
+	return wait
+}
+
+// signal wakes up the dispatcher without blocking
+func (s *Service) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,38 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"smsc/internal/health"
+)
+
+func (s *Service) liveHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]health.Status{"status": health.StatusUp})
+}
+
+// readyHandler reports the component health registry, answering 503 while a
+// critical component is down
+func (s *Service) readyHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	registry := s.sources.Health
+	s.mu.Unlock()
+
+	if registry == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]health.Status{"status": health.StatusUnknown})
+		return
+	}
+
+	report := registry.Check(r.Context())
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
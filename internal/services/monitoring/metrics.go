@@ -0,0 +1,203 @@
+package monitoring
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"smsc/internal/health"
+	"smsc/internal/protocols/sigtran"
+	"smsc/internal/protocols/smpp"
+	"smsc/internal/services/queue"
+	"smsc/internal/services/routing"
+)
+
+const namespace = "smsc"
+
+// Sources are the components whose state is sampled into gauges on every
+// collection interval, and the health registry behind the readiness probe.
+// Nil sources are skipped.
+type Sources struct {
+	Health  *health.Registry
+	Queue   *queue.Service
+	Routing *routing.Service
+	SMPP    *smpp.Server
+	Sigtran *sigtran.Stack
+}
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	submitted  *prometheus.CounterVec
+	delivered  *prometheus.CounterVec
+	failed     *prometheus.CounterVec
+	dlrLatency *prometheus.HistogramVec
+
+	queueDepth   *prometheus.GaugeVec
+	smppSessions prometheus.Gauge
+	sigtranUp    prometheus.Gauge
+	sigtranSent  prometheus.Gauge
+	sigtranRecv  prometheus.Gauge
+	sigtranErrs  prometheus.Gauge
+
+	operatorTPS         *prometheus.GaugeVec
+	operatorInFlight    *prometheus.GaugeVec
+	operatorUtilization *prometheus.GaugeVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		submitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_submitted_total",
+			Help:      "Messages submitted to operators.",
+		}, []string{"client", "operator"}),
+		delivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_delivered_total",
+			Help:      "Messages confirmed delivered by a delivery receipt.",
+		}, []string{"client", "operator"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_failed_total",
+			Help:      "Messages that failed permanently.",
+		}, []string{"client", "operator"}),
+		dlrLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "dlr_latency_seconds",
+			Help:      "Time from operator submit to delivery receipt.",
+			Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 900, 3600},
+		}, []string{"operator"}),
+		queueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_depth",
+			Help:      "Messages waiting in the queue.",
+		}, []string{"queue"}),
+		smppSessions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "smpp_sessions",
+			Help:      "Open SMPP client sessions.",
+		}),
+		sigtranUp: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sigtran_up",
+			Help:      "Whether the Sigtran association is connected.",
+		}),
+		sigtranSent: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sigtran_messages_sent",
+			Help:      "Messages sent through the Sigtran stack since start.",
+		}),
+		sigtranRecv: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sigtran_messages_received",
+			Help:      "Messages received through the Sigtran stack since start.",
+		}),
+		sigtranErrs: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sigtran_errors",
+			Help:      "Sigtran stack errors since start.",
+		}),
+		operatorTPS: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "operator_tps",
+			Help:      "Sliding-window submit rate per operator.",
+		}, []string{"operator"}),
+		operatorInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "operator_in_flight",
+			Help:      "Submits awaiting an operator response.",
+		}, []string{"operator"}),
+		operatorUtilization: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "operator_utilization",
+			Help:      "Operator submit rate as a fraction of its max TPS.",
+		}, []string{"operator"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.submitted,
+		m.delivered,
+		m.failed,
+		m.dlrLatency,
+		m.queueDepth,
+		m.smppSessions,
+		m.sigtranUp,
+		m.sigtranSent,
+		m.sigtranRecv,
+		m.sigtranErrs,
+		m.operatorTPS,
+		m.operatorInFlight,
+		m.operatorUtilization,
+	)
+
+	return m
+}
+
+// SetSources sets the components sampled by the metrics collection
+func (s *Service) SetSources(sources Sources) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sources = sources
+}
+
+// MessageSubmitted counts a message submitted to an operator
+func (s *Service) MessageSubmitted(clientID, operatorID string) {
+	s.metrics.submitted.WithLabelValues(clientID, operatorID).Inc()
+}
+
+// MessageDelivered counts a delivered message and records its submit-to-DLR latency
+func (s *Service) MessageDelivered(clientID, operatorID string, latency time.Duration) {
+	s.metrics.delivered.WithLabelValues(clientID, operatorID).Inc()
+	s.metrics.dlrLatency.WithLabelValues(operatorID).Observe(latency.Seconds())
+}
+
+// MessageFailed counts a message that failed permanently
+func (s *Service) MessageFailed(clientID, operatorID string) {
+	s.metrics.failed.WithLabelValues(clientID, operatorID).Inc()
+}
+
+// sample reads the current state of the sources into the gauges
+func (s *Service) sample(ctx context.Context, sources Sources) {
+	m := s.metrics
+
+	if sources.Queue != nil {
+		for _, name := range []string{queue.QueueReady, queue.QueueDelayed} {
+			size, err := sources.Queue.GetQueueSize(ctx, name)
+			if err != nil {
+				s.log.WithError(err).WithField("queue", name).Warn("Failed to read queue size")
+				continue
+			}
+			m.queueDepth.WithLabelValues(name).Set(float64(size))
+		}
+	}
+
+	if sources.Routing != nil {
+		for _, op := range sources.Routing.Operators() {
+			m.operatorTPS.WithLabelValues(op.Name).Set(op.Load.TPS)
+			m.operatorInFlight.WithLabelValues(op.Name).Set(float64(op.Load.InFlight))
+			m.operatorUtilization.WithLabelValues(op.Name).Set(op.Load.Utilization)
+		}
+	}
+
+	if sources.SMPP != nil {
+		m.smppSessions.Set(float64(sources.SMPP.Sessions()))
+	}
+
+	if sources.Sigtran != nil {
+		stats := sources.Sigtran.Metrics()
+		up := 0.0
+		if stats.ConnectionStatus == "connected" {
+			up = 1
+		}
+		m.sigtranUp.Set(up)
+		m.sigtranSent.Set(float64(stats.MessagesSent))
+		m.sigtranRecv.Set(float64(stats.MessagesReceived))
+		m.sigtranErrs.Set(float64(stats.Errors))
+	}
+}
@@ -2,29 +2,45 @@ package monitoring
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"smsc/internal/config"
 )
 
+const (
+	defaultPort   = 9090 // Default Prometheus port
+	livenessPath  = "/health/live"
+	readinessPath = "/health/ready"
+)
+
 type Service struct {
-	cfg    config.MonitoringConfig
-	log    *logrus.Logger
-	server *http.Server
-	mu     sync.Mutex
-	active bool
+	cfg     config.MonitoringConfig
+	log     *logrus.Logger
+	server  *http.Server
+	mu      sync.Mutex
+	active  bool
+	metrics *metrics
+	sources Sources
 }
 
 func New(cfg config.MonitoringConfig, log *logrus.Logger) *Service {
-	return &Service{
+	s := &Service{
 		cfg:    cfg,
 		log:    log,
 		active: false,
 	}
+
+	// Metrics are always initialized so that recording is safe when disabled
+	s.initializeMetrics()
+	return s
 }
 
 func (s *Service) Start(ctx context.Context) error {
@@ -40,21 +56,40 @@ func (s *Service) Start(ctx context.Context) error {
 		return nil
 	}
 
-	// Initialize metrics
-	s.initializeMetrics()
+	port := s.cfg.Port
+	if port <= 0 {
+		port = defaultPort
+	}
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(port))
 
-	// Create HTTP server for metrics endpoint
+	// Create HTTP server for metrics and probe endpoints
 	mux := http.NewServeMux()
-	mux.HandleFunc(s.cfg.MetricsPath, s.metricsHandler)
+	mux.Handle(s.cfg.MetricsPath, s.authenticate(http.HandlerFunc(s.metricsHandler)))
+	mux.HandleFunc(livenessPath, s.liveHandler)
+	mux.HandleFunc(readinessPath, s.readyHandler)
 
 	s.server = &http.Server{
-		Addr:    ":9090", // Default Prometheus port
-		Handler: mux,
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start metrics listener: %w", err)
+	}
+
+	tlsEnabled := s.cfg.TLSCert != "" && s.cfg.TLSKey != ""
+
 	// Start metrics server
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsEnabled {
+			err = s.server.ServeTLS(ln, s.cfg.TLSCert, s.cfg.TLSKey)
+		} else {
+			err = s.server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.log.Errorf("Metrics server error: %v", err)
 		}
 	}()
@@ -63,7 +98,7 @@ func (s *Service) Start(ctx context.Context) error {
 	go s.collectMetrics(ctx)
 
 	s.active = true
-	s.log.Info("Monitoring service started")
+	s.log.Infof("Monitoring service started on %s (TLS: %t)", addr, tlsEnabled)
 	return nil
 }
 
@@ -87,16 +122,43 @@ func (s *Service) Stop(ctx context.Context) error {
 }
 
 func (s *Service) initializeMetrics() {
-	// TODO: Initialize Prometheus metrics
-	// - Message counters (total, success, failed)
-	// - Message latency histograms
-	// - Queue size gauges
-	// - Connection counters
-	// - System metrics (CPU, memory, etc.)
+	s.metrics = newMetrics()
+}
+
+// authenticate protects a handler with the configured bearer token or basic
+// auth credentials. Without credentials configured the handler is left open.
+func (s *Service) authenticate(next http.Handler) http.Handler {
+	token := s.cfg.BearerToken
+	user, pass := s.cfg.Username, s.cfg.Password
+	if token == "" && user == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && secureEqual(r.Header.Get("Authorization"), "Bearer "+token) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if user != "" {
+			if u, p, ok := r.BasicAuth(); ok && secureEqual(u, user) && secureEqual(p, pass) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
 }
 
 func (s *Service) metricsHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement Prometheus metrics handler
+	s.updateMetrics()
+	promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{
+		ErrorLog: s.log,
+	}).ServeHTTP(w, r)
 }
 
 func (s *Service) collectMetrics(ctx context.Context) {
@@ -125,9 +187,12 @@ func (s *Service) collectMetrics(ctx context.Context) {
 }
 
 func (s *Service) updateMetrics() {
-	// TODO: Update metrics
-	// - Collect system metrics
-	// - Update message counters
-	// - Update queue sizes
-	// - Update connection stats
+	s.mu.Lock()
+	sources := s.sources
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.sample(ctx, sources)
 } 
\ No newline at end of file
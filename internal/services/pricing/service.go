@@ -0,0 +1,340 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/services/routing"
+	"smsc/pkg/utils"
+)
+
+const maxPriceListIDLen = 64
+
+var (
+	// ErrUnknownPriceList is returned for price list IDs that do not exist
+	ErrUnknownPriceList = errors.New("unknown price list")
+	// ErrInvalidPriceList is returned for invalid price list settings
+	ErrInvalidPriceList = errors.New("invalid price list")
+	// ErrInvalidReport is returned for margin reports that cannot be built
+	ErrInvalidReport = errors.New("invalid margin report")
+)
+
+// Service keeps the customer price lists and rates messages against them.
+// Entries are matched on the serving network of the recipient first, then on
+// the longest recipient prefix; of several entries for a destination the one
+// that took effect last applies.
+type Service struct {
+	db      *db.Database
+	routing *routing.Service
+	log     *logrus.Logger
+	mu      sync.RWMutex
+	active  bool
+	lists   map[string]*models.PriceList
+}
+
+func New(database *db.Database, routingService *routing.Service, log *logrus.Logger) *Service {
+	return &Service{
+		db:      database,
+		routing: routingService,
+		log:     log,
+		lists:   make(map[string]*models.PriceList),
+	}
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("pricing service is already running")
+	}
+
+	lists, err := s.db.ListPriceLists(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range lists {
+		s.lists[l.ID] = l
+	}
+
+	s.active = true
+	s.log.WithField("price_lists", len(lists)).Info("Pricing service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	s.active = false
+	s.log.Info("Pricing service stopped")
+	return nil
+}
+
+// PriceLists returns every price list ordered by ID
+func (s *Service) PriceLists() []models.PriceList {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lists := make([]models.PriceList, 0, len(s.lists))
+	for _, l := range s.lists {
+		lists = append(lists, *l)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+	return lists
+}
+
+// PriceList returns a price list by ID
+func (s *Service) PriceList(id string) (models.PriceList, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	l, ok := s.lists[id]
+	if !ok {
+		return models.PriceList{}, fmt.Errorf("%w: %s", ErrUnknownPriceList, id)
+	}
+	return *l, nil
+}
+
+// Exists reports whether a price list exists
+func (s *Service) Exists(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.lists[id]
+	return ok
+}
+
+// Create stores a new price list
+func (s *Service) Create(ctx context.Context, l models.PriceList) (models.PriceList, error) {
+	if err := validate(&l); err != nil {
+		return models.PriceList{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[l.ID]; ok {
+		return models.PriceList{}, fmt.Errorf("%w: price list %s already exists", ErrInvalidPriceList, l.ID)
+	}
+	if err := s.db.CreatePriceList(ctx, &l); err != nil {
+		return models.PriceList{}, err
+	}
+
+	s.lists[l.ID] = &l
+	s.log.WithField("price_list", l.ID).Info("Price list created")
+	return l, nil
+}
+
+// Update replaces the name, entries and tiers of a price list. Messages
+// already rated keep their price.
+func (s *Service) Update(ctx context.Context, l models.PriceList) (models.PriceList, error) {
+	if err := validate(&l); err != nil {
+		return models.PriceList{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.lists[l.ID]; !ok {
+		return models.PriceList{}, fmt.Errorf("%w: %s", ErrUnknownPriceList, l.ID)
+	}
+	if err := s.db.UpdatePriceList(ctx, &l); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return models.PriceList{}, fmt.Errorf("%w: %s", ErrUnknownPriceList, l.ID)
+		}
+		return models.PriceList{}, err
+	}
+
+	s.lists[l.ID] = &l
+	s.log.WithField("price_list", l.ID).Info("Price list updated")
+	return l, nil
+}
+
+// Rate computes the sell price of a message from a price list. volume is the
+// number of messages the tenant sent this month, this one included, which
+// selects the volume tier. It reports false when the list does not exist or
+// has no entry for the destination.
+func (s *Service) Rate(ctx context.Context, listID string, msg *models.Message, volume int64) (models.Rating, bool) {
+	s.mu.RLock()
+	l, ok := s.lists[listID]
+	s.mu.RUnlock()
+
+	if !ok {
+		return models.Rating{}, false
+	}
+
+	var network string
+	if hasNetworks(l.Entries) {
+		var err error
+		if network, err = s.routing.ResolveNetwork(ctx, msg.Recipient); err != nil {
+			s.log.WithError(err).WithField("recipient", msg.Recipient).Warn("Number portability lookup failed, rating on prefix")
+		}
+	}
+
+	entry, ok := match(l.Entries, network, msg.Recipient, time.Now())
+	if !ok {
+		return models.Rating{}, false
+	}
+
+	_, segments := utils.Segments(msg.Content)
+	discount := discountFor(l.Tiers, volume)
+	unit := entry.Price * (1 - discount/100)
+	return models.Rating{
+		Destination: destination(entry),
+		UnitPrice:   unit,
+		Discount:    discount,
+		Segments:    segments,
+		Price:       unit * float64(segments),
+	}, true
+}
+
+// MarginReport returns the revenue, cost and margin of messages per
+// customer, destination or operator
+func (s *Service) MarginReport(ctx context.Context, filter db.MarginFilter) ([]models.MarginRow, error) {
+	switch filter.GroupBy {
+	case "customer", "destination", "operator":
+	default:
+		return nil, fmt.Errorf("%w: cannot group by %q", ErrInvalidReport, filter.GroupBy)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidReport)
+	}
+	return s.db.MarginReport(ctx, filter)
+}
+
+// validate checks a price list and normalizes its prefixes
+func validate(l *models.PriceList) error {
+	switch {
+	case l.ID == "":
+		return fmt.Errorf("%w: ID is required", ErrInvalidPriceList)
+	case len(l.ID) > maxPriceListIDLen:
+		return fmt.Errorf("%w: ID is longer than %d characters", ErrInvalidPriceList, maxPriceListIDLen)
+	case strings.TrimSpace(l.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalidPriceList)
+	}
+
+	for i := range l.Entries {
+		e := &l.Entries[i]
+		e.Prefix = normalizePrefix(e.Prefix)
+		switch {
+		case e.Network != "" && e.Prefix != "":
+			return fmt.Errorf("%w: entry %d has both a network and a prefix", ErrInvalidPriceList, i+1)
+		case e.Prefix != "" && !isDigits(e.Prefix):
+			return fmt.Errorf("%w: invalid prefix %q", ErrInvalidPriceList, e.Prefix)
+		case e.Price < 0:
+			return fmt.Errorf("%w: entry %d has a negative price", ErrInvalidPriceList, i+1)
+		case e.EffectiveTo != nil && !e.EffectiveTo.After(e.EffectiveFrom):
+			return fmt.Errorf("%w: entry %d ends before it takes effect", ErrInvalidPriceList, i+1)
+		}
+	}
+
+	for i, t := range l.Tiers {
+		if t.MinMessages < 0 || t.Discount < 0 || t.Discount > 100 {
+			return fmt.Errorf("%w: tier %d needs a message count of at least 0 and a discount between 0 and 100",
+				ErrInvalidPriceList, i+1)
+		}
+	}
+	return nil
+}
+
+// match returns the entry pricing a destination at a time: an entry for the
+// serving network, or else the one with the longest matching prefix. Of
+// several entries for the same destination the latest effective one wins.
+func match(entries []models.PriceEntry, network, recipient string, now time.Time) (models.PriceEntry, bool) {
+	recipient = normalizePrefix(recipient)
+
+	var (
+		best  models.PriceEntry
+		score = -1
+	)
+	for _, e := range entries {
+		if now.Before(e.EffectiveFrom) || (e.EffectiveTo != nil && !now.Before(*e.EffectiveTo)) {
+			continue
+		}
+
+		var sc int
+		switch {
+		case e.Network != "":
+			if network == "" || !strings.EqualFold(e.Network, network) {
+				continue
+			}
+			// Network entries beat any prefix
+			sc = len(recipient) + 1
+		case strings.HasPrefix(recipient, e.Prefix):
+			sc = len(e.Prefix)
+		default:
+			continue
+		}
+
+		if sc > score || (sc == score && e.EffectiveFrom.After(best.EffectiveFrom)) {
+			best, score = e, sc
+		}
+	}
+	return best, score >= 0
+}
+
+// discountFor returns the discount of the highest tier a volume reaches
+func discountFor(tiers []models.VolumeTier, volume int64) float64 {
+	var (
+		discount float64
+		reached  int64 = -1
+	)
+	for _, t := range tiers {
+		if volume >= t.MinMessages && t.MinMessages > reached {
+			discount, reached = t.Discount, t.MinMessages
+		}
+	}
+	return discount
+}
+
+// destination names the destination an entry prices in ratings and reports
+func destination(e models.PriceEntry) string {
+	switch {
+	case e.Network != "":
+		return e.Network
+	case e.Prefix != "":
+		return e.Prefix
+	default:
+		return "*"
+	}
+}
+
+func hasNetworks(entries []models.PriceEntry) bool {
+	for _, e := range entries {
+		if e.Network != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePrefix strips the international prefix of a number or prefix and
+// the "*" wildcard, which matches every destination
+func normalizePrefix(prefix string) string {
+	prefix = strings.TrimSpace(prefix)
+	prefix = strings.TrimSuffix(prefix, "*")
+	prefix = strings.TrimPrefix(prefix, "+")
+	return strings.TrimPrefix(prefix, "00")
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
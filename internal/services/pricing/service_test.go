@@ -0,0 +1,164 @@
+package pricing
+
+import (
+	"context"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/models"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func until(s string) *time.Time {
+	t := date(s)
+	return &t
+}
+
+func TestMatch(t *testing.T) {
+	now := date("2026-06-15")
+	entries := []models.PriceEntry{
+		{Prefix: "", Price: 0.05},
+		{Prefix: "44", Price: 0.04},
+		{Prefix: "447", Price: 0.03},
+		{Network: "vodafone-uk", Price: 0.02},
+		{Prefix: "90", Price: 0.01, EffectiveTo: until("2026-06-01")},
+		{Prefix: "90", Price: 0.011, EffectiveFrom: date("2026-06-01")},
+		{Prefix: "90", Price: 0.012, EffectiveFrom: date("2026-07-01")},
+		{Prefix: "31", Price: 0.06, EffectiveFrom: date("2026-01-01")},
+		{Prefix: "31", Price: 0.07, EffectiveFrom: date("2026-03-01")},
+		{Prefix: "49", Price: 0.08, EffectiveTo: until("2026-06-15")},
+	}
+
+	tests := []struct {
+		name      string
+		network   string
+		recipient string
+		want      float64
+	}{
+		{"longest prefix", "", "447700900123", 0.03},
+		{"shorter prefix", "", "441632960000", 0.04},
+		{"international prefix", "", "+447700900123", 0.03},
+		{"network beats the longest prefix", "vodafone-uk", "447700900123", 0.02},
+		{"network names are case insensitive", "Vodafone-UK", "447700900123", 0.02},
+		{"other network falls back to prefix", "ee", "447700900123", 0.03},
+		{"catch-all", "", "12025550123", 0.05},
+		{"entry taking effect today", "", "905321234567", 0.011},
+		{"latest effective of overlapping entries", "", "31612345678", 0.07},
+		{"entry ending today no longer applies", "", "4915112345678", 0.05},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok := match(entries, tt.network, tt.recipient, now)
+			if !ok {
+				t.Fatal("no entry matched")
+			}
+			if e.Price != tt.want {
+				t.Errorf("matched the entry priced %v, want %v", e.Price, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchWithoutEffectiveEntry(t *testing.T) {
+	entries := []models.PriceEntry{
+		{Prefix: "44", Price: 0.04, EffectiveFrom: date("2026-07-01")},
+		{Prefix: "44", Price: 0.03, EffectiveTo: until("2026-06-01")},
+		{Network: "vodafone-uk", Price: 0.02},
+	}
+	if e, ok := match(entries, "", "447700900123", date("2026-06-15")); ok {
+		t.Errorf("matched the entry priced %v, want no match", e.Price)
+	}
+}
+
+func TestDiscountFor(t *testing.T) {
+	tiers := []models.VolumeTier{
+		{MinMessages: 100000, Discount: 20},
+		{MinMessages: 0, Discount: 0},
+		{MinMessages: 10000, Discount: 10},
+	}
+
+	tests := []struct {
+		name   string
+		tiers  []models.VolumeTier
+		volume int64
+		want   float64
+	}{
+		{"no tiers", nil, 500000, 0},
+		{"below the first discount", tiers, 9999, 0},
+		{"at a tier", tiers, 10000, 10},
+		{"between tiers", tiers, 99999, 10},
+		{"highest tier", tiers, 100000, 20},
+		{"above the highest tier", tiers, 5000000, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := discountFor(tt.tiers, tt.volume); got != tt.want {
+				t.Errorf("discount %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatePricesEverySegment(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	s := New(nil, nil, log)
+	s.lists["standard"] = &models.PriceList{
+		ID:      "standard",
+		Entries: []models.PriceEntry{{Prefix: "44", Price: 0.04}},
+		Tiers:   []models.VolumeTier{{MinMessages: 1000, Discount: 25}},
+	}
+
+	tests := []struct {
+		name     string
+		content  string
+		volume   int64
+		segments int
+		unit     float64
+	}{
+		{"single GSM segment", "hello", 1, 1, 0.04},
+		{"three GSM segments", strings.Repeat("a", 307), 1, 3, 0.04},
+		{"two UCS-2 segments", strings.Repeat("ş", 71), 1, 2, 0.04},
+		{"discounted", strings.Repeat("a", 161), 1000, 2, 0.03},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &models.Message{Recipient: "447700900123", Content: tt.content}
+			r, ok := s.Rate(context.Background(), "standard", msg, tt.volume)
+			if !ok {
+				t.Fatal("message was not rated")
+			}
+			if r.Segments != tt.segments {
+				t.Errorf("%d segments, want %d", r.Segments, tt.segments)
+			}
+			if math.Abs(r.UnitPrice-tt.unit) > 1e-9 {
+				t.Errorf("unit price %v, want %v", r.UnitPrice, tt.unit)
+			}
+			if want := tt.unit * float64(tt.segments); math.Abs(r.Price-want) > 1e-9 {
+				t.Errorf("price %v, want %v", r.Price, want)
+			}
+			if r.Destination != "44" {
+				t.Errorf("destination %q, want 44", r.Destination)
+			}
+		})
+	}
+
+	if _, ok := s.Rate(context.Background(), "standard", &models.Message{Recipient: "12025550123", Content: "hi"}, 1); ok {
+		t.Error("rated a destination the list has no entry for")
+	}
+	if _, ok := s.Rate(context.Background(), "missing", &models.Message{Recipient: "447700900123", Content: "hi"}, 1); ok {
+		t.Error("rated against a price list that does not exist")
+	}
+}
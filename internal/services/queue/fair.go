@@ -0,0 +1,116 @@
+package queue
+
+import (
+	"time"
+)
+
+// lanes holds the ready messages of one priority level in a FIFO lane per
+// client. Lanes are served round robin, so a client with a deep backlog
+// cannot starve the others.
+type lanes struct {
+	byClient map[string]*lane
+	order    []*lane // non-empty lanes in rotation order
+	next     int
+	size     int
+}
+
+type lane struct {
+	client string
+	msgs   []*Message
+}
+
+// allowFunc reports whether a message of a client may be taken now and, if
+// not, how long until it may
+type allowFunc func(client string, now time.Time) (bool, time.Duration)
+
+func (l *lanes) push(msg *Message) {
+	if l.byClient == nil {
+		l.byClient = make(map[string]*lane)
+	}
+
+	ln, ok := l.byClient[msg.ClientID]
+	if !ok {
+		ln = &lane{client: msg.ClientID}
+		l.byClient[msg.ClientID] = ln
+		l.order = append(l.order, ln)
+	}
+	ln.msgs = append(ln.msgs, msg)
+	l.size++
+}
+
+// pop takes the oldest message of the next client in rotation that allow
+// admits. When every client with messages is throttled it returns nil and
+// the shortest wait until one of them is admitted again.
+func (l *lanes) pop(now time.Time, allow allowFunc) (*Message, time.Duration) {
+	var wait time.Duration
+	for i := 0; i < len(l.order); i++ {
+		idx := (l.next + i) % len(l.order)
+		ln := l.order[idx]
+
+		ok, w := allow(ln.client, now)
+		if !ok {
+			if wait == 0 || w < wait {
+				wait = w
+			}
+			continue
+		}
+
+		msg := ln.msgs[0]
+		ln.msgs[0] = nil
+		ln.msgs = ln.msgs[1:]
+		l.size--
+
+		if len(ln.msgs) == 0 {
+			delete(l.byClient, ln.client)
+			l.order = append(l.order[:idx], l.order[idx+1:]...)
+			l.next = idx
+		} else {
+			l.next = idx + 1
+		}
+		if len(l.order) > 0 {
+			l.next %= len(l.order)
+		} else {
+			l.next = 0
+		}
+		return msg, 0
+	}
+	return nil, wait
+}
+
+func (l *lanes) len() int {
+	return l.size
+}
+
+func (l *lanes) reset() {
+	*l = lanes{}
+}
+
+// bucket is a token bucket pacing the messages of a client to its TPS limit,
+// with a burst of one second's worth of messages
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(tps int) *bucket {
+	return &bucket{rate: float64(tps), tokens: float64(tps)}
+}
+
+// take consumes a token if one is available and otherwise returns the time
+// until the next one is
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
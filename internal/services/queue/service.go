@@ -1,19 +1,59 @@
 package queue
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 	"smsc/internal/config"
+	"smsc/internal/tracing"
 )
 
+// Queue names accepted by GetQueueSize and PurgeQueue
+const (
+	QueueReady   = "ready"
+	QueueDelayed = "delayed"
+)
+
+// MaxPriority is the highest message priority, matching the SMPP priority_flag range
+const MaxPriority = 3
+
+const (
+	defaultMaxRetries    = 3
+	defaultRetryInterval = 5 * time.Second
+	releaseInterval      = time.Second
+	capacityInterval     = 100 * time.Millisecond
+)
+
+// Processor handles a message taken off the queue
+type Processor func(ctx context.Context, msg *Message) error
+
+// DropHandler is called for messages dropped after exhausting their retries
+type DropHandler func(ctx context.Context, msg *Message, err error)
+
+// holder is implemented by errors asking for a message to be held until a later time
+type holder interface {
+	HoldUntil() time.Time
+}
+
 type Service struct {
-	cfg    config.QueueConfig
-	log    *logrus.Logger
-	mu     sync.Mutex
-	active bool
+	cfg       config.QueueConfig
+	log       *logrus.Logger
+	mu        sync.Mutex
+	active    bool
+	ready     [MaxPriority + 1]lanes
+	delayed   delayHeap
+	rates     map[string]*bucket
+	notify    chan struct{}
+	processor Processor
+	onDrop    DropHandler
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
 }
 
 func New(cfg config.QueueConfig, log *logrus.Logger) *Service {
@@ -21,7 +61,42 @@ func New(cfg config.QueueConfig, log *logrus.Logger) *Service {
 		cfg:    cfg,
 		log:    log,
 		active: false,
+		rates:  make(map[string]*bucket),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// SetClientRate limits the rate at which messages of a client are taken off
+// the queue. A rate of zero removes the limit.
+func (s *Service) SetClientRate(clientID string, tps int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tps <= 0 {
+		delete(s.rates, clientID)
+	} else if b, ok := s.rates[clientID]; ok {
+		b.rate = float64(tps)
+	} else {
+		s.rates[clientID] = newBucket(tps)
 	}
+	s.signal()
+}
+
+// SetProcessor sets the function the queue workers hand messages to.
+// It must be called before Start.
+func (s *Service) SetProcessor(p Processor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.processor = p
+}
+
+// SetDropHandler sets the function notified about dropped messages
+func (s *Service) SetDropHandler(h DropHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDrop = h
 }
 
 func (s *Service) Start(ctx context.Context) error {
@@ -32,11 +107,28 @@ func (s *Service) Start(ctx context.Context) error {
 		return fmt.Errorf("queue service is already running")
 	}
 
-	// TODO: Initialize queue driver (Redis)
-	// TODO: Set up connection pool
-	// TODO: Initialize message queues
-	// TODO: Start message processors
-	// TODO: Set up error handling and retry logic
+	switch s.cfg.Driver {
+	case "", "memory":
+	default:
+		return fmt.Errorf("unsupported queue driver: %s", s.cfg.Driver)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	s.wg.Add(1)
+	go s.releaseDelayed(ctx)
+
+	if s.processor != nil {
+		workers := s.cfg.PoolSize
+		if workers <= 0 {
+			workers = 1
+		}
+		for i := 0; i < workers; i++ {
+			s.wg.Add(1)
+			go s.work(ctx)
+		}
+	}
 
 	s.active = true
 	s.log.Info("Queue service started")
@@ -45,71 +137,362 @@ func (s *Service) Start(ctx context.Context) error {
 
 func (s *Service) Stop(ctx context.Context) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	if !s.active {
+		s.mu.Unlock()
 		return nil
 	}
+	s.active = false
+	s.cancel()
+	s.mu.Unlock()
 
-	// TODO: Stop message processors
-	// TODO: Flush queues
-	// TODO: Close connections
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop queue workers: %w", ctx.Err())
+	}
 
-	s.active = false
 	s.log.Info("Queue service stopped")
 	return nil
 }
 
+// Active reports whether the queue service is running
+func (s *Service) Active() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.active
+}
+
+// Check reports an error when the queue service is not running
+func (s *Service) Check(ctx context.Context) error {
+	if !s.Active() {
+		return fmt.Errorf("queue service is not running")
+	}
+	return nil
+}
+
 // Message represents a queued message
 type Message struct {
-	ID        string
-	Sender    string
-	Recipient string
-	Content   string
-	Priority  int
-	Attempts  int
-}
-
-// QueueMessage adds a message to the queue
-func (s *Service) QueueMessage(ctx context.Context, msg *Message) error {
-	// TODO: Implement message queueing
-	// 1. Validate message
-	// 2. Set message metadata
-	// 3. Choose appropriate queue based on priority
-	// 4. Add to queue
-	// 5. Update metrics
+	ID          string // internal message ID
+	Sender      string
+	Recipient   string
+	Content     string
+	Priority    int
+	Attempts    int
+	ClientID    string
+	ServiceType string
+	DataCoding  int
+	OperatorID  string
+	ScheduledAt time.Time
+	ExpiresAt   time.Time // zero when the message never expires
+	// TraceContext carries the span context of the enqueuing request so
+	// processing spans join the message's trace
+	TraceContext map[string]string
+}
+
+// QueueMessage adds a message to the queue. Messages scheduled in the future
+// are held on the delayed queue until they are due.
+func (s *Service) QueueMessage(ctx context.Context, msg *Message) (err error) {
+	if msg == nil || msg.ID == "" {
+		return fmt.Errorf("message ID is required")
+	}
+	if msg.Recipient == "" {
+		return fmt.Errorf("message recipient is required")
+	}
+
+	ctx, span := tracing.StartMessage(ctx, "queue.enqueue", msg.ID,
+		attribute.Int("smsc.priority", msg.Priority),
+		attribute.Bool("smsc.delayed", msg.ScheduledAt.After(time.Now())),
+	)
+	defer func() { tracing.End(span, err) }()
+	msg.TraceContext = tracing.Inject(ctx)
+
+	if msg.Priority < 0 {
+		msg.Priority = 0
+	}
+	if msg.Priority > MaxPriority {
+		msg.Priority = MaxPriority
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if msg.ScheduledAt.After(time.Now()) {
+		heap.Push(&s.delayed, msg)
+		return nil
+	}
+
+	s.ready[msg.Priority].push(msg)
+	s.signal()
 	return nil
 }
 
-// ProcessMessage processes a queued message
+// HoldMessage puts a message on the delayed queue until the given time
+func (s *Service) HoldMessage(ctx context.Context, msg *Message, until time.Time) error {
+	msg.ScheduledAt = until
+	return s.QueueMessage(ctx, msg)
+}
+
+// Dequeue blocks until a message is ready and returns the highest priority
+// one. Clients of the same priority take turns, and clients at their rate
+// limit are skipped until they are below it again.
+func (s *Service) Dequeue(ctx context.Context) (*Message, error) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		for p := MaxPriority; p >= 0; p-- {
+			msg, w := s.ready[p].pop(now, s.allow)
+			if msg != nil {
+				if s.hasReady() {
+					s.signal()
+				}
+				s.mu.Unlock()
+				return msg, nil
+			}
+			if w > 0 && (wait == 0 || w < wait) {
+				wait = w
+			}
+		}
+		s.mu.Unlock()
+
+		var (
+			timer     *time.Timer
+			throttled <-chan time.Time
+		)
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			throttled = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil, ctx.Err()
+		case <-s.notify:
+		case <-throttled:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// allow takes a token of a client's rate limit. The caller must hold the lock.
+func (s *Service) allow(client string, now time.Time) (bool, time.Duration) {
+	b, ok := s.rates[client]
+	if !ok {
+		return true, 0
+	}
+	ok, wait := b.take(now)
+	if !ok && wait < time.Millisecond {
+		wait = time.Millisecond
+	}
+	return ok, wait
+}
+
+// ProcessMessage processes a queued message. Messages the processor asks to
+// hold go back to the delayed queue; failed messages are retried.
 func (s *Service) ProcessMessage(ctx context.Context, msg *Message) error {
-	// TODO: Implement message processing
-	// 1. Get message from queue
-	// 2. Apply routing rules
-	// 3. Send through appropriate protocol
-	// 4. Handle delivery status
-	// 5. Update metrics
-	return nil
+	s.mu.Lock()
+	processor := s.processor
+	s.mu.Unlock()
+
+	if processor == nil {
+		return fmt.Errorf("no message processor configured")
+	}
+
+	ctx, span := tracing.StartMessage(tracing.Extract(ctx, msg.TraceContext), "queue.dequeue", msg.ID,
+		attribute.Int("smsc.attempts", msg.Attempts),
+	)
+	err := processor(ctx, msg)
+	tracing.End(span, err)
+	if err == nil {
+		return nil
+	}
+
+	var hold holder
+	if errors.As(err, &hold) {
+		s.log.WithFields(logrus.Fields{
+			"message_id": msg.ID,
+			"until":      hold.HoldUntil(),
+		}).Info("Message held")
+		return s.HoldMessage(ctx, msg, hold.HoldUntil())
+	}
+
+	s.log.WithError(err).WithField("message_id", msg.ID).Warn("Message processing failed")
+	return s.RetryMessage(ctx, msg)
 }
 
 // RetryMessage adds a failed message back to the queue for retry
 func (s *Service) RetryMessage(ctx context.Context, msg *Message) error {
-	// TODO: Implement retry logic
-	// 1. Check retry count
-	// 2. Update attempt count
-	// 3. Calculate delay
-	// 4. Add to retry queue
-	return nil
+	maxRetries := s.cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	interval := s.cfg.RetryInterval
+	if interval <= 0 {
+		interval = defaultRetryInterval
+	}
+
+	if msg.Attempts >= maxRetries {
+		return fmt.Errorf("message %s exceeded %d retries", msg.ID, maxRetries)
+	}
+
+	msg.Attempts++
+	return s.HoldMessage(ctx, msg, time.Now().Add(time.Duration(msg.Attempts)*interval))
+}
+
+// WaitCapacity blocks while the ready queues hold more than the configured
+// high-water mark, letting bulk producers apply backpressure. Without a
+// high-water mark it returns immediately.
+func (s *Service) WaitCapacity(ctx context.Context) error {
+	if s.cfg.HighWater <= 0 {
+		return nil
+	}
+
+	ticker := time.NewTicker(capacityInterval)
+	defer ticker.Stop()
+
+	for {
+		size, _ := s.GetQueueSize(ctx, QueueReady)
+		if size < int64(s.cfg.HighWater) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
 
 // PurgeQueue removes all messages from a queue
 func (s *Service) PurgeQueue(ctx context.Context, queueName string) error {
-	// TODO: Implement queue purging
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch queueName {
+	case QueueReady:
+		for p := range s.ready {
+			s.ready[p].reset()
+		}
+	case QueueDelayed:
+		s.delayed = nil
+	default:
+		return fmt.Errorf("unknown queue: %s", queueName)
+	}
 	return nil
 }
 
 // GetQueueSize returns the current size of a queue
 func (s *Service) GetQueueSize(ctx context.Context, queueName string) (int64, error) {
-	// TODO: Implement queue size checking
-	return 0, nil
-} 
\ No newline at end of file
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch queueName {
+	case QueueReady:
+		var n int
+		for p := range s.ready {
+			n += s.ready[p].len()
+		}
+		return int64(n), nil
+	case QueueDelayed:
+		return int64(len(s.delayed)), nil
+	default:
+		return 0, fmt.Errorf("unknown queue: %s", queueName)
+	}
+}
+
+func (s *Service) work(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		msg, err := s.Dequeue(ctx)
+		if err != nil {
+			return
+		}
+
+		if err := s.ProcessMessage(ctx, msg); err != nil {
+			s.log.WithError(err).WithField("message_id", msg.ID).Error("Message dropped")
+
+			s.mu.Lock()
+			onDrop := s.onDrop
+			s.mu.Unlock()
+			if onDrop != nil {
+				onDrop(ctx, msg, err)
+			}
+		}
+	}
+}
+
+// releaseDelayed moves due messages from the delayed queue to the ready queues
+func (s *Service) releaseDelayed(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(releaseInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for len(s.delayed) > 0 && !s.delayed[0].ScheduledAt.After(now) {
+				msg := heap.Pop(&s.delayed).(*Message)
+				s.ready[msg.Priority].push(msg)
+			}
+			if s.hasReady() {
+				s.signal()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *Service) hasReady() bool {
+	for p := range s.ready {
+		if s.ready[p].len() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// signal wakes up a waiting consumer without blocking
+func (s *Service) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// delayHeap orders delayed messages by their scheduled time
+type delayHeap []*Message
+
+func (h delayHeap) Len() int           { return len(h) }
+func (h delayHeap) Less(i, j int) bool { return h[i].ScheduledAt.Before(h[j].ScheduledAt) }
+func (h delayHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *delayHeap) Push(x interface{}) {
+	*h = append(*h, x.(*Message))
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	msg := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return msg
+}
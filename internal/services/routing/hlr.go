@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultHLRTimeout = 2 * time.Second
+
+// HTTPHLR looks up serving networks through an HLR lookup service reached
+// over HTTP, such as a gateway issuing SRI-for-SM queries on our behalf. It
+// sends GET <url>?msisdn=<number> and expects {"network": "..."}; a 404
+// means the network is unknown.
+type HTTPHLR struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPHLR creates an HLR lookup against a URL. A zero timeout defaults to
+// two seconds, since lookups hold up routing.
+func NewHTTPHLR(lookupURL string, timeout time.Duration) *HTTPHLR {
+	if timeout <= 0 {
+		timeout = defaultHLRTimeout
+	}
+	return &HTTPHLR{
+		url:    lookupURL,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// LookupNetwork implements HLRLookup
+func (h *HTTPHLR) LookupNetwork(ctx context.Context, msisdn string) (string, error) {
+	u, err := url.Parse(h.url)
+	if err != nil {
+		return "", fmt.Errorf("invalid HLR URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("msisdn", msisdn)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", nil
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("HLR lookup returned %s", resp.Status)
+	}
+
+	var result struct {
+		Network string `json:"network"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode HLR response: %w", err)
+	}
+	return result.Network, nil
+}
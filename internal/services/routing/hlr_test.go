@@ -0,0 +1,37 @@
+package routing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+)
+
+func TestHLRResolvesNumbersMissingFromMNP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("msisdn") {
+		case "447700900123":
+			w.Write([]byte(`{"network": "vodafone-uk"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	rs := New(config.RoutingConfig{Portability: config.PortabilityConfig{Enabled: true, HLRURL: srv.URL}}, log)
+
+	network, err := rs.ResolveNetwork(context.Background(), "+447700900123")
+	if err != nil || network != "vodafone-uk" {
+		t.Errorf("ResolveNetwork = %q, %v; want vodafone-uk", network, err)
+	}
+	network, err = rs.ResolveNetwork(context.Background(), "+447700900999")
+	if err != nil || network != "" {
+		t.Errorf("ResolveNetwork of an unknown number = %q, %v; want no network", network, err)
+	}
+}
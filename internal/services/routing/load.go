@@ -0,0 +1,100 @@
+package routing
+
+import (
+	"sync"
+	"time"
+)
+
+// loadWindow is the number of one-second buckets used for the sliding TPS window
+const loadWindow = 10
+
+// loadTracker keeps a sliding-window submit rate and in-flight count for an operator
+type loadTracker struct {
+	mu        sync.Mutex
+	counts    [loadWindow]int64
+	seconds   [loadWindow]int64
+	inFlight  int64
+	throttled time.Time // over its cluster-wide TPS until then
+}
+
+// OperatorLoad is a snapshot of an operator's current load
+type OperatorLoad struct {
+	TPS         float64 `json:"tps"`
+	InFlight    int64   `json:"inFlight"`
+	MaxTPS      int     `json:"maxTps"`
+	Utilization float64 `json:"utilization"`
+	Saturated   bool    `json:"saturated"`
+	Throttled   bool    `json:"throttled"`
+}
+
+// begin records a submit towards the operator and marks it in flight
+func (t *loadTracker) begin(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sec := now.Unix()
+	idx := sec % loadWindow
+	if t.seconds[idx] != sec {
+		t.seconds[idx] = sec
+		t.counts[idx] = 0
+	}
+	t.counts[idx]++
+	t.inFlight++
+}
+
+// end marks a previously started submit as completed
+func (t *loadTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.inFlight > 0 {
+		t.inFlight--
+	}
+}
+
+// throttle marks the operator as over its cluster-wide TPS until the given time
+func (t *loadTracker) throttle(until time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.throttled = until
+}
+
+// throttledUntil returns until when the operator is over its cluster-wide TPS
+func (t *loadTracker) throttledUntil() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.throttled
+}
+
+// snapshot computes the load against maxTPS. An operator is saturated when its
+// windowed TPS reaches maxTPS or while it is throttled cluster-wide; a zero
+// maxTPS means unlimited. The in-flight count is reported but, being a number
+// of submits rather than a rate, does not count towards saturation.
+func (t *loadTracker) snapshot(now time.Time, maxTPS int) OperatorLoad {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sec := now.Unix()
+	var total int64
+	for i := 0; i < loadWindow; i++ {
+		if sec-t.seconds[i] < loadWindow {
+			total += t.counts[i]
+		}
+	}
+
+	load := OperatorLoad{
+		TPS:      float64(total) / loadWindow,
+		InFlight: t.inFlight,
+		MaxTPS:   maxTPS,
+	}
+
+	if maxTPS > 0 {
+		load.Utilization = load.TPS / float64(maxTPS)
+		load.Throttled = now.Before(t.throttled)
+		load.Saturated = load.Utilization >= 1 || load.Throttled
+	}
+
+	return load
+}
@@ -0,0 +1,39 @@
+package routing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotSaturatesOnTPS(t *testing.T) {
+	now := time.Now()
+	var tr loadTracker
+	for i := 0; i < 100; i++ {
+		tr.begin(now)
+		tr.end()
+	}
+
+	// 100 submits over the 10 second window is 10 TPS
+	if load := tr.snapshot(now, 10); !load.Saturated {
+		t.Errorf("load %+v at max TPS is not saturated", load)
+	}
+	if load := tr.snapshot(now, 20); load.Saturated {
+		t.Errorf("load %+v at half max TPS is saturated", load)
+	}
+}
+
+func TestSnapshotIgnoresInFlightForSaturation(t *testing.T) {
+	now := time.Now()
+	var tr loadTracker
+	for i := 0; i < 5; i++ {
+		tr.begin(now)
+	}
+
+	load := tr.snapshot(now, 5)
+	if load.InFlight != 5 {
+		t.Errorf("in flight = %d, want 5", load.InFlight)
+	}
+	if load.Saturated {
+		t.Errorf("load %+v is saturated by in-flight submits alone", load)
+	}
+}
@@ -0,0 +1,250 @@
+package routing
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+)
+
+// HLRLookup resolves the serving network of an MSISDN against the network,
+// typically through a MAP SRI-for-SM query
+type HLRLookup interface {
+	LookupNetwork(ctx context.Context, msisdn string) (string, error)
+}
+
+// Portability resolves the serving network of ported numbers. Lookups go
+// through the TTL cache, then the imported MNP database and finally the
+// optional HLR lookup.
+type Portability struct {
+	cfg   config.PortabilityConfig
+	log   *logrus.Logger
+	mu    sync.RWMutex
+	db    map[string]string
+	cache map[string]cacheEntry
+	hlr   HLRLookup
+}
+
+type cacheEntry struct {
+	network string
+	expires time.Time
+}
+
+// ImportStats summarizes an MNP import
+type ImportStats struct {
+	Upserted int `json:"upserted"`
+	Deleted  int `json:"deleted"`
+	Skipped  int `json:"skipped"`
+	Total    int `json:"total"`
+}
+
+// NewPortability creates an empty number portability resolver
+func NewPortability(cfg config.PortabilityConfig, log *logrus.Logger) *Portability {
+	return &Portability{
+		cfg:   cfg,
+		log:   log,
+		db:    make(map[string]string),
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// SetHLRLookup installs the lookup used for numbers missing from the MNP database
+func (p *Portability) SetHLRLookup(hlr HLRLookup) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.hlr = hlr
+}
+
+// ImportFile loads an MNP database dump from disk
+func (p *Portability) ImportFile(path string, full bool) (ImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImportStats{}, fmt.Errorf("failed to open MNP dump: %w", err)
+	}
+	defer f.Close()
+
+	return p.Import(f, full)
+}
+
+// Import reads MNP records in CSV form: msisdn,network[,action].
+// A full import replaces the database; an incremental one applies the records
+// on top of it, where an action of "D" deletes the number.
+func (p *Portability) Import(r io.Reader, full bool) (ImportStats, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var stats ImportStats
+	entries := make(map[string]string)
+	deletes := make(map[string]struct{})
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read MNP record: %w", err)
+		}
+
+		stats.Total++
+		if len(record) < 2 {
+			stats.Skipped++
+			continue
+		}
+
+		msisdn := normalizeMSISDN(record[0])
+		network := strings.TrimSpace(record[1])
+		if msisdn == "" || !isDigits(msisdn) {
+			stats.Skipped++
+			continue
+		}
+
+		if len(record) > 2 && strings.EqualFold(strings.TrimSpace(record[2]), "D") {
+			deletes[msisdn] = struct{}{}
+			delete(entries, msisdn)
+			stats.Deleted++
+			continue
+		}
+
+		if network == "" {
+			stats.Skipped++
+			continue
+		}
+
+		entries[msisdn] = network
+		delete(deletes, msisdn)
+		stats.Upserted++
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if full {
+		p.db = entries
+	} else {
+		for msisdn := range deletes {
+			delete(p.db, msisdn)
+		}
+		for msisdn, network := range entries {
+			p.db[msisdn] = network
+		}
+	}
+	p.cache = make(map[string]cacheEntry)
+
+	p.log.WithFields(logrus.Fields{
+		"full":     full,
+		"upserted": stats.Upserted,
+		"deleted":  stats.Deleted,
+		"skipped":  stats.Skipped,
+	}).Info("MNP database imported")
+	return stats, nil
+}
+
+// Resolve returns the network currently serving the MSISDN, or an empty
+// string when it cannot be determined
+func (p *Portability) Resolve(ctx context.Context, msisdn string) (string, error) {
+	msisdn = normalizeMSISDN(msisdn)
+	now := time.Now()
+
+	p.mu.RLock()
+	entry, cached := p.cache[msisdn]
+	network, ported := p.db[msisdn]
+	hlr := p.hlr
+	p.mu.RUnlock()
+
+	if cached && now.Before(entry.expires) {
+		return entry.network, nil
+	}
+
+	if !ported && hlr != nil {
+		var err error
+		network, err = hlr.LookupNetwork(ctx, msisdn)
+		if err != nil {
+			return "", fmt.Errorf("HLR lookup failed: %w", err)
+		}
+	}
+
+	p.store(msisdn, network, now)
+	return network, nil
+}
+
+// Cached returns the network serving the MSISDN from the MNP database or the
+// lookup cache, without an HLR lookup. It reports false when an HLR lookup
+// would be needed to tell.
+func (p *Portability) Cached(msisdn string) (string, bool) {
+	msisdn = normalizeMSISDN(msisdn)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if entry, ok := p.cache[msisdn]; ok && time.Now().Before(entry.expires) {
+		return entry.network, true
+	}
+	if network, ok := p.db[msisdn]; ok {
+		return network, true
+	}
+	return "", p.hlr == nil
+}
+
+// Size returns the number of entries in the MNP database
+func (p *Portability) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return len(p.db)
+}
+
+func (p *Portability) store(msisdn, network string, now time.Time) {
+	ttl := p.cfg.CacheTTL
+	if ttl <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cfg.CacheSize > 0 && len(p.cache) >= p.cfg.CacheSize {
+		for key, entry := range p.cache {
+			if now.After(entry.expires) {
+				delete(p.cache, key)
+			}
+		}
+		// Still full: drop an arbitrary entry to make room
+		for key := range p.cache {
+			if len(p.cache) < p.cfg.CacheSize {
+				break
+			}
+			delete(p.cache, key)
+		}
+	}
+
+	p.cache[msisdn] = cacheEntry{network: network, expires: now.Add(ttl)}
+}
+
+// normalizeMSISDN strips the international prefix and formatting from a number
+func normalizeMSISDN(msisdn string) string {
+	msisdn = strings.TrimSpace(msisdn)
+	msisdn = strings.TrimPrefix(msisdn, "+")
+	msisdn = strings.TrimPrefix(msisdn, "00")
+	return msisdn
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
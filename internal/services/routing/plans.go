@@ -0,0 +1,234 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultPlan is the route plan used for clients without an assigned plan.
+// Its default route is RoutingConfig.DefaultRoute.
+const DefaultPlan = "default"
+
+// Plan is a named set of routing rules assigned to client accounts. Messages
+// of assigned clients are routed by the plan's rules first, then by its
+// default route or, when it has none, by the default plan.
+type Plan struct {
+	Name         string   `json:"name"`
+	DefaultRoute string   `json:"defaultRoute,omitempty"`
+	Clients      []string `json:"clients,omitempty"`
+	// config is set for the default plan and the plans defined in the
+	// configuration, which the API cannot change
+	config bool
+}
+
+// loadPlans creates the default plan and the configured route plans with
+// their rules and client assignments. The caller must hold the write lock.
+func (s *Service) loadPlans() error {
+	s.plans = map[string]*Plan{
+		DefaultPlan: {Name: DefaultPlan, DefaultRoute: s.cfg.DefaultRoute, config: true},
+	}
+	s.assignments = make(map[string]string)
+
+	for _, cfg := range s.cfg.Plans {
+		if cfg.Name == "" || cfg.Name == DefaultPlan {
+			return fmt.Errorf("invalid route plan name: %q", cfg.Name)
+		}
+		if _, ok := s.plans[cfg.Name]; ok {
+			return fmt.Errorf("duplicate route plan: %s", cfg.Name)
+		}
+		s.plans[cfg.Name] = &Plan{Name: cfg.Name, DefaultRoute: cfg.DefaultRoute, config: true}
+
+		for _, client := range cfg.Clients {
+			if other, ok := s.assignments[client]; ok {
+				return fmt.Errorf("client %s is assigned to route plans %s and %s", client, other, cfg.Name)
+			}
+			s.assignments[client] = cfg.Name
+		}
+
+		for _, ruleCfg := range cfg.Rules {
+			rule := ruleFromConfig(ruleCfg)
+			rule.Plan = cfg.Name
+			if err := s.addRule(rule); err != nil {
+				return fmt.Errorf("invalid routing rule %q in plan %s: %w", ruleCfg.Pattern, cfg.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadStoredPlans adds the route plans and client assignments stored through
+// the API. Assignments override the configured ones. It must run before
+// loadRules, which needs the plans of the stored rules. The caller must hold
+// the write lock.
+func (s *Service) loadStoredPlans(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+
+	plans, err := s.db.ListRoutePlans(ctx)
+	if err != nil {
+		return err
+	}
+	for _, row := range plans {
+		if _, ok := s.plans[row.Name]; ok {
+			s.log.WithField("plan", row.Name).Warn("Skipping stored route plan that is defined in the configuration")
+			continue
+		}
+		s.plans[row.Name] = &Plan{Name: row.Name, DefaultRoute: row.DefaultRoute}
+	}
+
+	assignments, err := s.db.ListRoutePlanAssignments(ctx)
+	if err != nil {
+		return err
+	}
+	for client, plan := range assignments {
+		if _, ok := s.plans[plan]; !ok {
+			s.log.WithFields(logrus.Fields{
+				"client_id": client,
+				"plan":      plan,
+			}).Warn("Skipping assignment to unknown route plan")
+			continue
+		}
+		s.assignments[client] = plan
+	}
+	return nil
+}
+
+// Plans returns the route plans with their assigned clients
+func (s *Service) Plans() []Plan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := make(map[string][]string)
+	for client, plan := range s.assignments {
+		clients[plan] = append(clients[plan], client)
+	}
+
+	plans := make([]Plan, 0, len(s.plans))
+	for name, plan := range s.plans {
+		p := *plan
+		p.Clients = clients[name]
+		sort.Strings(p.Clients)
+		plans = append(plans, p)
+	}
+
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Name < plans[j].Name })
+	return plans
+}
+
+// SavePlan creates a route plan or updates its default route
+func (s *Service) SavePlan(ctx context.Context, plan Plan) error {
+	if plan.Name == "" {
+		return fmt.Errorf("route plan name is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.plans[plan.Name]
+	if ok && existing.config {
+		return fmt.Errorf("route plan %s is defined in the configuration", plan.Name)
+	}
+
+	if s.db != nil {
+		if err := s.db.SaveRoutePlan(ctx, plan.Name, plan.DefaultRoute); err != nil {
+			return err
+		}
+	}
+
+	if ok {
+		existing.DefaultRoute = plan.DefaultRoute
+		return nil
+	}
+
+	s.plans[plan.Name] = &Plan{Name: plan.Name, DefaultRoute: plan.DefaultRoute}
+	return nil
+}
+
+// RemovePlan deletes a route plan together with its rules and client
+// assignments, both in memory and in the database
+func (s *Service) RemovePlan(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if name == DefaultPlan {
+		return fmt.Errorf("the default route plan cannot be removed")
+	}
+	plan, ok := s.plans[name]
+	if !ok {
+		return fmt.Errorf("route plan not found: %s", name)
+	}
+	if plan.config {
+		return fmt.Errorf("route plan %s is defined in the configuration", name)
+	}
+
+	if s.db != nil {
+		if err := s.db.DeleteRoutePlan(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	rules := s.rules[:0]
+	for _, rule := range s.rules {
+		if rule.Plan != name {
+			rules = append(rules, rule)
+		}
+	}
+	s.rules = rules
+
+	for client, plan := range s.assignments {
+		if plan == name {
+			delete(s.assignments, client)
+		}
+	}
+
+	delete(s.plans, name)
+	return nil
+}
+
+// AssignPlan assigns a route plan to a client account. The assignment is
+// stored and overrides the one in the configuration, including assignments to
+// the default plan.
+func (s *Service) AssignPlan(ctx context.Context, clientID, name string) error {
+	if clientID == "" {
+		return fmt.Errorf("client ID is required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.plans[name]; !ok {
+		return fmt.Errorf("route plan not found: %s", name)
+	}
+
+	if s.db != nil {
+		if err := s.db.AssignRoutePlan(ctx, clientID, name); err != nil {
+			return err
+		}
+	}
+
+	s.assignments[clientID] = name
+	return nil
+}
+
+// PlanFor returns the name of the route plan used for a client
+func (s *Service) PlanFor(clientID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.planFor(clientID).Name
+}
+
+// planFor returns the route plan of a client. The caller must hold the lock.
+func (s *Service) planFor(clientID string) *Plan {
+	if name, ok := s.assignments[clientID]; ok {
+		if plan, ok := s.plans[name]; ok {
+			return plan
+		}
+	}
+	return s.plans[DefaultPlan]
+}
@@ -0,0 +1,225 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"smsc/internal/config"
+	"smsc/internal/models"
+)
+
+// Sender ID types a rule can match on
+const (
+	SenderAlphanumeric = "alphanumeric"
+	SenderNumeric      = "numeric"
+)
+
+type Rule struct {
+	ID         string `json:"id"`
+	Plan       string `json:"plan"` // route plan the rule belongs to, the default plan when empty
+	Pattern    string `json:"pattern"`
+	Network    string `json:"network,omitempty"` // when set, matches the network resolved through number portability
+	OperatorID string `json:"operatorId"`
+	Priority   int    `json:"priority"`
+	Weight     int    `json:"weight"`
+
+	// Message conditions; empty conditions match every message
+	Clients       []string `json:"clients,omitempty"`
+	SenderType    string   `json:"senderType,omitempty"`
+	SenderPattern string   `json:"senderPattern,omitempty"`
+	ServiceTypes  []string `json:"serviceTypes,omitempty"`
+	DataCodings   []int    `json:"dataCodings,omitempty"`
+	Priorities    []int    `json:"messagePriorities,omitempty"`
+
+	// Time conditions; the rule only applies inside one of its windows.
+	// Hold rules hold matching messages until the window closes.
+	Windows  []TimeWindow `json:"windows,omitempty"`
+	Timezone string       `json:"timezone,omitempty"` // IANA zone, "destination" or "operator"
+	Calendar string       `json:"calendar,omitempty"` // holiday calendar name
+	Hold     bool         `json:"hold,omitempty"`
+
+	senderRe *regexp.Regexp
+}
+
+// ruleFromConfig converts a configured routing rule
+func ruleFromConfig(cfg config.RoutingRuleConfig) Rule {
+	windows := make([]TimeWindow, 0, len(cfg.Windows))
+	for _, w := range cfg.Windows {
+		windows = append(windows, TimeWindow{
+			Days:  w.Days,
+			Start: w.Start,
+			End:   w.End,
+		})
+	}
+
+	return Rule{
+		Pattern:       cfg.Pattern,
+		Network:       cfg.Network,
+		OperatorID:    cfg.Operator,
+		Priority:      cfg.Priority,
+		Weight:        cfg.Weight,
+		Clients:       cfg.Clients,
+		SenderType:    cfg.SenderType,
+		SenderPattern: cfg.SenderPattern,
+		ServiceTypes:  cfg.ServiceTypes,
+		DataCodings:   cfg.DataCodings,
+		Priorities:    cfg.Priorities,
+		Windows:       windows,
+		Timezone:      cfg.Timezone,
+		Calendar:      cfg.Calendar,
+		Hold:          cfg.Hold,
+	}
+}
+
+// compile validates the rule and prepares its sender pattern and windows
+func (r *Rule) compile() error {
+	if r.OperatorID == "" && !r.Hold {
+		return fmt.Errorf("rule operator is required")
+	}
+	if r.Hold && len(r.Windows) == 0 {
+		return fmt.Errorf("hold rules require at least one time window")
+	}
+
+	if r.Plan == "" {
+		r.Plan = DefaultPlan
+	}
+	if r.Pattern == "" {
+		r.Pattern = "*"
+	}
+	if !isDigits(r.prefix()) {
+		return fmt.Errorf("invalid rule pattern: %s", r.Pattern)
+	}
+
+	switch r.SenderType {
+	case "", SenderAlphanumeric, SenderNumeric:
+	default:
+		return fmt.Errorf("invalid sender type: %s", r.SenderType)
+	}
+
+	windows := make([]TimeWindow, len(r.Windows))
+	for i, w := range r.Windows {
+		if err := w.compile(); err != nil {
+			return err
+		}
+		windows[i] = w
+	}
+	r.Windows = windows
+
+	switch r.Timezone {
+	case "", TimezoneDestination, TimezoneOperator:
+	default:
+		if _, err := time.LoadLocation(r.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+
+	r.senderRe = nil
+	if r.SenderPattern != "" {
+		re, err := regexp.Compile(r.SenderPattern)
+		if err != nil {
+			return fmt.Errorf("invalid sender pattern: %w", err)
+		}
+		r.senderRe = re
+	}
+
+	return nil
+}
+
+// prefix returns the recipient prefix a rule pattern matches on
+func (r Rule) prefix() string {
+	return strings.TrimSuffix(strings.TrimPrefix(r.Pattern, "+"), "*")
+}
+
+// conditions returns the number of message conditions set on the rule
+func (r Rule) conditions() int {
+	n := 0
+	for _, set := range []bool{
+		len(r.Clients) > 0,
+		r.SenderType != "",
+		r.SenderPattern != "",
+		len(r.ServiceTypes) > 0,
+		len(r.DataCodings) > 0,
+		len(r.Priorities) > 0,
+		len(r.Windows) > 0,
+	} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// specificity ranks rules by destination first: network rules win over prefix
+// rules and longer prefixes win over shorter ones. Only between rules for
+// the same destination do more message conditions win, so a catch-all rule
+// with a sender condition never beats a rule for a specific country.
+func (r Rule) specificity() int {
+	n := len(r.prefix()) * 100
+	if r.Network != "" {
+		n += 100000
+	}
+	return n + r.conditions()
+}
+
+// matches reports whether the rule matches the message and its resolved network
+func (r Rule) matches(msg *models.Message, network string) bool {
+	if r.Network != "" && r.Network != network {
+		return false
+	}
+	if !strings.HasPrefix(normalizeMSISDN(msg.Recipient), r.prefix()) {
+		return false
+	}
+
+	if len(r.Clients) > 0 && !containsString(r.Clients, msg.ClientID) {
+		return false
+	}
+	if r.SenderType != "" && senderType(msg.Sender) != r.SenderType {
+		return false
+	}
+	if r.senderRe != nil && !r.senderRe.MatchString(msg.Sender) {
+		return false
+	}
+	if len(r.ServiceTypes) > 0 && !containsString(r.ServiceTypes, msg.ServiceType) {
+		return false
+	}
+	if len(r.DataCodings) > 0 && !containsInt(r.DataCodings, msg.DataCoding) {
+		return false
+	}
+	if len(r.Priorities) > 0 && !containsInt(r.Priorities, msg.Priority) {
+		return false
+	}
+
+	return true
+}
+
+func sameGroup(a, b Rule) bool {
+	return a.specificity() == b.specificity() && a.Priority == b.Priority
+}
+
+// senderType classifies a sender ID as numeric or alphanumeric
+func senderType(sender string) string {
+	if sender != "" && isDigits(strings.TrimPrefix(sender, "+")) {
+		return SenderNumeric
+	}
+	return SenderAlphanumeric
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package routing
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/models"
+)
+
+func TestDestinationOutranksConditions(t *testing.T) {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	rs := New(config.RoutingConfig{
+		Operators: []config.OperatorConfig{
+			{Name: "generic", Priority: 9, Weight: 1},
+			{Name: "uk", Priority: 9, Weight: 1},
+		},
+		Rules: []config.RoutingRuleConfig{
+			{Pattern: "*", Operator: "generic", Priority: 1, Weight: 1, SenderType: SenderAlphanumeric},
+			{Pattern: "44", Operator: "uk", Priority: 1, Weight: 1},
+		},
+	}, log)
+	if err := rs.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &models.Message{Sender: "ACME", Recipient: "447700900123", Content: "hi"}
+	op, err := rs.RouteMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != "uk" {
+		t.Errorf("routed to %s, want the country rule's operator uk", op)
+	}
+}
+
+func TestConditionsBreakTiesForTheSameDestination(t *testing.T) {
+	plain := Rule{Pattern: "44"}
+	conditional := Rule{Pattern: "44", SenderType: SenderNumeric}
+	if conditional.specificity() <= plain.specificity() {
+		t.Error("a condition does not break the tie between rules for the same prefix")
+	}
+	if (Rule{Pattern: "*", SenderType: SenderNumeric, Clients: []string{"a"}}).specificity() >= plain.specificity() {
+		t.Error("a catch-all rule with conditions outranks a prefix rule")
+	}
+	if (Rule{Pattern: "4479"}).specificity() >= (Rule{Network: "vodafone"}).specificity() {
+		t.Error("a prefix rule outranks a network rule")
+	}
+}
@@ -2,37 +2,102 @@ package routing
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/ratelimit"
+	"smsc/internal/tracing"
 )
 
 type Service struct {
-	cfg    config.RoutingConfig
-	log    *logrus.Logger
-	mu     sync.RWMutex
-	active bool
-	rules  []Rule
+	cfg         config.RoutingConfig
+	log         *logrus.Logger
+	mu          sync.RWMutex
+	active      bool
+	rules       []Rule
+	nextRule    int
+	plans       map[string]*Plan
+	assignments map[string]string
+	operators   map[string]*operatorState
+	mnp         *Portability
+	timezones   map[string]*time.Location
+	calendars   map[string]map[string]struct{}
+	throttle    *ratelimit.TPS
+	db          *db.Database
 }
 
-type Rule struct {
-	Pattern    string
-	OperatorID string
-	Priority   int
-	Weight     int
+// configRulePrefix starts the IDs of rules defined in the configuration,
+// which are not stored and cannot be changed through the API
+const configRulePrefix = "config-"
+
+// operatorState holds the runtime state of a configured operator
+type operatorState struct {
+	cfg      config.OperatorConfig
+	active   bool
+	load     *loadTracker
+	location *time.Location
+	prices   map[string]float64
+}
+
+// OperatorStatus describes an operator together with its current load
+type OperatorStatus struct {
+	Name     string       `json:"name"`
+	Priority int          `json:"priority"`
+	Weight   int          `json:"weight"`
+	MaxTPS   int          `json:"maxTps"`
+	Active   bool         `json:"active"`
+	Load     OperatorLoad `json:"load"`
 }
 
 func New(cfg config.RoutingConfig, log *logrus.Logger) *Service {
+	operators := make(map[string]*operatorState, len(cfg.Operators))
+	for _, op := range cfg.Operators {
+		operators[op.Name] = &operatorState{
+			cfg:    op,
+			active: true,
+			load:   &loadTracker{},
+			prices: normalizePrices(op.Prices),
+		}
+	}
+
+	mnp := NewPortability(cfg.Portability, log)
+	if cfg.Portability.HLRURL != "" {
+		mnp.SetHLRLookup(NewHTTPHLR(cfg.Portability.HLRURL, cfg.Portability.HLRTimeout))
+	}
+
 	return &Service{
-		cfg:    cfg,
-		log:    log,
-		active: false,
-		rules:  make([]Rule, 0),
+		cfg:       cfg,
+		log:       log,
+		active:    false,
+		rules:     make([]Rule, 0),
+		operators: operators,
+		mnp:       mnp,
 	}
 }
 
+// SetDatabase sets where rules, route plans and plan assignments made through
+// the API are stored. It must be called before Start, which loads them;
+// without it they only live until the service stops.
+func (s *Service) SetDatabase(database *db.Database) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.db = database
+}
+
 func (s *Service) Start(ctx context.Context) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -41,6 +106,22 @@ func (s *Service) Start(ctx context.Context) error {
 		return fmt.Errorf("routing service is already running")
 	}
 
+	if err := s.loadTimezones(); err != nil {
+		return err
+	}
+
+	if err := s.loadPlans(); err != nil {
+		return err
+	}
+
+	if err := s.loadStoredPlans(ctx); err != nil {
+		return err
+	}
+
+	if err := s.loadRules(ctx); err != nil {
+		return err
+	}
+
 	// Initialize routing rules from configuration
 	for _, op := range s.cfg.Operators {
 		rule := Rule{
@@ -49,7 +130,21 @@ func (s *Service) Start(ctx context.Context) error {
 			Priority:   op.Priority,
 			Weight:     op.Weight,
 		}
-		s.rules = append(s.rules, rule)
+		if err := s.addRule(rule); err != nil {
+			return err
+		}
+	}
+
+	for _, cfg := range s.cfg.Rules {
+		if err := s.addRule(ruleFromConfig(cfg)); err != nil {
+			return fmt.Errorf("invalid routing rule %q: %w", cfg.Pattern, err)
+		}
+	}
+
+	if s.cfg.Portability.Enabled && s.cfg.Portability.DumpFile != "" {
+		if _, err := s.mnp.ImportFile(s.cfg.Portability.DumpFile, true); err != nil {
+			return fmt.Errorf("failed to load MNP database: %w", err)
+		}
 	}
 
 	s.active = true
@@ -70,48 +165,457 @@ func (s *Service) Stop(ctx context.Context) error {
 	return nil
 }
 
-// RouteMessage determines the appropriate operator for a message
-func (s *Service) RouteMessage(ctx context.Context, recipient string) (string, error) {
+// RouteMessage determines the appropriate operator for a message.
+// Matching rules are tried from the most specific destination (network, then
+// longest prefix), with message conditions only breaking ties, and highest
+// priority down; within a group the operator is picked by weight among those that are
+// active and not saturated. If every matching operator is saturated, the least
+// loaded one is used instead. A *HoldError is returned when the message falls
+// into the window of a hold rule.
+//
+// The chosen operator's submit is taken from its cluster-wide TPS budget. An
+// operator over its budget is avoided and the message routed again; when no
+// other operator is available, the message waits briefly for the budget or
+// a *ThrottleError is returned.
+func (s *Service) RouteMessage(ctx context.Context, msg *models.Message) (string, error) {
+	ctx, span := tracing.StartMessage(ctx, "routing.decide", msg.MessageID)
+	defer span.End()
+
+	throttled := make(map[string]bool)
+	for {
+		d, err := s.decide(ctx, msg, true)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return "", err
+		}
+
+		span.SetAttributes(
+			attribute.String("smsc.route_plan", d.Plan),
+			attribute.String("smsc.operator", d.Operator),
+			attribute.String("smsc.route_reason", d.Reason),
+			attribute.String("smsc.rule_id", d.RuleID),
+		)
+		if d.Hold != nil {
+			span.SetAttributes(attribute.String("smsc.hold_until", d.Hold.Until.Format(time.RFC3339)))
+			return "", d.Hold
+		}
+
+		if !throttled[d.Operator] {
+			if !s.acquire(ctx, d.Operator) {
+				throttled[d.Operator] = true
+				continue
+			}
+		} else if err := s.await(ctx, d.Operator); err != nil {
+			span.SetAttributes(attribute.Bool("smsc.throttled", true))
+			return "", err
+		}
+
+		if d.Reason == ReasonLeastLoaded {
+			s.log.WithField("operator", d.Operator).Debug("All matching operators saturated, using least loaded")
+		}
+		return d.Operator, nil
+	}
+}
+
+// decide runs the routing algorithm and records how the decision was reached.
+// Without lookup, the recipient's network only comes from the MNP database
+// and cache, so that nothing is looked up or cached.
+func (s *Service) decide(ctx context.Context, msg *models.Message, lookup bool) (*Decision, error) {
+	network, resolved, err := s.resolveNetwork(ctx, msg.Recipient, lookup)
+	if err != nil {
+		s.log.WithError(err).WithField("recipient", msg.Recipient).Warn("Number portability lookup failed, routing on prefix")
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	if !s.active {
-		return "", fmt.Errorf("routing service is not active")
+		return nil, fmt.Errorf("routing service is not active")
+	}
+
+	plan := s.planFor(msg.ClientID)
+	d := &Decision{
+		Recipient:         msg.Recipient,
+		Network:           network,
+		NetworkUnresolved: !resolved,
+		Plan:              plan.Name,
+	}
+
+	now := time.Now()
+	if hold, ok := s.holdRule(plan.Name, msg, network, now); ok {
+		d.Rules = []Rule{hold}
+		d.Hold = &HoldError{RuleID: hold.ID, Until: s.holdUntil(hold, msg, now)}
+		d.Reason = ReasonHold
+		return d, nil
+	}
+
+	chosen, fallback := s.evaluate(d, s.matchRules(plan.Name, msg, network, now), now)
+
+	// Plans without a default route of their own fall back to the default plan
+	if chosen == nil && fallback == nil && plan.Name != DefaultPlan && plan.DefaultRoute == "" {
+		plan = s.plans[DefaultPlan]
+		chosen, fallback = s.evaluate(d, s.matchRules(DefaultPlan, msg, network, now), now)
+	}
+
+	switch {
+	case chosen != nil:
+		d.Operator, d.RuleID, d.Reason = chosen.OperatorID, chosen.ID, ReasonRule
+	case fallback != nil:
+		d.Operator, d.RuleID, d.Reason = fallback.OperatorID, fallback.ID, ReasonLeastLoaded
+	default:
+		d.Operator, d.Reason = plan.DefaultRoute, ReasonDefaultRoute
+	}
+
+	for i := range d.Candidates {
+		if d.Candidates[i].RuleID == d.RuleID && d.RuleID != "" {
+			d.Candidates[i].Selected = true
+		}
+	}
+
+	if price, ok := s.operatorPrice(d.Operator, msg.Recipient); ok {
+		d.Price = &price
+	}
+
+	return d, nil
+}
+
+// evaluate walks the matched rules in groups of equal specificity and priority,
+// recording them and their candidates on the decision. It returns the rule
+// picked by weight from the first group with an available operator, and the
+// least loaded saturated rule as a fallback.
+func (s *Service) evaluate(d *Decision, rules []Rule, now time.Time) (chosen, fallback *Rule) {
+	d.Rules = append(d.Rules, rules...)
+
+	var fallbackLoad float64
+	for start := 0; start < len(rules); {
+		end := start + 1
+		for end < len(rules) && sameGroup(rules[start], rules[end]) {
+			end++
+		}
+
+		var available []Rule
+		for _, rule := range rules[start:end] {
+			c := s.candidate(rule, now)
+			d.Candidates = append(d.Candidates, c)
+
+			if c.Available {
+				available = append(available, rule)
+				continue
+			}
+			if c.Active && (fallback == nil || c.Load.Utilization < fallbackLoad) {
+				r := rule
+				fallback = &r
+				fallbackLoad = c.Load.Utilization
+			}
+		}
+
+		if chosen == nil && len(available) > 0 {
+			r := pickWeighted(available)
+			chosen = &r
+		}
+
+		start = end
+	}
+
+	return chosen, fallback
+}
+
+// resolveNetwork looks up the serving network of the recipient when number
+// portability is enabled and a rule matches on networks. Without lookup only
+// the MNP database and cache are consulted; it reports false when they do not
+// know the recipient.
+func (s *Service) resolveNetwork(ctx context.Context, recipient string, lookup bool) (string, bool, error) {
+	if !s.cfg.Portability.Enabled {
+		return "", true, nil
+	}
+
+	s.mu.RLock()
+	needed := false
+	for _, rule := range s.rules {
+		if rule.Network != "" {
+			needed = true
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if !needed {
+		return "", true, nil
+	}
+	if !lookup {
+		network, ok := s.mnp.Cached(recipient)
+		return network, ok, nil
+	}
+	network, err := s.mnp.Resolve(ctx, recipient)
+	return network, true, err
+}
+
+// ResolveNetwork returns the network serving a recipient when number
+// portability is enabled, or an empty string
+func (s *Service) ResolveNetwork(ctx context.Context, recipient string) (string, error) {
+	if !s.cfg.Portability.Enabled {
+		return "", nil
+	}
+	return s.mnp.Resolve(ctx, recipient)
+}
+
+// holdRule returns the first hold rule of the plan or of the default plan
+// currently applying to the message
+func (s *Service) holdRule(plan string, msg *models.Message, network string, now time.Time) (Rule, bool) {
+	for _, rule := range s.rules {
+		if rule.Plan != plan && rule.Plan != DefaultPlan {
+			continue
+		}
+		if rule.Hold && rule.matches(msg, network) && s.inWindow(rule, msg, now) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// matchRules returns the operator rules of a plan applying to the message
+// ordered by specificity and then priority
+func (s *Service) matchRules(plan string, msg *models.Message, network string, now time.Time) []Rule {
+	var matched []Rule
+	for _, rule := range s.rules {
+		if rule.Plan != plan || rule.Hold {
+			continue
+		}
+		if rule.matches(msg, network) && s.inWindow(rule, msg, now) {
+			matched = append(matched, rule)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if si, sj := matched[i].specificity(), matched[j].specificity(); si != sj {
+			return si > sj
+		}
+		return matched[i].Priority < matched[j].Priority
+	})
+
+	return matched
+}
+
+// pickWeighted selects a rule at random, proportionally to its weight
+func pickWeighted(rules []Rule) Rule {
+	total := 0
+	for _, rule := range rules {
+		if rule.Weight > 0 {
+			total += rule.Weight
+		}
+	}
+
+	if total == 0 {
+		return rules[rand.Intn(len(rules))]
+	}
+
+	n := rand.Intn(total)
+	for _, rule := range rules {
+		if rule.Weight <= 0 {
+			continue
+		}
+		if n < rule.Weight {
+			return rule
+		}
+		n -= rule.Weight
 	}
 
-	// TODO: Implement proper routing logic
-	// 1. Check recipient against routing patterns
-	// 2. Consider operator priorities
-	// 3. Apply load balancing based on weights
-	// 4. Handle fallback routes
-	// 5. Consider operator status and capacity
+	return rules[len(rules)-1]
+}
 
-	// For now, return the default route
-	return s.cfg.DefaultRoute, nil
+// AddRule validates and adds a new routing rule, returning it with its assigned ID
+func (s *Service) AddRule(ctx context.Context, rule Rule) (Rule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkRule(&rule); err != nil {
+		return Rule{}, err
+	}
+
+	if s.db == nil {
+		s.nextRule++
+		rule.ID = strconv.Itoa(s.nextRule)
+	} else {
+		definition, err := json.Marshal(rule)
+		if err != nil {
+			return Rule{}, fmt.Errorf("failed to encode routing rule: %w", err)
+		}
+		id, err := s.db.InsertRoutingRule(ctx, rule.Pattern, rule.Priority, definition)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.ID = strconv.FormatInt(id, 10)
+	}
+
+	s.rules = append(s.rules, rule)
+	s.sortRules()
+	return rule, nil
 }
 
-// AddRule adds a new routing rule
-func (s *Service) AddRule(ctx context.Context, rule Rule) error {
+// UpdateRule replaces the routing rule with the given ID
+func (s *Service) UpdateRule(ctx context.Context, id string, rule Rule) (Rule, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// TODO: Implement rule validation and addition
-	// 1. Validate rule pattern
-	// 2. Check for conflicts
-	// 3. Sort rules by priority
-	// 4. Persist rule
-	return nil
+	i, storedID, err := s.findRule(id)
+	if err != nil {
+		return Rule{}, err
+	}
+	if err := s.checkRule(&rule); err != nil {
+		return Rule{}, err
+	}
+	rule.ID = id
+
+	if s.db != nil {
+		definition, err := json.Marshal(rule)
+		if err != nil {
+			return Rule{}, fmt.Errorf("failed to encode routing rule: %w", err)
+		}
+		if err := s.db.UpdateRoutingRule(ctx, storedID, rule.Pattern, rule.Priority, definition); err != nil {
+			return Rule{}, err
+		}
+	}
+
+	s.rules[i] = rule
+	s.sortRules()
+	return rule, nil
 }
 
-// RemoveRule removes a routing rule
-func (s *Service) RemoveRule(ctx context.Context, pattern string) error {
+// RemoveRule removes the routing rule with the given ID
+func (s *Service) RemoveRule(ctx context.Context, id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// TODO: Implement rule removal
-	// 1. Find rule by pattern
-	// 2. Remove from active rules
-	// 3. Update persistent storage
+	i, storedID, err := s.findRule(id)
+	if err != nil {
+		return err
+	}
+
+	if s.db != nil {
+		if err := s.db.DeleteRoutingRule(ctx, storedID); err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+	}
+
+	s.rules = append(s.rules[:i], s.rules[i+1:]...)
+	return nil
+}
+
+// findRule returns the index and stored ID of a rule the API may change.
+// The caller must hold the lock.
+func (s *Service) findRule(id string) (int, int64, error) {
+	if strings.HasPrefix(id, configRulePrefix) {
+		return 0, 0, fmt.Errorf("routing rule %s is defined in the configuration", id)
+	}
+	storedID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("routing rule not found: %s", id)
+	}
+	for i := range s.rules {
+		if s.rules[i].ID == id {
+			return i, storedID, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("routing rule not found: %s", id)
+}
+
+// Rules returns the active routing rules ordered by priority
+func (s *Service) Rules() []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rules := make([]Rule, len(s.rules))
+	copy(rules, s.rules)
+	return rules
+}
+
+// addRule validates a rule from the configuration, assigns its ID and inserts
+// it in priority order. The caller must hold the write lock.
+func (s *Service) addRule(rule Rule) error {
+	if err := s.checkRule(&rule); err != nil {
+		return err
+	}
+
+	s.nextRule++
+	rule.ID = configRulePrefix + strconv.Itoa(s.nextRule)
+	s.rules = append(s.rules, rule)
+	s.sortRules()
+	return nil
+}
+
+// checkRule validates a rule and its route plan
+func (s *Service) checkRule(rule *Rule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if _, ok := s.plans[rule.Plan]; !ok {
+		return fmt.Errorf("route plan not found: %s", rule.Plan)
+	}
+	return nil
+}
+
+// loadRules adds the rules stored through the API. Rules that no longer
+// validate, e.g. because their route plan was removed from the
+// configuration, are skipped. Stored plans must be loaded first. The caller must hold the write lock.
+func (s *Service) loadRules(ctx context.Context) error {
+	if s.db == nil {
+		return nil
+	}
+
+	rows, err := s.db.ListRoutingRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var rule Rule
+		err := json.Unmarshal(row.Definition, &rule)
+		if err == nil {
+			err = s.checkRule(&rule)
+		}
+		if err != nil {
+			s.log.WithError(err).WithField("rule_id", row.ID).Warn("Skipping invalid stored routing rule")
+			continue
+		}
+		rule.ID = strconv.FormatInt(row.ID, 10)
+		s.rules = append(s.rules, rule)
+	}
+	s.sortRules()
+	return nil
+}
+
+func (s *Service) sortRules() {
+	sort.SliceStable(s.rules, func(i, j int) bool {
+		return s.rules[i].Priority < s.rules[j].Priority
+	})
+}
+
+// Check reports an error when the routing service is not running
+func (s *Service) Check(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.active {
+		return fmt.Errorf("routing service is not running")
+	}
+	return nil
+}
+
+// CheckOperator reports an error when an operator is disabled or saturated
+func (s *Service) CheckOperator(ctx context.Context, operatorID string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	op, ok := s.operators[operatorID]
+	if !ok {
+		return fmt.Errorf("unknown operator: %s", operatorID)
+	}
+	if !op.active {
+		return fmt.Errorf("operator %s is inactive", operatorID)
+	}
+	if load := op.load.snapshot(time.Now(), op.cfg.MaxTPS); load.Saturated {
+		return fmt.Errorf("operator %s is saturated (%.1f TPS, %d in flight)", operatorID, load.TPS, load.InFlight)
+	}
 	return nil
 }
 
@@ -120,21 +624,91 @@ func (s *Service) UpdateOperatorStatus(ctx context.Context, operatorID string, a
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// TODO: Implement operator status management
-	// 1. Update operator status
-	// 2. Adjust routing decisions
-	// 3. Update metrics
+	op, ok := s.operators[operatorID]
+	if !ok {
+		return fmt.Errorf("unknown operator: %s", operatorID)
+	}
+
+	op.active = active
+	s.log.WithFields(logrus.Fields{
+		"operator": operatorID,
+		"active":   active,
+	}).Info("Operator status updated")
 	return nil
 }
 
-// GetOperatorLoad returns the current load of an operator
+// BeginSubmit records a message submitted to an operator and marks it in flight.
+// Every call must be paired with EndSubmit once the operator has responded.
+// The pipeline calls it around submits only, so without a submitter no load
+// is recorded. With the operator gateway every routed message is submitted:
+// operators without a submit URL, whose messages end in the routed status,
+// show the rate of the messages routed to them.
+func (s *Service) BeginSubmit(operatorID string) {
+	s.mu.RLock()
+	op, ok := s.operators[operatorID]
+	s.mu.RUnlock()
+
+	if ok {
+		op.load.begin(time.Now())
+	}
+}
+
+// EndSubmit marks a submit previously recorded with BeginSubmit as completed
+func (s *Service) EndSubmit(operatorID string) {
+	s.mu.RLock()
+	op, ok := s.operators[operatorID]
+	s.mu.RUnlock()
+
+	if ok {
+		op.load.end()
+	}
+}
+
+// GetOperatorLoad returns the current load of an operator as a fraction of its max TPS
 func (s *Service) GetOperatorLoad(ctx context.Context, operatorID string) (float64, error) {
+	load, err := s.OperatorLoad(operatorID)
+	if err != nil {
+		return 0, err
+	}
+	return load.Utilization, nil
+}
+
+// OperatorLoad returns the current load snapshot of an operator
+func (s *Service) OperatorLoad(operatorID string) (OperatorLoad, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// TODO: Implement load monitoring
-	// 1. Calculate current TPS
-	// 2. Compare against max TPS
-	// 3. Consider queue sizes
-	return 0.0, nil
-} 
\ No newline at end of file
+	op, ok := s.operators[operatorID]
+	if !ok {
+		return OperatorLoad{}, fmt.Errorf("unknown operator: %s", operatorID)
+	}
+
+	return op.load.snapshot(time.Now(), op.cfg.MaxTPS), nil
+}
+
+// Operators returns the configured operators with their status and load
+func (s *Service) Operators() []OperatorStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]OperatorStatus, 0, len(s.cfg.Operators))
+	for _, cfg := range s.cfg.Operators {
+		op := s.operators[cfg.Name]
+		result = append(result, OperatorStatus{
+			Name:     cfg.Name,
+			Priority: cfg.Priority,
+			Weight:   cfg.Weight,
+			MaxTPS:   cfg.MaxTPS,
+			Active:   op.active,
+			Load:     op.load.snapshot(now, cfg.MaxTPS),
+		})
+	}
+
+	return result
+}
+
+// Portability returns the number portability resolver used for routing
+func (s *Service) Portability() *Portability {
+	return s.mnp
+}
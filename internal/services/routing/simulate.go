@@ -0,0 +1,116 @@
+package routing
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"smsc/internal/models"
+)
+
+// Reasons explaining how a routing decision was reached
+const (
+	ReasonRule         = "rule"
+	ReasonLeastLoaded  = "least_loaded"
+	ReasonDefaultRoute = "default_route"
+	ReasonHold         = "hold"
+)
+
+// Decision describes how a message was, or would be, routed
+type Decision struct {
+	Recipient string `json:"recipient"`
+	Network   string `json:"network,omitempty"`
+	// NetworkUnresolved is set by simulations when the network of the
+	// recipient is neither imported nor cached; routing would look it up
+	NetworkUnresolved bool        `json:"networkUnresolved,omitempty"`
+	Plan              string      `json:"plan"`
+	Rules             []Rule      `json:"rules"`
+	Candidates        []Candidate `json:"candidates"`
+	Operator          string      `json:"operator,omitempty"`
+	RuleID            string      `json:"ruleId,omitempty"`
+	Reason            string      `json:"reason"`
+	Price             *float64    `json:"price,omitempty"`
+	Hold              *HoldError  `json:"hold,omitempty"`
+}
+
+// Candidate is an operator considered while routing, with its health and load
+type Candidate struct {
+	RuleID     string       `json:"ruleId"`
+	OperatorID string       `json:"operatorId"`
+	Priority   int          `json:"priority"`
+	Weight     int          `json:"weight"`
+	Active     bool         `json:"active"`
+	Available  bool         `json:"available"`
+	Load       OperatorLoad `json:"load"`
+	Selected   bool         `json:"selected"`
+}
+
+// Simulate runs the routing algorithm for a message and returns the matched
+// rules, the candidate operators and the final choice. It has no side
+// effects: the recipient's network comes from the MNP database and cache
+// only, without HLR lookups, and nothing is cached or throttled.
+func (s *Service) Simulate(ctx context.Context, msg *models.Message) (*Decision, error) {
+	return s.decide(ctx, msg, false)
+}
+
+// candidate evaluates the operator behind a rule. Operators unknown to the
+// configuration are assumed active and unlimited.
+func (s *Service) candidate(rule Rule, now time.Time) Candidate {
+	c := Candidate{
+		RuleID:     rule.ID,
+		OperatorID: rule.OperatorID,
+		Priority:   rule.Priority,
+		Weight:     rule.Weight,
+		Active:     true,
+		Available:  true,
+	}
+
+	op, ok := s.operators[rule.OperatorID]
+	if !ok {
+		return c
+	}
+
+	c.Active = op.active
+	c.Load = op.load.snapshot(now, op.cfg.MaxTPS)
+	c.Available = c.Active && !c.Load.Saturated
+	return c
+}
+
+// OperatorPrice returns what an operator charges per segment for a recipient
+func (s *Service) OperatorPrice(operatorID, recipient string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.operatorPrice(operatorID, recipient)
+}
+
+// operatorPrice returns the operator's per-segment price for the longest
+// configured prefix matching the recipient. The caller must hold the lock.
+func (s *Service) operatorPrice(operatorID, recipient string) (float64, bool) {
+	op, ok := s.operators[operatorID]
+	if !ok {
+		return 0, false
+	}
+
+	recipient = normalizeMSISDN(recipient)
+	best, found := "", false
+	for prefix := range op.prices {
+		if strings.HasPrefix(recipient, prefix) && (!found || len(prefix) > len(best)) {
+			best, found = prefix, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return op.prices[best], true
+}
+
+// normalizePrices keys a configured price list by normalized prefix, with the
+// "*" wildcard becoming the empty prefix
+func normalizePrices(prices map[string]float64) map[string]float64 {
+	normalized := make(map[string]float64, len(prices))
+	for prefix, price := range prices {
+		normalized[strings.TrimSuffix(normalizeMSISDN(prefix), "*")] = price
+	}
+	return normalized
+}
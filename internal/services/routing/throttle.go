@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"smsc/internal/ratelimit"
+)
+
+// throttleWait is how long a message waits for the TPS budget of an operator
+// once every matching operator is throttled, before it is held instead
+const throttleWait = 250 * time.Millisecond
+
+// ThrottleError is returned by RouteMessage when the operator chosen for a
+// message is over its cluster-wide TPS and the message must be held briefly
+type ThrottleError struct {
+	Operator string    `json:"operator"`
+	Until    time.Time `json:"until"`
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("operator %s is over its TPS limit until %s", e.Operator, e.Until.Format(time.RFC3339Nano))
+}
+
+// HoldUntil returns the time the message may be released
+func (e *ThrottleError) HoldUntil() time.Time {
+	return e.Until
+}
+
+// SetThrottle sets the limiter that enforces the max TPS of operators across
+// all instances. It must be called before messages are routed; without it
+// only the local load of an operator is considered.
+func (s *Service) SetThrottle(throttle *ratelimit.TPS) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.throttle = throttle
+}
+
+// acquire takes a submit from the cluster-wide TPS budget of an operator.
+// Operators over their budget are marked throttled, so routing prefers
+// other operators until the budget refills.
+func (s *Service) acquire(ctx context.Context, operatorID string) bool {
+	s.mu.RLock()
+	throttle := s.throttle
+	op, ok := s.operators[operatorID]
+	s.mu.RUnlock()
+
+	if throttle == nil || !ok || op.cfg.MaxTPS <= 0 {
+		return true
+	}
+
+	r := throttle.Acquire(ctx, "operator:"+operatorID, op.cfg.MaxTPS)
+	if !r.Allowed {
+		op.load.throttle(time.Now().Add(r.RetryAfter))
+	}
+	return r.Allowed
+}
+
+// await waits up to throttleWait for the TPS budget of a throttled operator
+// and returns a *ThrottleError when it does not refill in time
+func (s *Service) await(ctx context.Context, operatorID string) error {
+	s.mu.RLock()
+	op, ok := s.operators[operatorID]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	deadline := time.Now().Add(throttleWait)
+	for {
+		until := op.load.throttledUntil()
+		if until.After(deadline) {
+			return &ThrottleError{Operator: operatorID, Until: until}
+		}
+
+		timer := time.NewTimer(time.Until(until))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		if s.acquire(ctx, operatorID) {
+			return nil
+		}
+	}
+}
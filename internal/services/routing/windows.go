@@ -0,0 +1,281 @@
+package routing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"smsc/internal/models"
+)
+
+// Timezone sources a rule can use instead of an explicit IANA zone name
+const (
+	TimezoneDestination = "destination"
+	TimezoneOperator    = "operator"
+)
+
+// Holiday is the pseudo-day matching the dates of the rule's holiday calendar
+const Holiday = "holiday"
+
+// maxHoldSteps bounds how many adjacent windows are chained when computing a hold
+const maxHoldSteps = 16
+
+// TimeWindow is a daily time range in which a rule applies. End may be
+// before Start for windows spanning midnight.
+type TimeWindow struct {
+	Days  []string `json:"days,omitempty"` // mon..sun or "holiday", empty means every day
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM, 24:00 for end of day
+
+	start, end int
+}
+
+// HoldError is returned by RouteMessage when a message falls into a quiet-hours
+// window and must be held until the window closes
+type HoldError struct {
+	RuleID string    `json:"ruleId"`
+	Until  time.Time `json:"until"`
+}
+
+func (e *HoldError) Error() string {
+	return fmt.Sprintf("message held by routing rule %s until %s", e.RuleID, e.Until.Format(time.RFC3339))
+}
+
+// HoldUntil returns the time the message may be released
+func (e *HoldError) HoldUntil() time.Time {
+	return e.Until
+}
+
+// compile parses the window bounds and validates its days
+func (w *TimeWindow) compile() error {
+	var err error
+	if w.start, err = parseClock(w.Start); err != nil {
+		return err
+	}
+	if w.end, err = parseClock(w.End); err != nil {
+		return err
+	}
+	if w.start == w.end {
+		return fmt.Errorf("empty time window %s-%s", w.Start, w.End)
+	}
+
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok && !strings.EqualFold(day, Holiday) {
+			return fmt.Errorf("invalid day: %s", day)
+		}
+	}
+	return nil
+}
+
+// contains reports whether the local time falls into the window. For windows
+// spanning midnight, the part after midnight belongs to the previous day.
+func (w TimeWindow) contains(local time.Time, holiday func(time.Time) bool) bool {
+	minute := local.Hour()*60 + local.Minute()
+
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end && w.appliesOn(local, holiday)
+	}
+	if minute >= w.start {
+		return w.appliesOn(local, holiday)
+	}
+	if minute < w.end {
+		return w.appliesOn(local.AddDate(0, 0, -1), holiday)
+	}
+	return false
+}
+
+// closesAt returns when the window occurrence containing local ends
+func (w TimeWindow) closesAt(local time.Time) time.Time {
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	if w.start > w.end && local.Hour()*60+local.Minute() >= w.start {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.Add(time.Duration(w.end) * time.Minute)
+}
+
+// appliesOn reports whether the window is active on a day. On holidays only
+// windows listing the holiday pseudo-day, or no days at all, apply.
+func (w TimeWindow) appliesOn(day time.Time, holiday func(time.Time) bool) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	isHoliday := holiday(day)
+	for _, d := range w.Days {
+		if strings.EqualFold(d, Holiday) {
+			if isHoliday {
+				return true
+			}
+			continue
+		}
+		if !isHoliday && weekdays[strings.ToLower(d)] == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseClock converts HH:MM to minutes after midnight
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time: %q", clock)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %q", clock)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 || h < 0 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time: %q", clock)
+	}
+	return h*60 + m, nil
+}
+
+// inWindow reports whether the rule applies at the given time. Rules without
+// windows always apply.
+func (s *Service) inWindow(rule Rule, msg *models.Message, now time.Time) bool {
+	if len(rule.Windows) == 0 {
+		return true
+	}
+
+	local := now.In(s.ruleLocation(rule, msg))
+	holiday := s.holidayFunc(rule.Calendar)
+	for _, w := range rule.Windows {
+		if w.contains(local, holiday) {
+			return true
+		}
+	}
+	return false
+}
+
+// holdUntil returns when a hold rule stops applying, following adjacent windows
+func (s *Service) holdUntil(rule Rule, msg *models.Message, now time.Time) time.Time {
+	local := now.In(s.ruleLocation(rule, msg))
+	holiday := s.holidayFunc(rule.Calendar)
+
+	for step := 0; step < maxHoldSteps; step++ {
+		var (
+			next  time.Time
+			found bool
+		)
+		for _, w := range rule.Windows {
+			if w.contains(local, holiday) {
+				if end := w.closesAt(local); !found || end.After(next) {
+					next = end
+					found = true
+				}
+			}
+		}
+		if !found {
+			break
+		}
+		local = next
+	}
+
+	return local
+}
+
+// ruleLocation resolves the timezone the rule windows are evaluated in
+func (s *Service) ruleLocation(rule Rule, msg *models.Message) *time.Location {
+	switch rule.Timezone {
+	case "", TimezoneDestination:
+		if loc := s.destinationLocation(msg.Recipient); loc != nil {
+			return loc
+		}
+		if loc := s.operatorLocation(rule.OperatorID); loc != nil {
+			return loc
+		}
+	case TimezoneOperator:
+		if loc := s.operatorLocation(rule.OperatorID); loc != nil {
+			return loc
+		}
+	default:
+		if loc, err := time.LoadLocation(rule.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// destinationLocation returns the timezone of the longest configured prefix
+// matching the recipient
+func (s *Service) destinationLocation(recipient string) *time.Location {
+	recipient = normalizeMSISDN(recipient)
+
+	best := ""
+	for prefix := range s.timezones {
+		if strings.HasPrefix(recipient, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return s.timezones[best]
+}
+
+func (s *Service) operatorLocation(operatorID string) *time.Location {
+	op, ok := s.operators[operatorID]
+	if !ok {
+		return nil
+	}
+	return op.location
+}
+
+// holidayFunc returns a predicate reporting whether a day is a holiday in the calendar
+func (s *Service) holidayFunc(calendar string) func(time.Time) bool {
+	days := s.calendars[strings.ToLower(calendar)]
+	return func(t time.Time) bool {
+		_, ok := days[t.Format("2006-01-02")]
+		return ok
+	}
+}
+
+// loadTimezones parses the configured destination timezones and holiday calendars
+func (s *Service) loadTimezones() error {
+	s.timezones = make(map[string]*time.Location, len(s.cfg.Timezones))
+	for prefix, name := range s.cfg.Timezones {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return fmt.Errorf("invalid timezone for prefix %s: %w", prefix, err)
+		}
+		s.timezones[normalizeMSISDN(prefix)] = loc
+	}
+
+	for name, op := range s.operators {
+		if op.cfg.Timezone == "" {
+			continue
+		}
+		loc, err := time.LoadLocation(op.cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone for operator %s: %w", name, err)
+		}
+		op.location = loc
+	}
+
+	s.calendars = make(map[string]map[string]struct{}, len(s.cfg.Calendars))
+	for name, dates := range s.cfg.Calendars {
+		days := make(map[string]struct{}, len(dates))
+		for _, date := range dates {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return fmt.Errorf("invalid holiday %q in calendar %s", date, name)
+			}
+			days[date] = struct{}{}
+		}
+		s.calendars[strings.ToLower(name)] = days
+	}
+
+	return nil
+}
@@ -0,0 +1,425 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+	"smsc/internal/ratelimit"
+	"smsc/internal/services/pricing"
+	"smsc/internal/services/queue"
+	"smsc/internal/services/routing"
+	"smsc/pkg/utils"
+)
+
+const maxTenantIDLen = 64
+
+var (
+	// ErrUnknownTenant is returned for client IDs that are not a tenant
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrTenantDisabled is returned for traffic of a disabled tenant
+	ErrTenantDisabled = errors.New("tenant is disabled")
+	// ErrSenderNotAllowed is returned for senders a tenant has not registered
+	ErrSenderNotAllowed = errors.New("sender ID is not registered for the tenant")
+	// ErrQuotaExceeded is returned when a tenant used up its message quota.
+	// Messages are counted when they are stored, so it comes from the database.
+	ErrQuotaExceeded = db.ErrQuotaExceeded
+	// ErrInvalidTenant is returned for invalid tenant settings
+	ErrInvalidTenant = errors.New("invalid tenant")
+	// ErrThrottled is returned when a tenant submits faster than its max TPS
+	ErrThrottled = errors.New("tenant TPS limit exceeded")
+)
+
+// Service keeps the tenants of the SMSC and admits their messages against
+// their sender IDs and quotas. Each tenant's route plan and TPS limit are
+// applied to the routing and queue services.
+type Service struct {
+	cfg      config.TenantConfig
+	db       *db.Database
+	routing  *routing.Service
+	queue    *queue.Service
+	pricing  *pricing.Service
+	throttle *ratelimit.TPS
+	log      *logrus.Logger
+	mu       sync.Mutex
+	active   bool
+	tenants  map[string]*models.Tenant
+	systems  map[string]string // SMPP system ID to tenant ID
+}
+
+func New(cfg config.TenantConfig, database *db.Database, routingService *routing.Service, queueService *queue.Service,
+	pricingService *pricing.Service, throttle *ratelimit.TPS, log *logrus.Logger) *Service {
+	return &Service{
+		cfg:      cfg,
+		db:       database,
+		routing:  routingService,
+		queue:    queueService,
+		pricing:  pricingService,
+		throttle: throttle,
+		log:      log,
+		tenants:  make(map[string]*models.Tenant),
+		systems:  make(map[string]string),
+	}
+}
+
+// Start loads the tenants. The routing and queue services must be running.
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("tenant service is already running")
+	}
+
+	tenants, err := s.db.ListTenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if err := s.apply(ctx, nil, t); err != nil {
+			s.log.WithError(err).WithField("tenant", t.ID).Error("Failed to assign tenant route plan; it is routed by the default plan")
+		}
+	}
+
+	s.active = true
+	s.log.Infof("Tenant service started with %d tenants", len(tenants))
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return nil
+	}
+
+	s.active = false
+	s.log.Info("Tenant service stopped")
+	return nil
+}
+
+// Tenants returns every tenant ordered by ID
+func (s *Service) Tenants() []models.Tenant {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenants := make([]models.Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		tenants = append(tenants, *t)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Tenant returns a tenant by ID
+func (s *Service) Tenant(id string) (models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tenants[id]
+	if !ok {
+		return models.Tenant{}, ErrUnknownTenant
+	}
+	return *t, nil
+}
+
+// Create adds a tenant
+func (s *Service) Create(ctx context.Context, t models.Tenant) (models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[t.ID]; ok {
+		return models.Tenant{}, fmt.Errorf("%w: tenant %s already exists", ErrInvalidTenant, t.ID)
+	}
+	if err := s.validate(&t); err != nil {
+		return models.Tenant{}, err
+	}
+
+	if err := s.db.CreateTenant(ctx, &t); err != nil {
+		return models.Tenant{}, err
+	}
+	if err := s.apply(ctx, nil, &t); err != nil {
+		return models.Tenant{}, err
+	}
+
+	s.log.WithField("tenant", t.ID).Info("Tenant created")
+	return t, nil
+}
+
+// Update replaces the settings of a tenant
+func (s *Service) Update(ctx context.Context, t models.Tenant) (models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.tenants[t.ID]
+	if !ok {
+		return models.Tenant{}, ErrUnknownTenant
+	}
+	if err := s.validate(&t); err != nil {
+		return models.Tenant{}, err
+	}
+
+	if err := s.db.UpdateTenant(ctx, &t); err != nil {
+		return models.Tenant{}, err
+	}
+	t.CreatedAt = old.CreatedAt
+	if err := s.apply(ctx, old, &t); err != nil {
+		return models.Tenant{}, err
+	}
+
+	s.log.WithField("tenant", t.ID).Info("Tenant updated")
+	return t, nil
+}
+
+// Usage returns the message volume of a tenant in the current quota periods
+func (s *Service) Usage(ctx context.Context, id string) (models.TenantUsage, error) {
+	t, err := s.Tenant(id)
+	if err != nil {
+		return models.TenantUsage{}, err
+	}
+
+	day, month := periods(time.Now())
+	u, err := s.db.ClientUsage(ctx, id, day, month)
+	if err != nil {
+		return models.TenantUsage{}, err
+	}
+	u.DailyQuota, u.MonthlyQuota, u.MaxTPS = t.DailyQuota, t.MonthlyQuota, t.MaxTPS
+	return u, nil
+}
+
+// ForSystemID returns the tenant owning an SMPP account
+func (s *Service) ForSystemID(systemID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.systems[systemID]
+	return id, ok
+}
+
+// Throttle takes a submit of an SMPP account from the TPS budget of its
+// tenant, which is shared by all instances, and returns ErrThrottled when
+// the budget is used up. Accounts without a tenant are not throttled here.
+func (s *Service) Throttle(ctx context.Context, systemID string) error {
+	s.mu.Lock()
+	var maxTPS int
+	id, ok := s.systems[systemID]
+	if ok {
+		maxTPS = s.tenants[id].MaxTPS
+	}
+	s.mu.Unlock()
+
+	if !ok || maxTPS <= 0 {
+		return nil
+	}
+	if r := s.throttle.Acquire(ctx, "client:"+id, maxTPS); !r.Allowed {
+		return fmt.Errorf("%w: %s allows %d messages per second", ErrThrottled, id, maxTPS)
+	}
+	return nil
+}
+
+// Check reports whether a client may use the SMSC: disabled tenants may not,
+// nor clients without a tenant when tenants are required
+func (s *Service) Check(clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.lookup(clientID)
+	return err
+}
+
+// Admit checks a new message against the sender IDs and quotas of its
+// tenant and sets its price: from the tenant's price list, or from the
+// tenant's own prices when it has none or the list does not cover the
+// destination. It is the admission step of the message pipeline. The message
+// is counted against the quotas when it is stored, in counters shared by all
+// instances, so messages that fail later on do not use up quota.
+func (s *Service) Admit(ctx context.Context, msg *models.Message) error {
+	t, err := s.check(msg)
+	if err != nil || t == nil {
+		return err
+	}
+
+	day, month := periods(time.Now())
+	used, err := s.db.ClientUsage(ctx, t.ID, day, month)
+	if err != nil {
+		return err
+	}
+	if t.DailyQuota > 0 && used.Day >= t.DailyQuota {
+		return fmt.Errorf("%w: daily quota of %d messages", ErrQuotaExceeded, t.DailyQuota)
+	}
+	if t.MonthlyQuota > 0 && used.Month >= t.MonthlyQuota {
+		return fmt.Errorf("%w: monthly quota of %d messages", ErrQuotaExceeded, t.MonthlyQuota)
+	}
+	msg.Quota = &models.Quota{Day: day, Month: month, DailyLimit: t.DailyQuota, MonthlyLimit: t.MonthlyQuota}
+	// The volume tier counts this message as well
+	volume := used.Month + 1
+
+	if t.PriceList != "" {
+		if rating, ok := s.pricing.Rate(ctx, t.PriceList, msg, volume); ok {
+			msg.Price, msg.Destination = rating.Price, rating.Destination
+			return nil
+		}
+	}
+	if prefix, price, ok := priceFor(t.Prices, msg.Recipient); ok {
+		_, segments := utils.Segments(msg.Content)
+		msg.Price, msg.Destination = price*float64(segments), prefix
+	}
+	return nil
+}
+
+// check checks a message against the sender IDs of its tenant. It returns a
+// copy of the tenant, or nil for internal traffic.
+func (s *Service) check(msg *models.Message) (*models.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(msg.ClientID)
+	if err != nil || t == nil {
+		return nil, err
+	}
+
+	if len(t.SenderIDs) > 0 && !containsFold(t.SenderIDs, msg.Sender) {
+		return nil, fmt.Errorf("%w: %s", ErrSenderNotAllowed, msg.Sender)
+	}
+	tenant := *t
+	return &tenant, nil
+}
+
+// lookup returns the tenant of a client, or nil for internal traffic without
+// a client and, unless tenants are required, for clients without a tenant.
+// The caller must hold the lock.
+func (s *Service) lookup(clientID string) (*models.Tenant, error) {
+	t, ok := s.tenants[clientID]
+	if !ok {
+		if s.cfg.Required && clientID != "" {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, clientID)
+		}
+		return nil, nil
+	}
+	if t.Disabled {
+		return nil, ErrTenantDisabled
+	}
+	return t, nil
+}
+
+// validate checks the settings of a tenant. The caller must hold the lock.
+func (s *Service) validate(t *models.Tenant) error {
+	if t.ID == "" || len(t.ID) > maxTenantIDLen {
+		return fmt.Errorf("%w: ID must be 1 to %d characters", ErrInvalidTenant, maxTenantIDLen)
+	}
+	if t.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTenant)
+	}
+	if t.DailyQuota < 0 || t.MonthlyQuota < 0 || t.MaxTPS < 0 {
+		return fmt.Errorf("%w: quotas and TPS must not be negative", ErrInvalidTenant)
+	}
+
+	for _, sender := range t.SenderIDs {
+		if err := utils.ValidateSender(sender); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTenant, err)
+		}
+	}
+	for _, systemID := range t.SystemIDs {
+		if owner, ok := s.systems[systemID]; ok && owner != t.ID {
+			return fmt.Errorf("%w: system ID %s belongs to tenant %s", ErrInvalidTenant, systemID, owner)
+		}
+	}
+	for prefix, price := range t.Prices {
+		if price < 0 {
+			return fmt.Errorf("%w: negative price for %s", ErrInvalidTenant, prefix)
+		}
+	}
+
+	if t.RoutePlan != "" && !s.planExists(t.RoutePlan) {
+		return fmt.Errorf("%w: route plan not found: %s", ErrInvalidTenant, t.RoutePlan)
+	}
+	if t.PriceList != "" && !s.pricing.Exists(t.PriceList) {
+		return fmt.Errorf("%w: price list not found: %s", ErrInvalidTenant, t.PriceList)
+	}
+	return nil
+}
+
+func (s *Service) planExists(name string) bool {
+	for _, plan := range s.routing.Plans() {
+		if plan.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply caches a tenant and hands its route plan and TPS limit to the
+// routing and queue services. old is the previous version of the tenant, nil
+// for new ones. The caller must hold the lock.
+func (s *Service) apply(ctx context.Context, old, t *models.Tenant) error {
+	if old != nil {
+		for _, systemID := range old.SystemIDs {
+			delete(s.systems, systemID)
+		}
+	}
+	for _, systemID := range t.SystemIDs {
+		s.systems[systemID] = t.ID
+	}
+	s.tenants[t.ID] = t
+
+	// Each instance paces the queued messages of a tenant at its share of the
+	// limit, so that together they stay within it
+	s.queue.SetClientRate(t.ID, s.throttle.Share(t.MaxTPS))
+
+	switch {
+	case t.RoutePlan != "":
+		return s.routing.AssignPlan(ctx, t.ID, t.RoutePlan)
+	case old != nil && old.RoutePlan != "":
+		return s.routing.AssignPlan(ctx, t.ID, routing.DefaultPlan)
+	}
+	return nil
+}
+
+// periods returns the starts of the UTC day and month quotas are counted in
+func periods(now time.Time) (day, month time.Time) {
+	now = now.UTC()
+	day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return day, month
+}
+
+// priceFor returns the longest prefix matching a recipient and its price. A
+// "*" prefix matches every recipient and is returned as is.
+func priceFor(prices map[string]float64, recipient string) (string, float64, bool) {
+	recipient = normalizeNumber(recipient)
+	best, price, found := "", 0.0, false
+	for prefix, p := range prices {
+		prefix = strings.TrimSuffix(normalizeNumber(prefix), "*")
+		if strings.HasPrefix(recipient, prefix) && (!found || len(prefix) > len(best)) {
+			best, price, found = prefix, p, true
+		}
+	}
+	if found && best == "" {
+		best = "*"
+	}
+	return best, price, found
+}
+
+func normalizeNumber(number string) string {
+	number = strings.TrimSpace(number)
+	number = strings.TrimPrefix(number, "+")
+	return strings.TrimPrefix(number, "00")
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/core"
+	"smsc/internal/models"
+	"smsc/internal/services/webhook"
+)
+
+const (
+	defaultTimeout = 10 * time.Second
+	// reportTolerance is how old the signature of a delivery report may be
+	reportTolerance = 5 * time.Minute
+	// maxResponseBody bounds how much of a response is read
+	maxResponseBody = 4096
+)
+
+// ErrUnknownOperator is returned for delivery reports of operators without an
+// HTTP gateway
+var ErrUnknownOperator = errors.New("operator has no HTTP gateway")
+
+// SubmitRequest is the JSON body of a submit to an operator gateway
+type SubmitRequest struct {
+	MessageID   string `json:"messageId"`
+	Sender      string `json:"sender"`
+	Recipient   string `json:"recipient"`
+	Content     string `json:"content"`
+	DataCoding  int    `json:"dataCoding"`
+	ServiceType string `json:"serviceType,omitempty"`
+}
+
+// Report is the JSON body of a delivery report posted by an operator gateway
+type Report struct {
+	ID     string               `json:"id"`
+	Status models.MessageStatus `json:"status"`
+	Report string               `json:"report,omitempty"`
+}
+
+type operator struct {
+	url    string
+	secret string
+}
+
+// Gateway submits messages to operators reached over HTTP, such as an SMPP
+// or SS7 bridge run by the operator. Submits are POSTed as SubmitRequest to
+// the operator's submit URL, signed like webhooks with its secret, and answered
+// with {"id": "..."}. The operator posts delivery reports for that ID back,
+// signed with the same secret.
+type Gateway struct {
+	operators map[string]operator
+	client    *http.Client
+}
+
+// New creates a gateway for the operators with a submit URL
+func New(operators []config.OperatorConfig, log *logrus.Logger) *Gateway {
+	g := &Gateway{
+		operators: make(map[string]operator),
+		client:    &http.Client{Timeout: defaultTimeout},
+	}
+	for _, op := range operators {
+		if op.SubmitURL == "" {
+			continue
+		}
+		if op.Secret == "" {
+			log.Warnf("Operator %q has no secret; its delivery reports are refused", op.Name)
+		}
+		g.operators[op.Name] = operator{url: op.SubmitURL, secret: op.Secret}
+	}
+	return g
+}
+
+// Submit sends a message to an operator and returns the ID it assigned. It
+// implements core.Submitter and returns core.ErrNoUpstream for operators
+// without a submit URL.
+func (g *Gateway) Submit(ctx context.Context, operatorID string, msg *models.Message) (string, error) {
+	op, ok := g.operators[operatorID]
+	if !ok {
+		return "", core.ErrNoUpstream
+	}
+
+	body, err := json.Marshal(SubmitRequest{
+		MessageID:   msg.MessageID,
+		Sender:      msg.Sender,
+		Recipient:   msg.Recipient,
+		Content:     msg.Content,
+		DataCoding:  msg.DataCoding,
+		ServiceType: msg.ServiceType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode submit: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, op.url, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create submit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smsc-upstream/1.0")
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(op.secret, time.Now(), body))
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("submit to %s failed: %w", operatorID, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("operator %s returned %s: %s", operatorID, resp.Status, bytes.TrimSpace(data))
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil || result.ID == "" {
+		return "", fmt.Errorf("operator %s returned no message ID", operatorID)
+	}
+	return result.ID, nil
+}
+
+// ParseReport verifies the signature of a delivery report posted by an
+// operator and decodes it
+func (g *Gateway) ParseReport(operatorID, signature string, body []byte) (*Report, error) {
+	op, ok := g.operators[operatorID]
+	if !ok || op.secret == "" {
+		return nil, ErrUnknownOperator
+	}
+	if err := webhook.Verify(op.secret, signature, body, reportTolerance); err != nil {
+		return nil, fmt.Errorf("invalid delivery report signature: %w", err)
+	}
+
+	var r Report
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("invalid delivery report: %w", err)
+	}
+	if r.ID == "" {
+		return nil, fmt.Errorf("invalid delivery report: id is required")
+	}
+	return &r, nil
+}
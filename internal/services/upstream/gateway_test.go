@@ -0,0 +1,99 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/core"
+	"smsc/internal/models"
+	"smsc/internal/services/webhook"
+)
+
+func newTestGateway(t *testing.T, handler http.HandlerFunc) *Gateway {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return New([]config.OperatorConfig{
+		{Name: "op1", SubmitURL: server.URL, Secret: "op1-secret"},
+		{Name: "op2"},
+	}, log)
+}
+
+func TestSubmitSignsAndReturnsUpstreamID(t *testing.T) {
+	g := newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("op1-secret", r.Header.Get(webhook.SignatureHeader), body, time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		var req SubmitRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.Recipient != "447700900123" {
+			http.Error(w, "bad submit", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"id":"up-1"}`))
+	})
+
+	id, err := g.Submit(context.Background(), "op1", models.NewMessage("SMSC", "447700900123", "hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "up-1" {
+		t.Errorf("upstream ID = %q, want up-1", id)
+	}
+}
+
+func TestSubmitFailsOnRejectionAndMissingID(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"rejected": func(w http.ResponseWriter, r *http.Request) { http.Error(w, "busy", http.StatusServiceUnavailable) },
+		"no id":    func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(`{}`)) },
+	} {
+		g := newTestGateway(t, handler)
+		if _, err := g.Submit(context.Background(), "op1", models.NewMessage("SMSC", "447700900123", "hi")); err == nil {
+			t.Errorf("%s: submit succeeded", name)
+		}
+	}
+}
+
+func TestSubmitWithoutGateway(t *testing.T) {
+	g := newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {})
+	if _, err := g.Submit(context.Background(), "op2", models.NewMessage("SMSC", "447700900123", "hi")); !errors.Is(err, core.ErrNoUpstream) {
+		t.Errorf("error = %v, want core.ErrNoUpstream", err)
+	}
+}
+
+func TestParseReport(t *testing.T) {
+	g := newTestGateway(t, func(w http.ResponseWriter, r *http.Request) {})
+	body := []byte(`{"id":"up-1","status":"delivered"}`)
+
+	r, err := g.ParseReport("op1", webhook.Sign("op1-secret", time.Now(), body), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "up-1" || r.Status != models.StatusDelivered {
+		t.Errorf("report = %+v", r)
+	}
+
+	if _, err := g.ParseReport("op1", webhook.Sign("wrong", time.Now(), body), body); err == nil {
+		t.Error("report with a bad signature accepted")
+	}
+	if _, err := g.ParseReport("op1", webhook.Sign("op1-secret", time.Now().Add(-time.Hour), body), body); err == nil {
+		t.Error("replayed old report accepted")
+	}
+	if _, err := g.ParseReport("op2", "", body); !errors.Is(err, ErrUnknownOperator) {
+		t.Errorf("error = %v, want ErrUnknownOperator", err)
+	}
+}
@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxRedirects bounds the redirects followed by a callback
+const maxRedirects = 5
+
+// ErrForbiddenTarget is returned for callback URLs that are not https or that
+// reach loopback, private, link-local or other internal addresses
+var ErrForbiddenTarget = errors.New("forbidden callback target")
+
+// sharedAddressSpace is the carrier-grade NAT range, internal like private ranges
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// CheckURL validates a callback URL: it must be an https URL with a host.
+// Where the host points to is checked when connecting to it.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid callback URL: %q", raw)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: callback URL must use https: %q", ErrForbiddenTarget, raw)
+	}
+	return nil
+}
+
+// NewClient returns an HTTP client for callbacks to client systems. It only
+// connects to public addresses, checked after DNS resolution and on every
+// redirect, so that callbacks cannot reach the internal network.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: checkAddress}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect to the target on our behalf, unchecked
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return CheckURL(req.URL.String())
+		},
+	}
+}
+
+// checkAddress refuses connections to internal addresses. It runs for the
+// resolved address right before connecting.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || internalIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, host)
+	}
+	return nil
+}
+
+// internalIP reports whether an address is not publicly routable
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
@@ -0,0 +1,392 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/db"
+	"smsc/internal/models"
+)
+
+// EventMessageStatus is the event type of message status callbacks
+const EventMessageStatus = "message.status"
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultWorkers     = 4
+	defaultMaxAttempts = 8
+	defaultBackoff     = 30 * time.Second
+	defaultMaxBackoff  = time.Hour
+	pollInterval       = time.Second
+	// claimFactor is the number of deliveries claimed per worker at a time
+	claimFactor = 4
+	// maxResponseBody bounds how much of a failed response is kept in the log
+	maxResponseBody = 512
+)
+
+// Payload is the JSON body of a message status callback. Callbacks go to
+// clients, so it carries neither the operator nor its message ID.
+type Payload struct {
+	Event         string               `json:"event"`
+	MessageID     int64                `json:"messageId"`
+	SMPPMessageID string               `json:"smppMessageId,omitempty"`
+	ClientID      string               `json:"clientId,omitempty"`
+	CampaignID    string               `json:"campaignId,omitempty"`
+	Sender        string               `json:"sender"`
+	Recipient     string               `json:"recipient"`
+	Status        models.MessageStatus `json:"status"`
+	Error         string               `json:"error,omitempty"`
+	SentAt        *time.Time           `json:"sentAt,omitempty"`
+	DeliveredAt   *time.Time           `json:"deliveredAt,omitempty"`
+	Timestamp     time.Time            `json:"timestamp"`
+}
+
+// Service pushes message status changes to client callback URLs. Deliveries
+// are stored before they are sent, retried with exponential backoff and kept
+// as a delivery log.
+type Service struct {
+	cfg    config.WebhookConfig
+	db     *db.Database
+	client *http.Client
+	log    *logrus.Logger
+	mu     sync.Mutex
+	active bool
+	wake   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(cfg config.WebhookConfig, database *db.Database, log *logrus.Logger) *Service {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+
+	return &Service{
+		cfg:    cfg,
+		db:     database,
+		client: NewClient(cfg.Timeout),
+		log:    log,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// SetHTTPClient replaces the client callbacks are sent with, for example to
+// trust the certificate of a test receiver. The client is used as is, without
+// the address checks of NewClient. It must be called before Start.
+func (s *Service) SetHTTPClient(client *http.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = client
+}
+
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active {
+		return fmt.Errorf("webhook service is already running")
+	}
+	if !s.cfg.Enabled {
+		s.log.Info("Webhooks are disabled")
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	jobs := make(chan *models.WebhookDelivery, s.cfg.Workers)
+	s.wg.Add(1)
+	go s.dispatch(ctx, jobs)
+	for i := 0; i < s.cfg.Workers; i++ {
+		s.wg.Add(1)
+		go s.work(ctx, jobs)
+	}
+
+	s.active = true
+	s.log.Info("Webhook service started")
+	return nil
+}
+
+func (s *Service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return nil
+	}
+	s.active = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to stop webhook workers: %w", ctx.Err())
+	}
+
+	s.log.Info("Webhook service stopped")
+	return nil
+}
+
+// Notify stores a status callback for the message if it has a callback URL,
+// either its own or its client's. It has the signature of a pipeline status
+// listener.
+func (s *Service) Notify(ctx context.Context, messageID int64, status models.MessageStatus) {
+	if !s.cfg.Enabled {
+		return
+	}
+
+	log := s.log.WithField("message_id", messageID)
+
+	msg, err := s.db.GetMessage(ctx, messageID)
+	if err != nil {
+		log.WithError(err).Warn("Failed to load message for webhook")
+		return
+	}
+
+	url := msg.CallbackURL
+	if url == "" {
+		url = s.cfg.Clients[msg.ClientID].URL
+	}
+	if url == "" {
+		return
+	}
+
+	payload := Payload{
+		Event:         EventMessageStatus,
+		MessageID:     msg.ID,
+		SMPPMessageID: msg.MessageID,
+		ClientID:      msg.ClientID,
+		Sender:        msg.Sender,
+		Recipient:     msg.Recipient,
+		Status:        status,
+		Error:         msg.LastError,
+		SentAt:        msg.SentAt,
+		DeliveredAt:   msg.DeliveredAt,
+		Timestamp:     time.Now().UTC(),
+	}
+	if msg.CampaignID != nil {
+		payload.CampaignID = *msg.CampaignID
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode webhook payload")
+		return
+	}
+
+	delivery := &models.WebhookDelivery{
+		MessageID:     msg.ID,
+		ClientID:      msg.ClientID,
+		URL:           url,
+		Event:         EventMessageStatus,
+		Payload:       string(body),
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := s.db.CreateDelivery(ctx, delivery); err != nil {
+		log.WithError(err).Error("Failed to store webhook delivery")
+		return
+	}
+	s.signal()
+}
+
+// Replay queues failed deliveries to be sent again: a single delivery when id
+// is set, otherwise every failed delivery, optionally of one client only
+func (s *Service) Replay(ctx context.Context, id int64, clientID string) (int64, error) {
+	n, err := s.db.ReplayDeliveries(ctx, id, clientID)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		s.signal()
+	}
+	return n, nil
+}
+
+// Send makes a single delivery attempt and returns the response status code.
+// Deliveries to URLs that are not https are refused with ErrForbiddenTarget.
+func (s *Service) Send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	if err := CheckURL(delivery.URL); err != nil {
+		return 0, err
+	}
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "smsc-webhook/1.0")
+	req.Header.Set("X-SMSC-Event", delivery.Event)
+	req.Header.Set("X-SMSC-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(s.secret(delivery.ClientID), time.Now(), body))
+
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+		return resp.StatusCode, fmt.Errorf("webhook receiver returned %s: %s", resp.Status, bytes.TrimSpace(snippet))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// dispatch claims due deliveries and hands them to the workers
+func (s *Service) dispatch(ctx context.Context, jobs chan<- *models.WebhookDelivery) {
+	defer s.wg.Done()
+	defer close(jobs)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	// A claimed delivery may wait behind a full batch per worker before it
+	// is sent, so the lease covers that plus its own attempt
+	batch := s.cfg.Workers * claimFactor
+	lease := s.cfg.Timeout * time.Duration(claimFactor+1)
+
+	for {
+		deliveries, err := s.db.ClaimDueDeliveries(ctx, batch, lease)
+		if err != nil && ctx.Err() == nil {
+			s.log.WithError(err).Error("Failed to claim webhook deliveries")
+		}
+
+		for _, d := range deliveries {
+			select {
+			case jobs <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// Keep draining while there is a backlog
+		if len(deliveries) == batch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Service) work(ctx context.Context, jobs <-chan *models.WebhookDelivery) {
+	defer s.wg.Done()
+
+	for d := range jobs {
+		s.attempt(ctx, d)
+	}
+}
+
+// attempt sends a delivery and records the outcome, scheduling a retry with
+// exponential backoff until the attempts run out
+func (s *Service) attempt(ctx context.Context, d *models.WebhookDelivery) {
+	code, err := s.Send(ctx, d)
+	if err != nil && ctx.Err() != nil {
+		// Shutting down: the lease expires and the delivery is picked up again
+		return
+	}
+
+	s.settle(d, code, err)
+
+	updateCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.db.UpdateDelivery(updateCtx, d); err != nil {
+		s.log.WithError(err).WithField("delivery_id", d.ID).Error("Failed to update webhook delivery")
+	}
+}
+
+// settle applies the outcome of an attempt to a delivery: delivered, retried
+// after the backoff or failed once the attempts run out
+func (s *Service) settle(d *models.WebhookDelivery, code int, err error) {
+	d.Attempts++
+	d.LastCode = code
+	log := s.log.WithFields(logrus.Fields{
+		"delivery_id": d.ID,
+		"message_id":  d.MessageID,
+		"attempt":     d.Attempts,
+	})
+
+	if err == nil {
+		now := time.Now()
+		d.Status = models.DeliveryDelivered
+		d.LastError = ""
+		d.DeliveredAt = &now
+		log.Debug("Webhook delivered")
+	} else {
+		d.LastError = err.Error()
+		if d.Attempts >= s.cfg.MaxAttempts {
+			d.Status = models.DeliveryFailed
+			log.WithError(err).Warn("Webhook delivery failed permanently")
+		} else {
+			d.NextAttemptAt = time.Now().Add(s.backoff(d.Attempts))
+			log.WithError(err).WithField("retry_at", d.NextAttemptAt).Info("Webhook delivery failed, retrying")
+		}
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (s *Service) backoff(attempts int) time.Duration {
+	wait := s.cfg.Backoff
+	for i := 1; i < attempts && wait < s.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > s.cfg.MaxBackoff {
+		wait = s.cfg.MaxBackoff
+	}
+	return wait
+}
+
+// secret returns the signing secret of a client, falling back to the global one
+func (s *Service) secret(clientID string) string {
+	if client, ok := s.cfg.Clients[clientID]; ok && client.Secret != "" {
+		return client.Secret
+	}
+	return s.cfg.Secret
+}
+
+// signal wakes up the dispatcher without blocking
+func (s *Service) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
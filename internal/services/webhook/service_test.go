@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"smsc/internal/config"
+	"smsc/internal/models"
+)
+
+// receiver is a test callback endpoint that answers with the queued status
+// codes, then 200, and keeps the requests it got
+type receiver struct {
+	mu       sync.Mutex
+	codes    []int
+	bodies   []string
+	headers  []http.Header
+	received int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bodies = append(r.bodies, string(body))
+	r.headers = append(r.headers, req.Header.Clone())
+	code := http.StatusOK
+	if r.received < len(r.codes) {
+		code = r.codes[r.received]
+	}
+	r.received++
+	w.WriteHeader(code)
+}
+
+func newTestService(t *testing.T, recv *receiver) (*Service, *httptest.Server) {
+	t.Helper()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	server := httptest.NewTLSServer(recv)
+	t.Cleanup(server.Close)
+
+	s := New(config.WebhookConfig{
+		Enabled:     true,
+		Secret:      "global-secret",
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		MaxBackoff:  90 * time.Second,
+		Clients: map[string]config.WebhookClientConfig{
+			"acme": {Secret: "acme-secret"},
+		},
+	}, nil, log)
+	// The test receiver listens on loopback, which the default client refuses
+	s.SetHTTPClient(server.Client())
+	return s, server
+}
+
+func TestSendSignsBody(t *testing.T) {
+	recv := &receiver{}
+	s, server := newTestService(t, recv)
+
+	d := &models.WebhookDelivery{ID: 7, ClientID: "acme", URL: server.URL, Event: EventMessageStatus, Payload: `{"messageId":1}`}
+	if _, err := s.Send(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+
+	header := recv.headers[0].Get(SignatureHeader)
+	if !strings.HasPrefix(header, "t=") || !strings.Contains(header, ",v1=") {
+		t.Fatalf("signature header %q is not t=..,v1=..", header)
+	}
+	if err := Verify("acme-secret", header, []byte(recv.bodies[0]), time.Minute); err != nil {
+		t.Errorf("signature does not verify with the client secret: %v", err)
+	}
+	if err := Verify("global-secret", header, []byte(recv.bodies[0]), time.Minute); err == nil {
+		t.Error("signature verifies with the global secret instead of the client's")
+	}
+	if got := recv.headers[0].Get("X-SMSC-Delivery"); got != "7" {
+		t.Errorf("X-SMSC-Delivery = %q, want 7", got)
+	}
+}
+
+func TestRetryWithBackoffOnNon2xx(t *testing.T) {
+	recv := &receiver{codes: []int{http.StatusInternalServerError, http.StatusBadGateway}}
+	s, server := newTestService(t, recv)
+
+	d := &models.WebhookDelivery{URL: server.URL, Event: EventMessageStatus, Payload: `{}`, Status: models.DeliveryPending}
+	want := []time.Duration{time.Minute, 90 * time.Second}
+	for i, wait := range want {
+		before := time.Now()
+		code, err := s.Send(context.Background(), d)
+		if err == nil || code != recv.codes[i] {
+			t.Fatalf("attempt %d: got %d, %v, want an error for status %d", i+1, code, err, recv.codes[i])
+		}
+		s.settle(d, code, err)
+
+		if d.Status != models.DeliveryPending || d.Attempts != i+1 || d.LastCode != code {
+			t.Fatalf("attempt %d: delivery %+v, want pending with %d attempts", i+1, d, i+1)
+		}
+		if got := d.NextAttemptAt.Sub(before); got < wait || got > wait+time.Second {
+			t.Errorf("attempt %d: retried after %s, want %s", i+1, got, wait)
+		}
+	}
+
+	code, err := s.Send(context.Background(), d)
+	s.settle(d, code, err)
+	if d.Status != models.DeliveryDelivered || d.DeliveredAt == nil || d.LastError != "" {
+		t.Errorf("delivery %+v, want delivered on the third attempt", d)
+	}
+}
+
+func TestFailsAfterMaxAttempts(t *testing.T) {
+	recv := &receiver{codes: []int{500, 500, 500}}
+	s, server := newTestService(t, recv)
+
+	d := &models.WebhookDelivery{URL: server.URL, Event: EventMessageStatus, Payload: `{}`, Status: models.DeliveryPending}
+	for i := 0; i < 3; i++ {
+		code, err := s.Send(context.Background(), d)
+		s.settle(d, code, err)
+	}
+	if d.Status != models.DeliveryFailed {
+		t.Errorf("status after %d failed attempts = %s, want failed", d.Attempts, d.Status)
+	}
+}
+
+func TestReplayedDeliveryIsSignedAgain(t *testing.T) {
+	recv := &receiver{}
+	s, server := newTestService(t, recv)
+
+	d := &models.WebhookDelivery{URL: server.URL, Event: EventMessageStatus, Payload: `{"messageId":1}`}
+	if _, err := s.Send(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	first := recv.headers[0].Get(SignatureHeader)
+
+	// A receiver rejects the captured request once it is older than its tolerance
+	stale := Sign("global-secret", time.Now().Add(-10*time.Minute), []byte(d.Payload))
+	if err := Verify("global-secret", stale, []byte(d.Payload), 5*time.Minute); err == nil {
+		t.Error("a replayed old signature is accepted")
+	}
+
+	// Replaying the delivery sends it with a fresh signature
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if _, err := s.Send(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	second := recv.headers[1].Get(SignatureHeader)
+	if second == first {
+		t.Error("replayed delivery reuses the original signature")
+	}
+	if err := Verify("global-secret", second, []byte(recv.bodies[1]), 5*time.Minute); err != nil {
+		t.Errorf("replayed delivery does not verify: %v", err)
+	}
+}
+
+func TestDefaultClientRefusesInternalTargets(t *testing.T) {
+	server := httptest.NewTLSServer(&receiver{})
+	defer server.Close()
+
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	s := New(config.WebhookConfig{Enabled: true}, nil, log)
+
+	for _, url := range []string{
+		server.URL,
+		strings.Replace(server.URL, "https://", "http://", 1),
+		"https://169.254.169.254/latest/meta-data",
+		"https://10.0.0.1/hook",
+	} {
+		d := &models.WebhookDelivery{URL: url, Payload: `{}`}
+		if _, err := s.Send(context.Background(), d); !errors.Is(err, ErrForbiddenTarget) {
+			t.Errorf("%s: error %v, want ErrForbiddenTarget", url, err)
+		}
+	}
+}
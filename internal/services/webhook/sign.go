@@ -0,0 +1,63 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries the callback signature: t=<unix time>,v1=<hex HMAC>.
+// The HMAC-SHA256 is computed over "<unix time>.<body>" with the client's secret.
+const SignatureHeader = "X-SMSC-Signature"
+
+// Sign returns the signature header value for a callback body
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := timestamp.Unix()
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac(secret, ts, body)))
+}
+
+// Verify checks a signature header against the body. Signatures older than
+// tolerance are rejected to prevent replays; a zero tolerance disables the check.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var (
+		ts  int64
+		sig []byte
+		err error
+	)
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			if ts, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return fmt.Errorf("invalid signature timestamp")
+			}
+		case "v1":
+			if sig, err = hex.DecodeString(value); err != nil {
+				return fmt.Errorf("invalid signature encoding")
+			}
+		}
+	}
+	if ts == 0 || sig == nil {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	if tolerance > 0 && time.Since(time.Unix(ts, 0)) > tolerance {
+		return fmt.Errorf("signature timestamp is too old")
+	}
+	if !hmac.Equal(sig, mac(secret, ts, body)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func mac(secret string, ts int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(ts, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
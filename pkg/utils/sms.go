@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// Message encodings
+const (
+	EncodingGSM  = "GSM"
+	EncodingUCS2 = "UCS2"
+)
+
+// SMPP data_coding values for the supported encodings
+const (
+	DataCodingGSM  = 0x00
+	DataCodingUCS2 = 0x08
+)
+
+const (
+	gsmBasic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsmExtended = "\f^{}\\[~]|€"
+)
+
+// MaxSegments is the largest number of parts a concatenated message can have
+const MaxSegments = 255
+
+var (
+	e164Pattern         = regexp.MustCompile(`^\+?[1-9][0-9]{6,14}$`)
+	shortCodePattern    = regexp.MustCompile(`^[0-9]{3,8}$`)
+	alphanumericPattern = regexp.MustCompile(`^[A-Za-z0-9 ._&-]{1,11}$`)
+)
+
+// ValidateMSISDN checks that a number is in E.164 form, with or without the leading +
+func ValidateMSISDN(number string) error {
+	if !e164Pattern.MatchString(number) {
+		return fmt.Errorf("invalid E.164 number: %q", number)
+	}
+	return nil
+}
+
+// ValidateSender checks that a sender ID is an E.164 number, a short code or
+// an alphanumeric ID of at most 11 characters
+func ValidateSender(sender string) error {
+	if strings.IndexFunc(sender, isLetter) < 0 {
+		if e164Pattern.MatchString(sender) || shortCodePattern.MatchString(sender) {
+			return nil
+		}
+		return fmt.Errorf("invalid numeric sender: %q", sender)
+	}
+	if !alphanumericPattern.MatchString(sender) {
+		return fmt.Errorf("invalid alphanumeric sender: %q", sender)
+	}
+	return nil
+}
+
+// twoDigitCodes are the country calling codes of two digits. Codes starting
+// with 1 or 7 have one digit and all others three; no code is the prefix of
+// another.
+var twoDigitCodes = map[string]bool{
+	"20": true, "27": true, "30": true, "31": true, "32": true, "33": true, "34": true, "36": true,
+	"39": true, "40": true, "41": true, "43": true, "44": true, "45": true, "46": true, "47": true,
+	"48": true, "49": true, "51": true, "52": true, "53": true, "54": true, "55": true, "56": true,
+	"57": true, "58": true, "60": true, "61": true, "62": true, "63": true, "64": true, "65": true,
+	"66": true, "81": true, "82": true, "84": true, "86": true, "90": true, "91": true, "92": true,
+	"93": true, "94": true, "95": true, "98": true,
+}
+
+// CallingCode returns the country calling code of an international number,
+// with or without its leading + or 00, or an empty string when the number is
+// too short to have one
+func CallingCode(number string) string {
+	number = strings.TrimPrefix(strings.TrimPrefix(number, "+"), "00")
+	switch {
+	case len(number) < 4:
+		return ""
+	case number[0] == '1' || number[0] == '7':
+		return number[:1]
+	case twoDigitCodes[number[:2]]:
+		return number[:2]
+	default:
+		return number[:3]
+	}
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// Encoding returns the encoding required to send the content: GSM 03.38 when
+// every character is in the default alphabet, UCS2 otherwise
+func Encoding(content string) string {
+	for _, r := range content {
+		if !strings.ContainsRune(gsmBasic, r) && !strings.ContainsRune(gsmExtended, r) {
+			return EncodingUCS2
+		}
+	}
+	return EncodingGSM
+}
+
+// DataCoding returns the SMPP data_coding value of an encoding
+func DataCoding(encoding string) int {
+	if encoding == EncodingUCS2 {
+		return DataCodingUCS2
+	}
+	return DataCodingGSM
+}
+
+// Segments returns the encoding and the number of SMS segments needed to send
+// the content, accounting for the concatenation header in multipart messages
+func Segments(content string) (string, int) {
+	encoding := Encoding(content)
+
+	var units, single, multi int
+	if encoding == EncodingGSM {
+		for _, r := range content {
+			units++
+			if strings.ContainsRune(gsmExtended, r) {
+				units++
+			}
+		}
+		single, multi = 160, 153
+	} else {
+		units = len(utf16.Encode([]rune(content)))
+		single, multi = 70, 67
+	}
+
+	if units <= single {
+		return encoding, 1
+	}
+	return encoding, (units + multi - 1) / multi
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern matches template variables written as {{name}}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_]+)\s*\}\}`)
+
+// TemplateVariables returns the variable names used in a template
+func TemplateVariables(template string) []string {
+	seen := make(map[string]struct{})
+	var names []string
+	for _, m := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if _, ok := seen[m[1]]; !ok {
+			seen[m[1]] = struct{}{}
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// RenderTemplate replaces the {{name}} variables of a template. Variable names
+// are matched case-insensitively; a variable missing from vars is an error.
+func RenderTemplate(template string, vars map[string]string) (string, error) {
+	lower := make(map[string]string, len(vars))
+	for k, v := range vars {
+		lower[strings.ToLower(k)] = v
+	}
+
+	var missing []string
+	out := placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		v, ok := lower[strings.ToLower(name)]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing template variables: %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}